@@ -1,25 +1,122 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/tracing"
 )
 
 func main() {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL is required")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Getenv, os.Stdout)
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is required")
+	if err != nil {
+		fatal("invalid configuration", err)
 	}
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
 
-	server, err := NewServer(dbURL, jwtSecret)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		log.Fatalf("failed to build server: %v", err)
+		fatal("failed to set up tracing", err)
 	}
 
-	log.Println("listening on :8080")
-	server.engine.Run(":8080")
+	keys, err := newKeyring(cfg.Auth)
+	if err != nil {
+		fatal("failed to load jwt keys", err)
+	}
+	if cfg.Auth.KeyRotationInterval > 0 {
+		keys.StartRotation(ctx, cfg.Auth.KeyRotationInterval)
+	}
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		fatal("failed to set up mail", err)
+	}
+	mfaSecrets, err := newMFASecretBox(cfg.Auth)
+	if err != nil {
+		fatal("failed to set up mfa encryption", err)
+	}
+
+	server, err := NewServer(cfg, keys, Options{Mailer: mailer, MFASecrets: mfaSecrets, Logger: logger})
+	if err != nil {
+		fatal("failed to build server", err)
+	}
+	err = server.Run(ctx)
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if err != nil {
+		fatal("server stopped", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal logs err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newKeyring loads signing keys from the configured directory when there is one. Otherwise keys are
+// generated in memory, which is only suitable for a single replica since each process would publish
+// different keys.
+func newKeyring(cfg config.AuthConfig) (*auth.Keyring, error) {
+	// retired keys must outlive every access token they signed
+	retention := 2 * cfg.AccessTokenTTL
+	if cfg.KeysDir != "" {
+		return auth.NewKeyringFromDir(cfg.KeysDir, cfg.SigningAlg, retention)
+	}
+	slog.Warn("auth.keys_dir is not set, generating an ephemeral signing key")
+	return auth.NewGeneratedKeyring(cfg.SigningAlg, retention)
+}
+
+// newMailer writes outgoing mail to the configured directory when there is one. Otherwise it only logs who
+// each message is for, since bodies carry live tokens.
+func newMailer(cfg config.MailConfig) (mail.Sender, error) {
+	if cfg.Dir != "" {
+		return mail.NewFileSender(cfg.Dir)
+	}
+	return mail.NewLogSender(), nil
+}
+
+// newMFASecretBox uses the configured MFA encryption key. Without one a random key is used and every MFA
+// enrollment becomes unusable when the process restarts.
+func newMFASecretBox(cfg config.AuthConfig) (*auth.SecretBox, error) {
+	if cfg.MFAEncryptionKey == "" {
+		slog.Warn("auth.mfa_encryption_key is not set, generating an ephemeral key")
+		return auth.NewGeneratedSecretBox()
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.MFAEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewSecretBox(key)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+const migrateUsage = "usage: server migrate up|down|status|force VERSION [flags]"
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate implements `server migrate`. args follow the subcommand name; whatever follows the command
+// and its version is parsed as configuration, so the database is chosen the same way as for the server.
+func runMigrate(args []string, getenv func(string) string, out io.Writer) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	command, rest := args[0], args[1:]
+	var version int64
+	switch command {
+	case "up", "down", "status":
+	case "force":
+		if len(rest) == 0 {
+			return errMigrateUsage
+		}
+		v, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+		version, rest = v, rest[1:]
+	default:
+		return fmt.Errorf("unknown migrate command %q; %s", command, migrateUsage)
+	}
+	cfg, err := config.Load(rest, getenv)
+	if err != nil {
+		return err
+	}
+	m, err := dal.NewMigrator(cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch command {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down()
+	case "force":
+		err = m.Force(version)
+	}
+	if err != nil {
+		return err
+	}
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	printStatus(out, status)
+	return nil
+}
+
+func printStatus(out io.Writer, status dal.MigrationStatus) {
+	fmt.Fprintf(out, "version:  %d\n", status.Version)
+	fmt.Fprintf(out, "dirty:    %t\n", status.Dirty)
+	fmt.Fprintf(out, "expected: %d\n", dal.SchemaVersion)
+	fmt.Fprintf(out, "pending:  %d\n", len(status.Pending))
+	for _, v := range status.Pending {
+		fmt.Fprintf(out, "  %d\n", v)
+	}
+}
+
+// migrateUp applies pending migrations before the server starts, when database.auto_migrate is set.
+func migrateUp(dsn string) error {
+	m, err := dal.NewMigrator(dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil {
+		return err
+	}
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	slog.Info("database migrated", "version", status.Version)
+	return nil
+}
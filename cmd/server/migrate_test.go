@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+)
+
+func TestRunMigrate_Usage(t *testing.T) {
+	assert.ErrorIs(t, runMigrate(nil, os.Getenv, &bytes.Buffer{}), errMigrateUsage)
+	assert.ErrorIs(t, runMigrate([]string{"force"}, os.Getenv, &bytes.Buffer{}), errMigrateUsage)
+	assert.EqualError(t, runMigrate([]string{"force", "latest"}, os.Getenv, &bytes.Buffer{}), `invalid version "latest"`)
+	assert.ErrorContains(t, runMigrate([]string{"sideways"}, os.Getenv, &bytes.Buffer{}), `unknown migrate command "sideways"`)
+}
+
+func TestMigrations_GateStartup(t *testing.T) {
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	secrets, err := auth.NewGeneratedSecretBox()
+	require.NoError(t, err)
+	cfg := config.Default()
+	cfg.Database.URL = os.Getenv("DATABASE_URL")
+	opts := Options{Mailer: mail.NewLogSender(), MFASecrets: secrets}
+
+	var out bytes.Buffer
+	require.NoError(t, runMigrate([]string{"status"}, os.Getenv, &out))
+	assert.Contains(t, out.String(), "pending:  0")
+
+	// one migration behind: the server refuses to start until it is applied
+	out.Reset()
+	require.NoError(t, runMigrate([]string{"down"}, os.Getenv, &out))
+	assert.Contains(t, out.String(), "pending:  1")
+	_, err = NewServer(cfg, keys, opts)
+	assert.ErrorContains(t, err, "behind")
+
+	// replicas starting together take turns applying it
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = migrateUp(cfg.Database.URL)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	require.NoError(t, runMigrate([]string{"down"}, os.Getenv, &out))
+	cfg.Database.AutoMigrate = true
+	server, err := NewServer(cfg, keys, opts)
+	require.NoError(t, err)
+	defer server.CloseDB()
+
+	m, err := dal.NewMigrator(cfg.Database.URL)
+	require.NoError(t, err)
+	defer m.Close()
+	status, err := m.Status()
+	require.NoError(t, err)
+	assert.Equal(t, dal.MigrationStatus{Version: dal.SchemaVersion}, status)
+}
@@ -1,47 +1,250 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/config"
 	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/health"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/metrics"
 	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/middleware/ratelimit"
 	"github.com/thornhall/simple-go-service/internal/router"
 	"github.com/thornhall/simple-go-service/internal/service"
+	"github.com/thornhall/simple-go-service/internal/tracing"
 )
 
 type Server struct {
-	db     dal.DB
-	engine *gin.Engine
+	cfg *config.Config
+	// db is nil when the server keeps its data in memory.
+	db       dal.DB
+	engine   *gin.Engine
+	denylist *auth.Denylist
+	policy   *auth.Policy
+	purger   *service.UserPurger
+	limiters []*ratelimit.Limiter
+	// jobs tracks the goroutines started by Start so shutdown can wait for them to return.
+	jobs sync.WaitGroup
+	// checks backs /readyz. Dependencies register their checks here as they are wired up.
+	checks *health.Checker
+	// ready is true while the server is accepting traffic and goes false as soon as shutdown begins.
+	ready atomic.Bool
+	// addr is the address the listener is bound to once Run has started serving.
+	addr atomic.Value
 }
 
+// Ready reports whether the server is serving and not shutting down.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+var errNotServing = errors.New("server is not serving")
+
+// servingCheck fails readiness once shutdown begins so load balancers stop sending new requests.
+func (s *Server) servingCheck(ctx context.Context) (any, error) {
+	if !s.Ready() {
+		return nil, errNotServing
+	}
+	return nil, nil
+}
+
+// CloseDB closes the database pool. It does nothing when the server keeps its data in memory.
 func (s *Server) CloseDB() error {
-	s.db.GetPool().Close()
+	closeDB(s.db)
 	return nil
 }
 
-func NewServer(dbURL string, jwtSecretStr string) (*Server, error) {
-	maxConns := 25
-	maxConnIdleTime := 5 * time.Minute
-	db, err := dal.NewPostgresDB(dbURL, maxConns, maxConnIdleTime)
+// Options carries the dependencies built from the config before the server, which tests replace.
+type Options struct {
+	Mailer mail.Sender
+	// MFASecrets encrypts TOTP secrets at rest.
+	MFASecrets *auth.SecretBox
+	// Logger writes the access log and is handed to every request. It defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+func NewServer(cfg *config.Config, keys *auth.Keyring, opts Options) (*Server, error) {
+	db, st, err := openStorage(cfg)
 	if err != nil {
 		return nil, err
 	}
-	repo := dal.NewUserRepository(db)
-	userSvc := service.NewUserService(repo)
+	denylist := auth.NewDenylist(st.revocations, cfg.Auth.AccessTokenTTL)
+	if err := denylist.Sync(context.Background()); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	policy := auth.NewPolicy(st.roles)
+	if err := policy.Load(context.Background()); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	repo := metrics.InstrumentUserRepository(st.users)
+	tokenSvc := service.NewTokenService(repo, st.refreshTokens, keys, denylist)
+	tokenSvc.AccessTTL = cfg.Auth.AccessTokenTTL
+	tokenSvc.RefreshTTL = cfg.Auth.RefreshTokenTTL
+	verifySvc := service.NewVerificationService(repo, st.emailVerifications, opts.Mailer, cfg.Mail.VerifyEmailURL)
+	mfaSvc := service.NewMFAService(repo, st.mfa, tokenSvc, opts.MFASecrets)
+	userSvc := service.NewUserService(repo, tokenSvc, verifySvc, mfaSvc)
+	userSvc.RequireVerifiedEmail = cfg.Auth.RequireVerifiedEmail
+	userSvc.PasswordCost = cfg.Auth.BcryptCost
+	userSvc.Tx = st.tx
+	userSvc.RequireIfMatch = cfg.Users.RequireIfMatch
+	lockout := service.LockoutPolicy{Threshold: cfg.Lockout.Threshold, Base: cfg.Lockout.Base, Max: cfg.Lockout.Max}
+	userSvc.Lockout = lockout
+	mfaSvc.Lockout = lockout
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Shared {
+		limitStore = dal.NewRateLimitRepository(db)
+	}
+	loginIPLimiter := ratelimit.New(limitStore, "login-ip",
+		ratelimit.Limit{Burst: cfg.RateLimit.LoginIPBurst, Interval: cfg.RateLimit.LoginIPInterval})
+	userSvc.LoginLimiter = ratelimit.New(limitStore, "login-account",
+		ratelimit.Limit{Burst: cfg.RateLimit.LoginAccountBurst, Interval: cfg.RateLimit.LoginAccountInterval})
+	passwordSvc := service.NewPasswordService(repo, st.passwordResets, tokenSvc, opts.Mailer, cfg.Mail.PasswordResetURL)
+	passwordSvc.PasswordCost = cfg.Auth.BcryptCost
+	roleSvc := service.NewRoleService(repo, st.roles, tokenSvc)
 
 	r := gin.New()
-
-	authMiddleware := r.Group("/")
-	authMiddleware.Use(auth.JWTAuth([]byte(jwtSecretStr)))
-
-	r.Use(gin.Logger(), gin.Recovery())
-	router.RegisterUserRoutes(r, userSvc)
+	// handlers pass the gin context to services, so it must expose the request context's span
+	r.ContextWithFallback = true
+	// ctx.ClientIP keys the login rate limits, so X-Forwarded-For is only believed from known proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r.Use(tracing.Middleware(), logging.Middleware(logger), metrics.Middleware(), logging.Recovery(), apperr.Middleware(), auth.WithPolicy(policy))
+	authMiddleware := auth.JWTAuth(keys, denylist)
+	loginLimit := loginIPLimiter.Middleware(ratelimit.ByIP)
+	router.RegisterUserRoutes(r, userSvc, authMiddleware, loginLimit)
+	router.RegisterAuthRoutes(r, tokenSvc, keys)
+	router.RegisterPasswordRoutes(r, passwordSvc)
+	router.RegisterVerificationRoutes(r, verifySvc)
+	router.RegisterMFARoutes(r, mfaSvc, authMiddleware, loginLimit)
+	router.RegisterRoleRoutes(r, roleSvc, authMiddleware)
+	checks := health.NewChecker(cfg.Server.ReadinessCheckTimeout)
+	router.RegisterHealthRoutes(r, checks)
+	var pool *pgxpool.Pool
+	if db != nil {
+		pool = db.GetPool()
+	}
+	router.RegisterMetricsRoutes(r, metrics.NewRegistry(pool))
+	if err := router.RegisterDocsRoutes(r); err != nil {
+		closeDB(db)
+		return nil, err
+	}
 
 	server := &Server{
-		db:     db,
-		engine: r,
+		cfg:      cfg,
+		db:       db,
+		engine:   r,
+		denylist: denylist,
+		policy:   policy,
+		purger:   service.NewUserPurger(repo, cfg.Users.PurgeRetention),
+		limiters: []*ratelimit.Limiter{loginIPLimiter, userSvc.LoginLimiter},
+		checks:   checks,
+	}
+	checks.Register("server", server.servingCheck)
+	if db != nil {
+		checks.Register("postgres", dal.PingCheck(db))
+		checks.Register("migrations", dal.SchemaCheck(db, dal.SchemaVersion))
+		checks.Register("postgres_pool", dal.PoolCheck(db))
 	}
 	return server, nil
 }
+
+// Start runs the background jobs that keep the server's caches fresh and its tables tidy, each in its own
+// goroutine until ctx is cancelled. Wait returns once they have all stopped.
+func (s *Server) Start(ctx context.Context) {
+	s.goJob(func() { s.denylist.Run(ctx, s.cfg.Auth.DenylistSyncInterval) })
+	s.goJob(func() { s.policy.Run(ctx, s.cfg.Auth.PolicyReloadInterval) })
+	s.goJob(func() { s.purger.Run(ctx, s.cfg.Users.PurgeInterval) })
+	for _, limiter := range s.limiters {
+		s.goJob(func() { limiter.Run(ctx, s.cfg.RateLimit.PruneInterval) })
+	}
+}
+
+// Wait blocks until every job started by Start has returned.
+func (s *Server) Wait() {
+	s.jobs.Wait()
+}
+
+func (s *Server) goJob(run func()) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		run()
+	}()
+}
+
+// Run serves HTTP on the configured address until ctx is cancelled, then shuts down gracefully: readiness
+// starts failing, the listener closes after the configured delay, in-flight requests drain within the
+// shutdown timeout, background jobs stop and the database pool is closed.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Server.Addr)
+	if err != nil {
+		s.CloseDB()
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:      s.engine,
+		ReadTimeout:  s.cfg.Server.ReadTimeout,
+		WriteTimeout: s.cfg.Server.WriteTimeout,
+		IdleTimeout:  s.cfg.Server.IdleTimeout,
+	}
+
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer func() {
+		// a job may be mid-query when it is stopped, so the pool is only closed once they have all returned
+		stopJobs()
+		s.Wait()
+		s.CloseDB()
+	}()
+	s.Start(jobs)
+
+	served := make(chan error, 1)
+	go func() { served <- httpServer.Serve(ln) }()
+	s.addr.Store(ln.Addr().String())
+	s.ready.Store(true)
+	slog.Info("listening", "addr", ln.Addr().String())
+
+	select {
+	case err := <-served:
+		s.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	s.ready.Store(false)
+	slog.Info("shutting down, draining requests", "timeout", s.cfg.Server.ShutdownTimeout.String())
+	if delay := s.cfg.Server.ShutdownDelay; delay > 0 {
+		time.Sleep(delay)
+	}
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		// the deadline passed with requests still running, so cut them off
+		httpServer.Close()
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -8,12 +8,17 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 
+	"github.com/thornhall/simple-go-service/internal/config"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/model"
 	"github.com/thornhall/simple-go-service/internal/testutil"
 )
@@ -22,7 +27,6 @@ func TestMain(m *testing.M) {
 	t := &testing.T{}
 	dsn, container := testutil.StartPostgresContainer(t)
 	os.Setenv("DATABASE_URL", dsn)
-	os.Setenv("JWT_SECRET", "test_secret")
 	code := m.Run()
 	testcontainers.CleanupContainer(t, container, testcontainers.StopContext(context.Background()))
 	os.Exit(code)
@@ -30,11 +34,18 @@ func TestMain(m *testing.M) {
 
 func TestNewServer_WithRealDB(t *testing.T) {
 	dbURL := os.Getenv("DATABASE_URL")
-	jwtSecret := os.Getenv("JWT_SECRET")
 	assert.NotZero(t, dbURL)
-	assert.NotZero(t, jwtSecret)
 	gin.SetMode(gin.TestMode)
-	server, err := NewServer(dbURL, jwtSecret)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	secrets, err := auth.NewGeneratedSecretBox()
+	assert.NoError(t, err)
+	cfg := config.Default()
+	cfg.Database.URL = dbURL
+	server, err := NewServer(cfg, keys, Options{
+		Mailer:     mail.NewLogSender(),
+		MFASecrets: secrets,
+	})
 	defer server.CloseDB()
 	assert.NoError(t, err)
 
@@ -49,11 +60,120 @@ func TestNewServer_WithRealDB(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "S", userResponse.FirstName)
 	assert.Equal(t, "alices@example.com", userResponse.Email)
-	assert.Equal(t, "Smith", userResponse.LastName)
+	require.NotNil(t, userResponse.LastName)
+	assert.Equal(t, "Smith", *userResponse.LastName)
 	_, err = uuid.Parse(userResponse.ObjectId)
 	assert.NoError(t, err)
 
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("POST", "/users/"+userResponse.ObjectId, nil)
+	req = httptest.NewRequest("GET", "/users/"+userResponse.ObjectId, nil)
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
 	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var jwks auth.JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 1)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `simple_go_service_http_requests_total{method="POST",route="/users",status="201"}`)
+	assert.Contains(t, w.Body.String(), "simple_go_service_db_pool_max_connections")
+}
+
+func TestNewServer_InMemory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	secrets, err := auth.NewGeneratedSecretBox()
+	assert.NoError(t, err)
+	cfg := config.Default()
+	cfg.Storage = "memory"
+	server, err := NewServer(cfg, keys, Options{
+		Mailer:     mail.NewLogSender(),
+		MFASecrets: secrets,
+	})
+	assert.NoError(t, err)
+	defer server.CloseDB()
+
+	createBody := `{"first_name":"Mem","email":"mem@example.com","password":"test_pass1"}`
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, httptest.NewRequest("POST", "/users", bytes.NewBufferString(createBody)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created model.CreateUserResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/"+created.ObjectId, nil)
+	req.Header.Set("Authorization", "Bearer "+created.AccessToken)
+	server.engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"email":"mem@example.com"`)
+
+	w = httptest.NewRecorder()
+	server.engine.ServeHTTP(w, httptest.NewRequest("POST", "/users", bytes.NewBufferString(createBody)))
+	assert.Equal(t, http.StatusConflict, w.Code, "emails stay unique in memory")
+}
+
+func TestServer_RunDrainsOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	secrets, err := auth.NewGeneratedSecretBox()
+	assert.NoError(t, err)
+	cfg := config.Default()
+	cfg.Database.URL = os.Getenv("DATABASE_URL")
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.ShutdownTimeout = 5 * time.Second
+	server, err := NewServer(cfg, keys, Options{Mailer: mail.NewLogSender(), MFASecrets: secrets})
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	server.engine.GET("/slow", func(ctx *gin.Context) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		ctx.String(http.StatusOK, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Run(ctx) }()
+	assert.Eventually(t, server.Ready, 5*time.Second, 10*time.Millisecond)
+	resp, err := http.Get("http://" + server.addr.Load().(string) + "/readyz")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	type result struct {
+		status int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + server.addr.Load().(string) + "/slow")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		done <- result{status: resp.StatusCode}
+	}()
+	<-started
+	cancel()
+
+	res := <-done
+	assert.NoError(t, res.err)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.NoError(t, <-stopped)
+	assert.False(t, server.Ready())
+	w := httptest.NewRecorder()
+	server.engine.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Error(t, server.db.GetPool().Ping(context.Background()))
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/memstore"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// stores are the repositories the services are built on, backed by Postgres or by memory.
+type stores struct {
+	users              repo.UserRepository
+	roles              repo.RoleRepository
+	refreshTokens      repo.RefreshTokenRepository
+	revocations        repo.RevocationRepository
+	passwordResets     repo.PasswordResetRepository
+	emailVerifications repo.EmailVerificationRepository
+	mfa                repo.MFARepository
+	// tx is nil for memory, which has no transactions.
+	tx repo.Transactor
+}
+
+// openStorage builds the stores cfg.Storage selects. db is nil unless they are backed by Postgres, in
+// which case the schema has been checked, and migrated first if database.auto_migrate is set.
+func openStorage(cfg *config.Config) (db dal.DB, st stores, err error) {
+	if cfg.Storage == "memory" {
+		slog.Warn("storage is memory, nothing is kept when the server stops")
+		s := memstore.New()
+		return nil, stores{
+			users:              memstore.NewUserRepository(s),
+			roles:              memstore.NewRoleRepository(s),
+			refreshTokens:      memstore.NewRefreshTokenRepository(s),
+			revocations:        memstore.NewRevocationRepository(s),
+			passwordResets:     memstore.NewPasswordResetRepository(s),
+			emailVerifications: memstore.NewEmailVerificationRepository(s),
+			mfa:                memstore.NewMFARepository(s),
+		}, nil
+	}
+
+	if cfg.Database.AutoMigrate {
+		if err := migrateUp(cfg.Database.URL); err != nil {
+			return nil, stores{}, err
+		}
+	}
+	db, err = dal.NewPostgresDB(cfg.Database.URL, cfg.Database.MaxConns, cfg.Database.MaxConnIdleTime)
+	if err != nil {
+		return nil, stores{}, err
+	}
+	db = dal.NewTracedDB(db)
+	if err := dal.RequireSchema(context.Background(), db, dal.SchemaVersion); err != nil {
+		db.GetPool().Close()
+		return nil, stores{}, err
+	}
+	return db, stores{
+		users:              dal.NewUserRepository(db),
+		roles:              dal.NewRoleRepository(db),
+		refreshTokens:      dal.NewRefreshTokenRepository(db),
+		revocations:        dal.NewRevocationRepository(db),
+		passwordResets:     dal.NewPasswordResetRepository(db),
+		emailVerifications: dal.NewEmailVerificationRepository(db),
+		mfa:                dal.NewMFARepository(db),
+		// repeatable read turns a lost update into a serialization failure, which RunInTx retries
+		tx: dal.NewTransactor(db, dal.TxOptions{Isolation: pgx.RepeatableRead}),
+	}, nil
+}
+
+// closeDB closes the pool behind db, if there is one.
+func closeDB(db dal.DB) {
+	if db != nil {
+		db.GetPool().Close()
+	}
+}
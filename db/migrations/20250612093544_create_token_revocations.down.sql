@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+DROP TABLE IF EXISTS token_revocations;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- A row either revokes a single access token (jti) or every token a user was issued up to revoked_before.
+CREATE TABLE token_revocations (
+  id              BIGSERIAL PRIMARY KEY,
+  jti             TEXT,
+  user_id         BIGINT      NOT NULL,
+  revoked_before  TIMESTAMPTZ,
+  expires_at      TIMESTAMPTZ NOT NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT token_revocations_target CHECK (jti IS NOT NULL OR revoked_before IS NOT NULL)
+);
+
+CREATE INDEX idx_token_revocations_created_at ON token_revocations (created_at);
+CREATE INDEX idx_token_revocations_expires_at ON token_revocations (expires_at);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
@@ -0,0 +1,13 @@
+ALTER TABLE users
+  ADD COLUMN email_verified_at TIMESTAMPTZ,
+  ADD COLUMN pending_email     TEXT;
+
+CREATE TABLE email_verification_tokens (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  email       TEXT        NOT NULL,
+  token_hash  TEXT        NOT NULL UNIQUE,
+  expires_at  TIMESTAMPTZ NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
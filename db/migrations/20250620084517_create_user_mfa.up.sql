@@ -0,0 +1,16 @@
+CREATE TABLE user_mfa (
+  user_id           BIGINT      PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret_ciphertext BYTEA       NOT NULL,
+  confirmed_at      TIMESTAMPTZ,
+  last_used_step    BIGINT,
+  created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash   TEXT        NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, code_hash)
+);
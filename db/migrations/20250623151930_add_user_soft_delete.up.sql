@@ -0,0 +1,5 @@
+ALTER TABLE users
+  ADD COLUMN deleted_at TIMESTAMPTZ,
+  ADD COLUMN is_admin   BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE is_deleted;
@@ -0,0 +1,48 @@
+CREATE TABLE roles (
+  id    BIGSERIAL PRIMARY KEY,
+  name  TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE permissions (
+  id    BIGSERIAL PRIMARY KEY,
+  name  TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE role_permissions (
+  role_id        BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  permission_id  BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles (
+  user_id     BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role_id     BIGINT      NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  granted_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name) VALUES ('admin'), ('support'), ('user');
+
+INSERT INTO permissions (name) VALUES
+  ('users:read'),
+  ('users:list'),
+  ('users:update'),
+  ('users:delete'),
+  ('users:restore'),
+  ('roles:manage');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+  FROM roles r
+  JOIN permissions p
+    ON r.name = 'admin'
+    OR (r.name = 'support' AND p.name IN ('users:read', 'users:list'));
+
+-- every existing user gets the base role, and the interim is_admin flag becomes the admin role
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'user';
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'admin' WHERE u.is_admin;
+
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,11 @@
+ALTER TABLE users
+  ADD COLUMN failed_login_attempts INT NOT NULL DEFAULT 0,
+  ADD COLUMN locked_until          TIMESTAMPTZ;
+
+CREATE TABLE rate_limit_buckets (
+  key         TEXT             PRIMARY KEY,
+  tokens      DOUBLE PRECISION NOT NULL,
+  updated_at  TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
@@ -0,0 +1,17 @@
+-- Emails are now trimmed and lowercased before they are stored or looked up. Rows whose normalized
+-- address would collide with another account are left alone for an operator to resolve.
+UPDATE users u
+SET email = LOWER(TRIM(u.email))
+WHERE u.email <> LOWER(TRIM(u.email))
+  AND NOT EXISTS (
+    SELECT 1 FROM users o
+    WHERE o.id <> u.id AND LOWER(TRIM(o.email)) = LOWER(TRIM(u.email))
+  );
+
+UPDATE users
+SET pending_email = LOWER(TRIM(pending_email))
+WHERE pending_email <> LOWER(TRIM(pending_email));
+
+UPDATE email_verification_tokens
+SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email));
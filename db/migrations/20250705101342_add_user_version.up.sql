@@ -0,0 +1,4 @@
+-- version counts the writes to a user, so clients can send it back in If-Match and have a write refused
+-- when someone else changed the user since they read it.
+ALTER TABLE users
+  ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Older code reads last_name as a plain string and cannot scan a NULL.
+UPDATE users
+SET last_name = ''
+WHERE last_name IS NULL;
@@ -0,0 +1,5 @@
+-- A user without a last name is now stored with NULL rather than an empty string, so that clients can
+-- clear it with a null in a PATCH.
+UPDATE users
+SET last_name = NULL
+WHERE last_name = '';
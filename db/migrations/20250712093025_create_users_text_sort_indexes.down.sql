@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_last_name_sort;
+DROP INDEX IF EXISTS idx_users_first_name_sort;
+DROP INDEX IF EXISTS idx_users_email_sort;
@@ -0,0 +1,6 @@
+-- Users listed by a text field are ordered case-insensitively under the C collation, whatever the
+-- database's default collation is, so the order matches across deployments and the in-memory store.
+-- These indexes cover the sort keys the list query uses.
+CREATE INDEX idx_users_email_sort ON users (lower(email COLLATE "C"), (email COLLATE "C"), id);
+CREATE INDEX idx_users_first_name_sort ON users (lower(first_name COLLATE "C"), (first_name COLLATE "C"), id);
+CREATE INDEX idx_users_last_name_sort ON users (lower(COALESCE(last_name, '') COLLATE "C"), (COALESCE(last_name, '') COLLATE "C"), id);
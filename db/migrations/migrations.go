@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations so the server binary can apply them itself. Files are
+// named <version>_<description>.<up|down>.sql, as golang-migrate expects.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,156 @@
+// Package apperr defines the service's typed errors and renders them as RFC 7807 problem details. Every
+// error a client can see has a kind, which picks the HTTP status, and a stable code that clients can match
+// on instead of the message. Anything else is an internal error whose cause is logged but never sent.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Kind classifies an error by what the client can do about it.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindRateLimited
+	// KindPreconditionFailed means a conditional request's precondition, such as If-Match, did not hold.
+	KindPreconditionFailed
+	// KindPreconditionRequired means the request must be made conditional.
+	KindPreconditionRequired
+	// KindUnsupportedMediaType means the request body is in a format the endpoint does not take.
+	KindUnsupportedMediaType
+	// KindPayloadTooLarge means the request body is longer than the endpoint reads.
+	KindPayloadTooLarge
+)
+
+// Status returns the HTTP status errors of this kind are served with.
+func (k Kind) Status() int {
+	switch k {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindRateLimited:
+		return http.StatusTooManyRequests
+	case KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case KindPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case KindUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case KindPayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is a domain error. Code and Message are safe to show clients; Err is the underlying cause, kept for
+// logs and errors.As.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// RetryAfter tells a rate-limited client how long to wait. Zero omits the Retry-After header.
+	RetryAfter time.Duration
+	// Fields lists the individual problems with a rejected request body or query.
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError is one invalid field of a request. Field is the field's JSON path, e.g. "first_name".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error   { return New(KindValidation, code, message) }
+func Unauthorized(code, message string) *Error { return New(KindUnauthorized, code, message) }
+func Forbidden(code, message string) *Error    { return New(KindForbidden, code, message) }
+func NotFound(code, message string) *Error     { return New(KindNotFound, code, message) }
+func Conflict(code, message string) *Error     { return New(KindConflict, code, message) }
+func RateLimited(code, message string) *Error  { return New(KindRateLimited, code, message) }
+func PreconditionFailed(code, message string) *Error {
+	return New(KindPreconditionFailed, code, message)
+}
+func PreconditionRequired(code, message string) *Error {
+	return New(KindPreconditionRequired, code, message)
+}
+func UnsupportedMediaType(code, message string) *Error {
+	return New(KindUnsupportedMediaType, code, message)
+}
+func PayloadTooLarge(code, message string) *Error {
+	return New(KindPayloadTooLarge, code, message)
+}
+
+// ErrInternal is what clients see for any error that is not an *Error.
+var ErrInternal = New(KindInternal, "internal_error", "internal server error")
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is matches any *Error with the same code, so the copies made by Wrap and WithRetryAfter still match the
+// sentinel they were made from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err. Sentinels are shared, so they are never modified in place.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithRetryAfter returns a copy of e that asks the client to wait d before retrying.
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+// WithFields returns a copy of e listing the invalid fields of a request.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = fields
+	return &c
+}
+
+// From returns the *Error in err's chain, or ErrInternal wrapping err when there is none.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// KindOf returns the kind of the *Error in err's chain, or KindInternal.
+func KindOf(err error) Kind {
+	return From(err).Kind
+}
@@ -0,0 +1,127 @@
+package apperr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+)
+
+var errWidgetNotFound = apperr.NotFound("widget_not_found", "widget not found")
+
+func TestError_IsMatchesByCode(t *testing.T) {
+	cause := errors.New("no rows")
+	wrapped := fmt.Errorf("loading widget: %w", errWidgetNotFound.Wrap(cause))
+
+	assert.ErrorIs(t, wrapped, errWidgetNotFound)
+	assert.ErrorIs(t, wrapped, cause)
+	assert.NotErrorIs(t, wrapped, apperr.NotFound("gadget_not_found", "gadget not found"))
+	assert.Nil(t, errWidgetNotFound.Err, "Wrap leaves the sentinel untouched")
+	assert.Equal(t, "widget not found: no rows", errWidgetNotFound.Wrap(cause).Error())
+}
+
+func TestFrom(t *testing.T) {
+	assert.Same(t, errWidgetNotFound, apperr.From(fmt.Errorf("ctx: %w", errWidgetNotFound)))
+
+	e := apperr.From(errors.New("db down"))
+	assert.Equal(t, apperr.KindInternal, e.Kind)
+	assert.Equal(t, "internal_error", e.Code)
+	assert.EqualError(t, e.Err, "db down")
+	assert.Equal(t, http.StatusInternalServerError, apperr.KindOf(errors.New("db down")).Status())
+}
+
+func serve(handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apperr.Middleware())
+	r.GET("/widgets/:id", handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/widgets/7", nil))
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) apperr.Problem {
+	t.Helper()
+	assert.Equal(t, apperr.ContentType, w.Header().Get("Content-Type"))
+	var p apperr.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	return p
+}
+
+func TestMiddleware_RendersProblem(t *testing.T) {
+	w := serve(func(ctx *gin.Context) { _ = ctx.Error(errWidgetNotFound) })
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, apperr.Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "widget not found",
+		Instance: "/widgets/7",
+		Code:     "widget_not_found",
+	}, decode(t, w))
+}
+
+func TestMiddleware_ListsInvalidFields(t *testing.T) {
+	invalid := apperr.Validation("validation_failed", "request failed validation")
+	field := apperr.FieldError{Field: "name", Code: "required", Message: "is required"}
+	w := serve(func(ctx *gin.Context) { _ = ctx.Error(invalid.WithFields(field)) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []apperr.FieldError{field}, decode(t, w).Errors)
+	assert.Nil(t, invalid.Fields, "WithFields leaves the sentinel untouched")
+}
+
+func TestMiddleware_HidesInternalErrors(t *testing.T) {
+	w := serve(func(ctx *gin.Context) { _ = ctx.Error(errors.New("pq: password authentication failed")) })
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	p := decode(t, w)
+	assert.Equal(t, "internal_error", p.Code)
+	assert.Equal(t, "internal server error", p.Detail)
+	assert.NotContains(t, w.Body.String(), "password")
+}
+
+func TestMiddleware_SetsRetryAfter(t *testing.T) {
+	limited := apperr.RateLimited("slow_down", "slow down")
+	w := serve(func(ctx *gin.Context) { _ = ctx.Error(limited.WithRetryAfter(1500 * time.Millisecond)) })
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "slow_down", decode(t, w).Code)
+}
+
+func TestMiddleware_LeavesWrittenResponses(t *testing.T) {
+	w := serve(func(ctx *gin.Context) {
+		_ = ctx.Error(errors.New("logged only"))
+		ctx.JSON(http.StatusAccepted, gin.H{"status": "queued"})
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"status":"queued"}`, w.Body.String())
+}
+
+func TestAbort_StopsTheChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	reached := false
+	r.GET("/",
+		func(ctx *gin.Context) { apperr.Abort(ctx, apperr.Forbidden("forbidden", "forbidden")) },
+		func(ctx *gin.Context) { reached = true },
+	)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.False(t, reached)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden", decode(t, w).Code)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, "1", apperr.RetryAfter(time.Millisecond))
+	assert.Equal(t, "1", apperr.RetryAfter(time.Second))
+	assert.Equal(t, "2", apperr.RetryAfter(1001*time.Millisecond))
+}
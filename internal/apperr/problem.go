@@ -0,0 +1,67 @@
+package apperr
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem detail responses.
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem detail. Type is always about:blank, so Title is the status text; Code is
+// the extension member clients should branch on. Errors lists the invalid fields of a rejected request.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Middleware renders the last error a handler recorded with ctx.Error, unless the handler already wrote a
+// response.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+		write(ctx, ctx.Errors.Last().Err)
+	}
+}
+
+// Abort records err and answers with its problem right away. Middleware that turns a request away uses it
+// so the rejection is rendered even on routes mounted without Middleware.
+func Abort(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	write(ctx, err)
+}
+
+func write(ctx *gin.Context, err error) {
+	e := From(err)
+	status := e.Kind.Status()
+	if e.RetryAfter > 0 {
+		ctx.Header("Retry-After", RetryAfter(e.RetryAfter))
+	}
+	ctx.Header("Content-Type", ContentType)
+	ctx.AbortWithStatusJSON(status, Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: ctx.Request.URL.Path,
+		Code:     e.Code,
+		Errors:   e.Fields,
+	})
+}
+
+// RetryAfter formats wait as a Retry-After value: whole seconds, rounded up and never zero.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,266 @@
+// Package config loads the server's settings. Every setting has a default that can be overridden, in
+// increasing order of precedence, by a YAML or TOML file, an environment variable and a command line flag.
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	// Storage selects where data is kept: postgres, or memory for local development without a database.
+	// Nothing stored in memory survives a restart.
+	Storage   string
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	Mail      MailConfig
+	Users     UsersConfig
+	RateLimit RateLimitConfig
+	Lockout   LockoutConfig
+	Tracing   TracingConfig
+	Log       LogConfig
+}
+
+type ServerConfig struct {
+	Addr         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownDelay keeps serving after readiness starts failing, giving load balancers time to stop
+	// routing new requests here before connections are closed.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to drain.
+	ShutdownTimeout time.Duration
+	// ReadinessCheckTimeout bounds each dependency check behind /readyz.
+	ReadinessCheckTimeout time.Duration
+	// TrustedProxies are the addresses or CIDR ranges of proxies whose X-Forwarded-For is believed when
+	// working out the client address. Empty trusts none, so clients cannot pick their own address.
+	TrustedProxies []string
+}
+
+type DatabaseConfig struct {
+	URL             string
+	MaxConns        int
+	MaxConnIdleTime time.Duration
+	// AutoMigrate applies pending migrations at startup. Replicas starting together take turns through a
+	// Postgres advisory lock.
+	AutoMigrate bool
+}
+
+type AuthConfig struct {
+	// SigningAlg is the JWT signing algorithm, EdDSA or RS256.
+	SigningAlg string
+	// KeysDir holds the signing keys. When empty keys are generated in memory, which only suits a single
+	// replica since each process would publish different keys.
+	KeysDir string
+	// KeyRotationInterval rotates the signing key periodically. Zero disables rotation.
+	KeyRotationInterval time.Duration
+	AccessTokenTTL      time.Duration
+	RefreshTokenTTL     time.Duration
+	BcryptCost          int
+	// RequireVerifiedEmail blocks logins from accounts that have not confirmed their email.
+	RequireVerifiedEmail bool
+	// MFAEncryptionKey is the base64 encoded 32-byte key that encrypts TOTP secrets. When empty a random
+	// key is used and every MFA enrollment becomes unusable when the process restarts.
+	MFAEncryptionKey     string
+	DenylistSyncInterval time.Duration
+	PolicyReloadInterval time.Duration
+}
+
+type MailConfig struct {
+	// Dir receives outgoing mail as files. When empty only each message's recipient and subject are logged.
+	Dir              string
+	PasswordResetURL string
+	VerifyEmailURL   string
+}
+
+type UsersConfig struct {
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// RequireIfMatch answers updates and deletes without an If-Match header with 428 Precondition Required.
+	RequireIfMatch bool
+}
+
+type RateLimitConfig struct {
+	// Shared keeps buckets in Postgres so every replica enforces the same limits.
+	Shared               bool
+	PruneInterval        time.Duration
+	LoginIPBurst         int
+	LoginIPInterval      time.Duration
+	LoginAccountBurst    int
+	LoginAccountInterval time.Duration
+}
+
+type LockoutConfig struct {
+	// Threshold is the number of consecutive wrong passwords or MFA codes that locks an account. Zero disables
+	// lockout.
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+type TracingConfig struct {
+	// Exporter is where spans go: none, stdout or otlp.
+	Exporter string
+	// OTLPEndpoint is the collector's OTLP/HTTP URL, e.g. http://localhost:4318. When empty the exporter
+	// falls back to the standard OTEL_EXPORTER_OTLP_* environment variables.
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string
+}
+
+// Default returns the settings used when nothing overrides them. Only Database.URL has no usable default,
+// and it is only needed when Storage is postgres.
+func Default() *Config {
+	return &Config{
+		Storage: "postgres",
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+
+			ReadinessCheckTimeout: 2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxConns:        25,
+			MaxConnIdleTime: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			SigningAlg:           "EdDSA",
+			AccessTokenTTL:       15 * time.Minute,
+			RefreshTokenTTL:      30 * 24 * time.Hour,
+			BcryptCost:           bcrypt.DefaultCost,
+			DenylistSyncInterval: 5 * time.Second,
+			PolicyReloadInterval: time.Minute,
+		},
+		Mail: MailConfig{
+			PasswordResetURL: "http://localhost:8080/reset-password",
+			VerifyEmailURL:   "http://localhost:8080/users/verify-email",
+		},
+		Users: UsersConfig{
+			PurgeRetention: 30 * 24 * time.Hour,
+			PurgeInterval:  time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			PruneInterval:        10 * time.Minute,
+			LoginIPBurst:         20,
+			LoginIPInterval:      3 * time.Second,
+			LoginAccountBurst:    10,
+			LoginAccountInterval: time.Minute,
+		},
+		Lockout: LockoutConfig{
+			Threshold: 5,
+			Base:      time.Minute,
+			Max:       time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "simple-go-service",
+		},
+		Log: LogConfig{Level: "info"},
+	}
+}
+
+// Validate reports every invalid setting at once, naming each by its key.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, key, "must be a positive duration, got %s", d)
+	}
+
+	check(c.Storage == "postgres" || c.Storage == "memory", "storage", "must be postgres or memory, got %q", c.Storage)
+	check(c.Server.Addr != "", "server.addr", "is required")
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay", "must not be negative")
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	positive("server.readiness_check_timeout", c.Server.ReadinessCheckTimeout)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			_, err = netip.ParseAddr(proxy)
+		}
+		check(err == nil, "server.trusted_proxies", "must be IP addresses or CIDR ranges, got %q", proxy)
+	}
+	if c.Storage == "postgres" {
+		check(c.Database.URL != "", "database.url", "is required")
+	}
+	check(c.Database.MaxConns > 0, "database.max_conns", "must be at least 1, got %d", c.Database.MaxConns)
+	positive("database.max_conn_idle_time", c.Database.MaxConnIdleTime)
+
+	check(c.Auth.SigningAlg == "EdDSA" || c.Auth.SigningAlg == "RS256",
+		"auth.signing_alg", "must be EdDSA or RS256, got %q", c.Auth.SigningAlg)
+	check(c.Auth.KeyRotationInterval >= 0, "auth.key_rotation_interval", "must not be negative")
+	positive("auth.access_token_ttl", c.Auth.AccessTokenTTL)
+	positive("auth.refresh_token_ttl", c.Auth.RefreshTokenTTL)
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"auth.bcrypt_cost", "must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Auth.BcryptCost)
+	if c.Auth.MFAEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.Auth.MFAEncryptionKey)
+		check(err == nil && len(key) == 32, "auth.mfa_encryption_key", "must be 32 bytes encoded as base64")
+	}
+	positive("auth.denylist_sync_interval", c.Auth.DenylistSyncInterval)
+	positive("auth.policy_reload_interval", c.Auth.PolicyReloadInterval)
+
+	absolute := func(key, raw string) {
+		u, err := url.Parse(raw)
+		check(err == nil && u.IsAbs() && u.Host != "", key, "must be an absolute URL, got %q", raw)
+	}
+	absolute("mail.password_reset_url", c.Mail.PasswordResetURL)
+	absolute("mail.verify_email_url", c.Mail.VerifyEmailURL)
+
+	positive("users.purge_retention", c.Users.PurgeRetention)
+	positive("users.purge_interval", c.Users.PurgeInterval)
+
+	if c.Storage == "memory" {
+		check(!c.RateLimit.Shared, "rate_limit.shared", "needs storage postgres")
+	}
+	positive("rate_limit.prune_interval", c.RateLimit.PruneInterval)
+	check(c.RateLimit.LoginIPBurst > 0, "rate_limit.login_ip_burst", "must be at least 1, got %d", c.RateLimit.LoginIPBurst)
+	positive("rate_limit.login_ip_interval", c.RateLimit.LoginIPInterval)
+	check(c.RateLimit.LoginAccountBurst > 0, "rate_limit.login_account_burst", "must be at least 1, got %d", c.RateLimit.LoginAccountBurst)
+	positive("rate_limit.login_account_interval", c.RateLimit.LoginAccountInterval)
+
+	check(c.Lockout.Threshold >= 0, "lockout.threshold", "must not be negative, got %d", c.Lockout.Threshold)
+	if c.Lockout.Threshold > 0 {
+		positive("lockout.base", c.Lockout.Base)
+		check(c.Lockout.Max >= c.Lockout.Base, "lockout.max", "must not be shorter than lockout.base")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint != "" {
+			u, err := url.Parse(c.Tracing.OTLPEndpoint)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"tracing.otlp_endpoint", "must be an http or https URL, got %q", c.Tracing.OTLPEndpoint)
+		}
+	default:
+		check(false, "tracing.exporter", "must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name", "is required")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	return errors.Join(errs...)
+}
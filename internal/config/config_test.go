@@ -0,0 +1,199 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"DATABASE_URL": "postgres://localhost/db"}))
+	require.NoError(t, err)
+	want := Default()
+	want.Database.URL = "postgres://localhost/db"
+	assert.Equal(t, want, cfg)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+database:
+  url: postgres://file/db
+  max_conns: 10
+  max_conn_idle_time: 1m
+auth:
+  bcrypt_cost: 12
+  require_verified_email: true
+`)
+	cfg, err := Load(
+		[]string{"--config", yamlFile, "--database.max-conns", "40", "--auth.require-verified-email=false"},
+		env(map[string]string{"DATABASE_MAX_CONNS": "30", "BCRYPT_COST": "11", "LISTEN_ADDR": ":9090"}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://file/db", cfg.Database.URL, "file beats default")
+	assert.Equal(t, time.Minute, cfg.Database.MaxConnIdleTime)
+	assert.Equal(t, 11, cfg.Auth.BcryptCost, "env beats file")
+	assert.Equal(t, ":9090", cfg.Server.Addr)
+	assert.Equal(t, 40, cfg.Database.MaxConns, "flag beats env and file")
+	assert.False(t, cfg.Auth.RequireVerifiedEmail, "flag beats file")
+
+	// a bare boolean flag means true
+	cfg, err = Load([]string{"--auth.require-verified-email"}, env(map[string]string{"DATABASE_URL": "postgres://x/db"}))
+	require.NoError(t, err)
+	assert.True(t, cfg.Auth.RequireVerifiedEmail)
+}
+
+func TestLoad_MemoryStorageNeedsNoDatabase(t *testing.T) {
+	cfg, err := Load([]string{"--storage=memory"}, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.Storage)
+}
+
+func TestLoad_Lists(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+database:
+  url: postgres://file/db
+server:
+  trusted_proxies: [10.0.0.0/8, 192.168.1.7]
+`)
+	cfg, err := Load([]string{"--config", yamlFile}, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.7"}, cfg.Server.TrustedProxies)
+
+	cfg, err = Load(nil, env(map[string]string{"DATABASE_URL": "postgres://x/db", "TRUSTED_PROXIES": " 10.1.2.3, fd00::/8 "}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.1.2.3", "fd00::/8"}, cfg.Server.TrustedProxies)
+}
+
+func TestLoad_TOML(t *testing.T) {
+	tomlFile := writeFile(t, "config.toml", `
+[database]
+url = "postgres://toml/db"
+
+[rate_limit]
+shared = true
+login_ip_burst = 50
+login_ip_interval = "500ms"
+`)
+	cfg, err := Load(nil, env(map[string]string{"CONFIG_FILE": tomlFile}))
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://toml/db", cfg.Database.URL)
+	assert.True(t, cfg.RateLimit.Shared)
+	assert.Equal(t, 50, cfg.RateLimit.LoginIPBurst)
+	assert.Equal(t, 500*time.Millisecond, cfg.RateLimit.LoginIPInterval)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr []string
+	}{
+		{
+			name:    "missing database url",
+			wantErr: []string{"database.url: is required"},
+		},
+		{
+			name:    "bad values name their source",
+			args:    []string{"--lockout.base", "soon"},
+			env:     map[string]string{"DATABASE_URL": "postgres://x/db", "DATABASE_MAX_CONNS": "many"},
+			wantErr: []string{`database.max_conns (from env DATABASE_MAX_CONNS): invalid integer "many"`, `lockout.base (from flag --lockout.base): invalid duration "soon"`},
+		},
+		{
+			name:    "unknown file keys are rejected",
+			file:    "database:\n  url: postgres://x/db\n  max_con: 3\n",
+			wantErr: []string{"database.max_con", "unknown setting"},
+		},
+		{
+			name: "validation reports every problem",
+			env: map[string]string{
+				"DATABASE_URL":       "postgres://x/db",
+				"JWT_SIGNING_ALG":    "HS256",
+				"BCRYPT_COST":        "2",
+				"MFA_ENCRYPTION_KEY": "c2hvcnQ=",
+				"PASSWORD_RESET_URL": "/reset",
+				"LOCKOUT_MAX":        "1s",
+			},
+			wantErr: []string{
+				`auth.signing_alg: must be EdDSA or RS256, got "HS256"`,
+				"auth.bcrypt_cost: must be between 4 and 31, got 2",
+				"auth.mfa_encryption_key",
+				`mail.password_reset_url: must be an absolute URL, got "/reset"`,
+				"lockout.max: must not be shorter than lockout.base",
+			},
+		},
+		{
+			name:    "trusted proxies must be addresses",
+			env:     map[string]string{"DATABASE_URL": "postgres://x/db", "TRUSTED_PROXIES": "10.0.0.0/8,proxy.internal"},
+			wantErr: []string{`server.trusted_proxies: must be IP addresses or CIDR ranges, got "proxy.internal"`},
+		},
+		{
+			name:    "unknown tracing exporter",
+			args:    []string{"--tracing.exporter", "jaeger"},
+			env:     map[string]string{"DATABASE_URL": "postgres://x/db"},
+			wantErr: []string{`tracing.exporter: must be none, stdout or otlp, got "jaeger"`},
+		},
+		{
+			name:    "otlp endpoint must be a URL",
+			args:    []string{"--tracing.exporter", "otlp", "--tracing.otlp-endpoint", "collector:4318"},
+			env:     map[string]string{"DATABASE_URL": "postgres://x/db"},
+			wantErr: []string{`tracing.otlp_endpoint: must be an http or https URL, got "collector:4318"`},
+		},
+		{
+			name:    "unknown storage",
+			args:    []string{"--storage", "sqlite"},
+			wantErr: []string{`storage: must be postgres or memory, got "sqlite"`},
+		},
+		{
+			name:    "memory storage cannot share rate limits",
+			args:    []string{"--storage", "memory", "--rate-limit.shared"},
+			wantErr: []string{"rate_limit.shared: needs storage postgres"},
+		},
+		{
+			name:    "unknown log level",
+			env:     map[string]string{"DATABASE_URL": "postgres://x/db", "LOG_LEVEL": "verbose"},
+			wantErr: []string{`log.level: must be debug, info, warn or error, got "verbose"`},
+		},
+		{
+			name:    "unknown flags",
+			args:    []string{"--no-such-flag"},
+			wantErr: []string{"no-such-flag"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeFile(t, "config.yml", tt.file)}, args...)
+			}
+			_, err := Load(args, env(tt.env))
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestLoad_ExampleFile(t *testing.T) {
+	cfg, err := Load([]string{"--config", "../../config.example.yaml"}, env(nil))
+	require.NoError(t, err)
+	want := Default()
+	want.Database.URL = cfg.Database.URL
+	assert.Equal(t, want, cfg, "the example file documents the defaults")
+}
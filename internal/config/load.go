@@ -0,0 +1,268 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting binds one field of Config to its file key, environment variable and flag. The flag name is the
+// key with underscores replaced by dashes.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	set   func(string) error
+	bool  bool
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+func stringSetting(key, env, usage string, p *string) setting {
+	return setting{key: key, env: env, usage: usage, set: func(v string) error {
+		*p = v
+		return nil
+	}}
+}
+
+func intSetting(key, env, usage string, p *int) setting {
+	return setting{key: key, env: env, usage: usage, set: func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = n
+		return nil
+	}}
+}
+
+func boolSetting(key, env, usage string, p *bool) setting {
+	return setting{key: key, env: env, usage: usage, bool: true, set: func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*p = b
+		return nil
+	}}
+}
+
+func durationSetting(key, env, usage string, p *time.Duration) setting {
+	return setting{key: key, env: env, usage: usage, set: func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*p = d
+		return nil
+	}}
+}
+
+// listSetting reads a comma separated list. An empty value is an empty list.
+func listSetting(key, env, usage string, p *[]string) setting {
+	return setting{key: key, env: env, usage: usage, set: func(v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+		return nil
+	}}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting("server.addr", "LISTEN_ADDR", "address the HTTP server listens on", &c.Server.Addr),
+		durationSetting("server.read_timeout", "SERVER_READ_TIMEOUT", "maximum time to read a request", &c.Server.ReadTimeout),
+		durationSetting("server.write_timeout", "SERVER_WRITE_TIMEOUT", "maximum time to write a response", &c.Server.WriteTimeout),
+		durationSetting("server.idle_timeout", "SERVER_IDLE_TIMEOUT", "how long idle keep-alive connections are kept", &c.Server.IdleTimeout),
+		durationSetting("server.shutdown_delay", "SERVER_SHUTDOWN_DELAY", "time between failing readiness and closing the listener", &c.Server.ShutdownDelay),
+		durationSetting("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", "deadline for draining in-flight requests on shutdown", &c.Server.ShutdownTimeout),
+		durationSetting("server.readiness_check_timeout", "SERVER_READINESS_CHECK_TIMEOUT", "deadline for each dependency check behind /readyz", &c.Server.ReadinessCheckTimeout),
+		listSetting("server.trusted_proxies", "TRUSTED_PROXIES", "comma separated proxy addresses or CIDR ranges whose X-Forwarded-For is trusted", &c.Server.TrustedProxies),
+
+		stringSetting("storage", "STORAGE", "where data is kept: postgres, or memory for local development", &c.Storage),
+
+		stringSetting("database.url", "DATABASE_URL", "Postgres connection URL", &c.Database.URL),
+		intSetting("database.max_conns", "DATABASE_MAX_CONNS", "maximum open database connections", &c.Database.MaxConns),
+		durationSetting("database.max_conn_idle_time", "DATABASE_MAX_CONN_IDLE_TIME", "how long an idle connection is kept", &c.Database.MaxConnIdleTime),
+		boolSetting("database.auto_migrate", "DATABASE_AUTO_MIGRATE", "apply pending migrations at startup", &c.Database.AutoMigrate),
+
+		stringSetting("auth.signing_alg", "JWT_SIGNING_ALG", "JWT signing algorithm, EdDSA or RS256", &c.Auth.SigningAlg),
+		stringSetting("auth.keys_dir", "JWT_KEYS_DIR", "directory holding the JWT signing keys", &c.Auth.KeysDir),
+		durationSetting("auth.key_rotation_interval", "JWT_KEY_ROTATION_INTERVAL", "signing key rotation interval, 0 disables rotation", &c.Auth.KeyRotationInterval),
+		durationSetting("auth.access_token_ttl", "ACCESS_TOKEN_TTL", "access token lifetime", &c.Auth.AccessTokenTTL),
+		durationSetting("auth.refresh_token_ttl", "REFRESH_TOKEN_TTL", "refresh token lifetime", &c.Auth.RefreshTokenTTL),
+		intSetting("auth.bcrypt_cost", "BCRYPT_COST", "bcrypt cost for password hashes", &c.Auth.BcryptCost),
+		boolSetting("auth.require_verified_email", "REQUIRE_VERIFIED_EMAIL", "refuse logins until the email address is verified", &c.Auth.RequireVerifiedEmail),
+		stringSetting("auth.mfa_encryption_key", "MFA_ENCRYPTION_KEY", "base64 encoded 32-byte key encrypting TOTP secrets", &c.Auth.MFAEncryptionKey),
+		durationSetting("auth.denylist_sync_interval", "DENYLIST_SYNC_INTERVAL", "how often revocations made by other replicas are loaded", &c.Auth.DenylistSyncInterval),
+		durationSetting("auth.policy_reload_interval", "POLICY_RELOAD_INTERVAL", "how often role permissions are reloaded", &c.Auth.PolicyReloadInterval),
+
+		stringSetting("mail.dir", "MAIL_DIR", "directory outgoing mail is written to, empty only logs recipients and subjects", &c.Mail.Dir),
+		stringSetting("mail.password_reset_url", "PASSWORD_RESET_URL", "page password reset links point at", &c.Mail.PasswordResetURL),
+		stringSetting("mail.verify_email_url", "VERIFY_EMAIL_URL", "endpoint email verification links point at", &c.Mail.VerifyEmailURL),
+
+		durationSetting("users.purge_retention", "USER_PURGE_RETENTION", "how long soft-deleted users are kept", &c.Users.PurgeRetention),
+		durationSetting("users.purge_interval", "USER_PURGE_INTERVAL", "how often expired soft-deleted users are purged", &c.Users.PurgeInterval),
+		boolSetting("users.require_if_match", "REQUIRE_IF_MATCH", "refuse user updates and deletes without an If-Match header", &c.Users.RequireIfMatch),
+
+		boolSetting("rate_limit.shared", "SHARED_RATE_LIMITS", "keep rate limit buckets in Postgres", &c.RateLimit.Shared),
+		durationSetting("rate_limit.prune_interval", "RATE_LIMIT_PRUNE_INTERVAL", "how often idle rate limit buckets are dropped", &c.RateLimit.PruneInterval),
+		intSetting("rate_limit.login_ip_burst", "LOGIN_IP_BURST", "login attempts allowed per address in a burst", &c.RateLimit.LoginIPBurst),
+		durationSetting("rate_limit.login_ip_interval", "LOGIN_IP_INTERVAL", "time to regain one login attempt per address", &c.RateLimit.LoginIPInterval),
+		intSetting("rate_limit.login_account_burst", "LOGIN_ACCOUNT_BURST", "login attempts allowed per account in a burst", &c.RateLimit.LoginAccountBurst),
+		durationSetting("rate_limit.login_account_interval", "LOGIN_ACCOUNT_INTERVAL", "time to regain one login attempt per account", &c.RateLimit.LoginAccountInterval),
+
+		intSetting("lockout.threshold", "LOCKOUT_THRESHOLD", "consecutive wrong passwords or MFA codes that lock an account, 0 disables lockout", &c.Lockout.Threshold),
+		durationSetting("lockout.base", "LOCKOUT_BASE", "length of the first lock", &c.Lockout.Base),
+		durationSetting("lockout.max", "LOCKOUT_MAX", "longest lock", &c.Lockout.Max),
+
+		stringSetting("tracing.exporter", "TRACING_EXPORTER", "where spans are exported: none, stdout or otlp", &c.Tracing.Exporter),
+		stringSetting("tracing.otlp_endpoint", "OTLP_TRACES_ENDPOINT", "OTLP/HTTP collector URL", &c.Tracing.OTLPEndpoint),
+		stringSetting("tracing.service_name", "OTEL_SERVICE_NAME", "service name reported on spans", &c.Tracing.ServiceName),
+
+		stringSetting("log.level", "LOG_LEVEL", "minimum log level: debug, info, warn or error", &c.Log.Level),
+	}
+}
+
+// Load builds the configuration from the defaults, the file named by --config or CONFIG_FILE, the
+// environment and args, in that order, and validates the result. args excludes the program name.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// flags are parsed first to find the config file but applied last
+	type flagged struct {
+		s     setting
+		value string
+	}
+	var fromFlags []flagged
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "YAML or TOML config file")
+	for _, s := range settings {
+		record := func(v string) error {
+			fromFlags = append(fromFlags, flagged{s, v})
+			return nil
+		}
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		if s.bool {
+			fs.BoolFunc(s.flagName(), usage, func(v string) error { return record(v) })
+		} else {
+			fs.Func(s.flagName(), usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected arguments %v", fs.Args())
+	}
+
+	var errs []error
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				delete(values, s.key)
+				if err := s.set(v); err != nil {
+					errs = append(errs, fmt.Errorf("%s (from %s): %w", s.key, *configFile, err))
+				}
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			errs = append(errs, fmt.Errorf("%s (from %s): unknown setting", key, *configFile))
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s (from env %s): %w", s.key, s.env, err))
+			}
+		}
+	}
+	for _, f := range fromFlags {
+		if err := f.s.set(f.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (from flag --%s): %w", f.s.key, f.s.flagName(), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("config:\n%w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML file, chosen by extension, into a flat map of dotted keys.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).Decode(&tree)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]string{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, out map[string]string) {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]any); ok {
+			flatten(key, sub, out)
+			continue
+		}
+		// lists become the comma separated form listSetting reads
+		if list, ok := v.([]any); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+			continue
+		}
+		out[key] = fmt.Sprint(v)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -23,32 +23,74 @@ type Tx interface {
 
 type DB interface {
 	Conn
-	Begin(ctx context.Context) (Tx, error)
+	// BeginTx starts a transaction. Most callers want RunInTx instead, which carries the transaction on
+	// the context so that repositories built on the DB join it.
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (Tx, error)
 	GetPool() *pgxpool.Pool
 }
 
+// pool is the part of a *pgxpool.Pool that pgxDB uses.
+type pool interface {
+	Conn
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// pgxDB runs each query on the transaction carried by its context, if there is one, and on the pool
+// otherwise.
 type pgxDB struct {
-	*pgxpool.Pool
+	pool pool
+	// pgxPool is the pool behind pool. Tests replace pool with a mock and leave it nil.
+	pgxPool *pgxpool.Pool
 }
 
 func NewPostgresDB(connString string, maxConns int, maxConnIdleTime time.Duration) (DB, error) {
-	pool, err := pgxpool.Connect(context.Background(), connString)
-	pool.Config().MaxConnIdleTime = maxConnIdleTime
-	pool.Config().MaxConns = int32(maxConns)
+	config, err := poolConfig(connString, maxConns, maxConnIdleTime)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return &pgxDB{pool: pool, pgxPool: pool}, nil
+}
+
+// poolConfig parses connString and applies the pool limits. They must be set before the pool is created:
+// pgxpool.Pool.Config returns a copy, so changing it afterwards has no effect.
+func poolConfig(connString string, maxConns int, maxConnIdleTime time.Duration) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, err
 	}
-	return &pgxDB{pool}, nil
+	config.MaxConns = int32(maxConns)
+	config.MaxConnIdleTime = maxConnIdleTime
+	return config, nil
+}
+
+// conn is the transaction in ctx, or the pool.
+func (p *pgxDB) conn(ctx context.Context) Conn {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx.tx
+	}
+	return p.pool
+}
+
+func (p *pgxDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return p.conn(ctx).QueryRow(ctx, sql, args...)
+}
+
+func (p *pgxDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return p.conn(ctx).Query(ctx, sql, args...)
 }
 
-func (p *pgxDB) Begin(ctx context.Context) (Tx, error) {
-	return p.Pool.Begin(ctx)
+func (p *pgxDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return p.conn(ctx).Exec(ctx, sql, args...)
 }
 
-func (p *pgxDB) Config() *pgxpool.Config {
-	return p.Pool.Config()
+func (p *pgxDB) BeginTx(ctx context.Context, opts pgx.TxOptions) (Tx, error) {
+	return p.pool.BeginTx(ctx, opts)
 }
 
 func (p *pgxDB) GetPool() *pgxpool.Pool {
-	return p.Pool
+	return p.pgxPool
 }
@@ -0,0 +1,55 @@
+package dal
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type EmailVerificationRepo struct {
+	conn Conn
+}
+
+func NewEmailVerificationRepository(conn Conn) repo.EmailVerificationRepository {
+	return &EmailVerificationRepo{conn: conn}
+}
+
+func (r *EmailVerificationRepo) Create(ctx context.Context, t *model.EmailVerificationToken) error {
+	const sql = `
+INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at;
+`
+	row := r.conn.QueryRow(ctx, sql, t.UserId, t.Email, t.TokenHash, t.ExpiresAt)
+	return translate(row.Scan(&t.Id, &t.CreatedAt))
+}
+
+func (r *EmailVerificationRepo) FindByHash(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error) {
+	const sql = `
+SELECT id, user_id, email, token_hash, expires_at, used_at, created_at
+  FROM email_verification_tokens
+WHERE token_hash = $1;
+`
+	t := &model.EmailVerificationToken{}
+	err := r.conn.QueryRow(ctx, sql, tokenHash).
+		Scan(&t.Id, &t.UserId, &t.Email, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return t, nil
+}
+
+func (r *EmailVerificationRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	const sql = `
+UPDATE email_verification_tokens
+   SET used_at = now()
+ WHERE id = $1
+   AND used_at IS NULL;
+`
+	cmd, err := r.conn.Exec(ctx, sql, id)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
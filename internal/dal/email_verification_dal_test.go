@@ -0,0 +1,86 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestEmailVerificationRepo_Create(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewEmailVerificationRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	token := &model.EmailVerificationToken{UserId: 1, Email: "a@example.com", TokenHash: "hash-1", ExpiresAt: now.Add(time.Hour)}
+
+	mockPool.
+		ExpectQuery(`INSERT INTO email_verification_tokens.*RETURNING id, created_at`).
+		WithArgs(token.UserId, token.Email, token.TokenHash, token.ExpiresAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), now))
+
+	assert.NoError(t, repo.Create(context.Background(), token))
+	assert.Equal(t, int64(7), token.Id)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestEmailVerificationRepo_FindByHash(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewEmailVerificationRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+
+	mockPool.
+		ExpectQuery(`SELECT id, user_id, email, token_hash, expires_at, used_at, created_at\s+FROM email_verification_tokens`).
+		WithArgs("hash-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "email", "token_hash", "expires_at", "used_at", "created_at"}).
+			AddRow(int64(7), int64(1), "a@example.com", "hash-1", now, nil, now))
+	got, err := repo.FindByHash(context.Background(), "hash-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.EmailVerificationToken{
+		Id: 7, UserId: 1, Email: "a@example.com", TokenHash: "hash-1", ExpiresAt: now, CreatedAt: now,
+	}, got)
+
+	mockPool.
+		ExpectQuery(`SELECT id, user_id, email, token_hash`).
+		WithArgs("hash-missing").
+		WillReturnError(pgx.ErrNoRows)
+	got, err = repo.FindByHash(context.Background(), "hash-missing")
+	assert.Error(t, err)
+	assert.Nil(t, got)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestEmailVerificationRepo_MarkUsed(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewEmailVerificationRepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE email_verification_tokens\s+SET used_at = now\(\)`).
+		WithArgs(int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.
+		ExpectExec(`UPDATE email_verification_tokens\s+SET used_at = now\(\)`).
+		WithArgs(int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	used, err := repo.MarkUsed(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = repo.MarkUsed(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.False(t, used)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
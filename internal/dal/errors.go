@@ -0,0 +1,47 @@
+package dal
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// SQLSTATE codes translate recognises.
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeExclusionViolation  = "23P01"
+	codeCheckViolation      = "23514"
+	codeNotNullViolation    = "23502"
+	codeInvalidText         = "22P02"
+	codeStringTooLong       = "22001"
+	codeNumericOutOfRange   = "22003"
+	codeInvalidDatetime     = "22007"
+	codeDatetimeOutOfRange  = "22008"
+)
+
+// translate maps driver errors onto the repo errors, keeping the original as the cause. Errors it does not
+// recognise, such as a lost connection, are returned unchanged.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repo.ErrNotFound.Wrap(err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case codeUniqueViolation, codeForeignKeyViolation, codeExclusionViolation:
+		return repo.ErrConflict.Wrap(err)
+	case codeCheckViolation, codeNotNullViolation, codeInvalidText, codeStringTooLong, codeNumericOutOfRange,
+		codeInvalidDatetime, codeDatetimeOutOfRange:
+		return repo.ErrInvalid.Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+package dal
+
+// NewMockDB wraps a pgxmock pool the way NewPostgresDB wraps a real one.
+func NewMockDB(p pool) DB {
+	return &pgxDB{pool: p}
+}
+
+// PoolConfig is the configuration NewPostgresDB connects with.
+var PoolConfig = poolConfig
@@ -0,0 +1,104 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/health"
+)
+
+// SchemaVersion is the migration the code expects the database to be at. Bump it with every new migration
+// in db/migrations.
+const SchemaVersion int64 = 20250712093025
+
+// PingCheck reports whether a connection can be acquired from the pool and round-trip to Postgres.
+func PingCheck(db DB) health.Check {
+	return func(ctx context.Context) (any, error) {
+		return nil, db.GetPool().Ping(ctx)
+	}
+}
+
+var errNoMigrations = errors.New("no migrations applied")
+
+// schemaVersion reads the migration version recorded by golang-migrate.
+func schemaVersion(ctx context.Context, conn Conn) (version int64, dirty bool, err error) {
+	const sql = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+	err = conn.QueryRow(ctx, sql).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, errNoMigrations
+	}
+	return version, dirty, err
+}
+
+// SchemaCheck reports the migration version recorded by golang-migrate. Like RequireSchema it fails only
+// when the schema is behind want or dirty, so replicas of the previous release stay ready once a newer one
+// has migrated the database.
+func SchemaCheck(conn Conn, want int64) health.Check {
+	return func(ctx context.Context) (any, error) {
+		version, dirty, err := schemaVersion(ctx, conn)
+		if errors.Is(err, errNoMigrations) {
+			return map[string]any{"want": want}, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		detail := map[string]any{"version": version, "want": want, "dirty": dirty}
+		if dirty {
+			return detail, fmt.Errorf("migration %d is dirty", version)
+		}
+		if version < want {
+			return detail, fmt.Errorf("schema is at version %d, behind %d", version, want)
+		}
+		return detail, nil
+	}
+}
+
+// RequireSchema fails when the database is behind want or a migration is dirty, since the code would run
+// queries against tables or columns that do not exist yet. A newer schema is accepted: migrations are
+// backwards compatible so the previous release keeps serving during a rollout.
+func RequireSchema(ctx context.Context, conn Conn, want int64) error {
+	version, dirty, err := schemaVersion(ctx, conn)
+	if errors.Is(err, errNoMigrations) {
+		return fmt.Errorf("%w; run `server migrate up` or enable database.auto_migrate", err)
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty; repair it by hand, then run `server migrate force VERSION`", version)
+	}
+	if version < want {
+		return fmt.Errorf("schema is at version %d, behind %d; run `server migrate up` or enable database.auto_migrate", version, want)
+	}
+	return nil
+}
+
+// PoolStats describes how busy the connection pool is. Saturation is the share of MaxConns currently
+// acquired; at 1 new queries wait for a connection to be released.
+type PoolStats struct {
+	Acquired   int32   `json:"acquired"`
+	Idle       int32   `json:"idle"`
+	Total      int32   `json:"total"`
+	Max        int32   `json:"max"`
+	Saturation float64 `json:"saturation"`
+}
+
+// PoolCheck reports pool saturation. It never fails: a busy pool still serves requests, just more slowly.
+func PoolCheck(db DB) health.Check {
+	return func(ctx context.Context) (any, error) {
+		stat := db.GetPool().Stat()
+		stats := PoolStats{
+			Acquired: stat.AcquiredConns(),
+			Idle:     stat.IdleConns(),
+			Total:    stat.TotalConns(),
+			Max:      stat.MaxConns(),
+		}
+		if stats.Max > 0 {
+			stats.Saturation = float64(stats.Acquired) / float64(stats.Max)
+		}
+		return stats, nil
+	}
+}
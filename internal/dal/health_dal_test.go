@@ -0,0 +1,161 @@
+package dal_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func TestNewPostgresDB_AppliesPoolLimits(t *testing.T) {
+	config, err := dal.PoolConfig("postgres://user@127.0.0.1:1/db", 7, 90*time.Second)
+	require.NoError(t, err)
+	// nothing listens on the port, so connect on first use rather than now
+	config.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	require.NoError(t, err)
+	defer pool.Close()
+	assert.Equal(t, int32(7), pool.Stat().MaxConns())
+	assert.Equal(t, 90*time.Second, pool.Config().MaxConnIdleTime)
+
+	_, err = dal.PoolConfig("not a url", 7, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestSchemaVersion_MatchesLatestMigration(t *testing.T) {
+	files, err := filepath.Glob("../../db/migrations/*.up.sql")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+	sort.Strings(files)
+	latest, _, _ := strings.Cut(filepath.Base(files[len(files)-1]), "_")
+	version, err := strconv.ParseInt(latest, 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, version, dal.SchemaVersion)
+}
+
+func TestEmbeddedVersions_MatchMigrationFiles(t *testing.T) {
+	files, err := filepath.Glob("../../db/migrations/*.up.sql")
+	assert.NoError(t, err)
+	versions, err := dal.EmbeddedVersions()
+	assert.NoError(t, err)
+	assert.Len(t, versions, len(files), "every migration file is embedded")
+	assert.True(t, sort.SliceIsSorted(versions, func(i, j int) bool { return versions[i] < versions[j] }))
+	assert.Equal(t, dal.SchemaVersion, versions[len(versions)-1])
+}
+
+func TestRequireSchema(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	row := func(version int64, dirty bool) func() {
+		return func() {
+			mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+				WillReturnRows(pgxmock.NewRows([]string{"version", "dirty"}).AddRow(version, dirty))
+		}
+	}
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantErr   string
+	}{
+		{name: "current", mockSetup: row(5, false)},
+		{name: "ahead during a rollout", mockSetup: row(6, false)},
+		{name: "behind", mockSetup: row(4, false), wantErr: "schema is at version 4, behind 5"},
+		{name: "dirty", mockSetup: row(5, true), wantErr: "migration 5 is dirty"},
+		{
+			name: "empty",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: "no migrations applied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			err := dal.RequireSchema(context.Background(), mockPool, 5)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	check := dal.SchemaCheck(mockPool, 5)
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		wantErr   string
+	}{
+		{
+			name: "current",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(pgxmock.NewRows([]string{"version", "dirty"}).AddRow(int64(5), false))
+			},
+		},
+		{
+			name: "behind",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(pgxmock.NewRows([]string{"version", "dirty"}).AddRow(int64(4), false))
+			},
+			wantErr: "schema is at version 4, behind 5",
+		},
+		{
+			name: "newer",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(pgxmock.NewRows([]string{"version", "dirty"}).AddRow(int64(6), false))
+			},
+		},
+		{
+			name: "dirty",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(pgxmock.NewRows([]string{"version", "dirty"}).AddRow(int64(5), true))
+			},
+			wantErr: "migration 5 is dirty",
+		},
+		{
+			name: "empty",
+			mockSetup: func() {
+				mockPool.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: "no migrations applied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			_, err := check(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type MFARepo struct {
+	conn Conn
+}
+
+func NewMFARepository(conn Conn) repo.MFARepository {
+	return &MFARepo{conn: conn}
+}
+
+func (r *MFARepo) Upsert(ctx context.Context, m *model.UserMFA) error {
+	const sql = `
+INSERT INTO user_mfa (user_id, secret_ciphertext)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+   SET secret_ciphertext = EXCLUDED.secret_ciphertext,
+       confirmed_at      = NULL,
+       last_used_step    = NULL,
+       created_at        = now()
+ WHERE user_mfa.confirmed_at IS NULL
+RETURNING created_at;
+`
+	return translate(r.conn.QueryRow(ctx, sql, m.UserId, m.SecretCiphertext).Scan(&m.CreatedAt))
+}
+
+func (r *MFARepo) FindByUserId(ctx context.Context, userId int64) (*model.UserMFA, error) {
+	const sql = `
+SELECT user_id, secret_ciphertext, confirmed_at, last_used_step, created_at
+  FROM user_mfa
+WHERE user_id = $1;
+`
+	m := &model.UserMFA{}
+	err := r.conn.QueryRow(ctx, sql, userId).
+		Scan(&m.UserId, &m.SecretCiphertext, &m.ConfirmedAt, &m.LastUsedStep, &m.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, translate(err)
+	}
+	return m, nil
+}
+
+func (r *MFARepo) Confirm(ctx context.Context, userId int64) error {
+	const sql = `
+UPDATE user_mfa
+   SET confirmed_at = now()
+ WHERE user_id = $1
+   AND confirmed_at IS NULL;
+`
+	cmd, err := r.conn.Exec(ctx, sql, userId)
+	if err != nil {
+		return translate(err)
+	}
+	if cmd.RowsAffected() != 1 {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no pending mfa enrollment for user_id=%d", userId))
+	}
+	return nil
+}
+
+func (r *MFARepo) UseStep(ctx context.Context, userId int64, step int64) (bool, error) {
+	const sql = `
+UPDATE user_mfa
+   SET last_used_step = $2
+ WHERE user_id = $1
+   AND (last_used_step IS NULL OR last_used_step < $2);
+`
+	cmd, err := r.conn.Exec(ctx, sql, userId, step)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+func (r *MFARepo) ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error {
+	const sql = `
+WITH discarded AS (
+  DELETE FROM mfa_recovery_codes WHERE user_id = $1
+)
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+SELECT $1, unnest($2::text[]);
+`
+	_, err := r.conn.Exec(ctx, sql, userId, codeHashes)
+	return translate(err)
+}
+
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error) {
+	const sql = `
+UPDATE mfa_recovery_codes
+   SET used_at = now()
+ WHERE user_id = $1
+   AND code_hash = $2
+   AND used_at IS NULL;
+`
+	cmd, err := r.conn.Exec(ctx, sql, userId, codeHash)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
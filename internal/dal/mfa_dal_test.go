@@ -0,0 +1,174 @@
+package dal_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestMFARepo_Upsert(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewMFARepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	m := &model.UserMFA{UserId: 1, SecretCiphertext: []byte("sealed")}
+
+	mockPool.
+		ExpectQuery(`INSERT INTO user_mfa.*ON CONFLICT \(user_id\) DO UPDATE.*WHERE user_mfa.confirmed_at IS NULL`).
+		WithArgs(m.UserId, m.SecretCiphertext).
+		WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	assert.NoError(t, repo.Upsert(context.Background(), m))
+	assert.Equal(t, now, m.CreatedAt)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestMFARepo_FindByUserId(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewMFARepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		want      *model.UserMFA
+		wantErr   bool
+	}{
+		{
+			name: "found",
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`SELECT user_id, secret_ciphertext, confirmed_at, last_used_step, created_at\s+FROM user_mfa`).
+					WithArgs(int64(1)).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "secret_ciphertext", "confirmed_at", "last_used_step", "created_at"}).
+						AddRow(int64(1), []byte("sealed"), nil, nil, now))
+			},
+			want: &model.UserMFA{UserId: 1, SecretCiphertext: []byte("sealed"), CreatedAt: now},
+		},
+		{
+			name: "not enrolled",
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`SELECT user_id, secret_ciphertext`).
+					WithArgs(int64(1)).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			want: nil,
+		},
+		{
+			name: "query error",
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`SELECT user_id, secret_ciphertext`).
+					WithArgs(int64(1)).
+					WillReturnError(fmt.Errorf("db failure"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			got, err := repo.FindByUserId(context.Background(), 1)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMFARepo_Confirm(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewMFARepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE user_mfa\s+SET confirmed_at = now\(\)`).
+		WithArgs(int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.
+		ExpectExec(`UPDATE user_mfa\s+SET confirmed_at = now\(\)`).
+		WithArgs(int64(2)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	assert.NoError(t, repo.Confirm(context.Background(), 1))
+	err = repo.Confirm(context.Background(), 2)
+	assert.ErrorContains(t, err, "no pending mfa enrollment for user_id=2")
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestMFARepo_UseStep(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewMFARepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE user_mfa\s+SET last_used_step = \$2`).
+		WithArgs(int64(1), int64(100)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.
+		ExpectExec(`UPDATE user_mfa\s+SET last_used_step = \$2`).
+		WithArgs(int64(1), int64(100)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	fresh, err := repo.UseStep(context.Background(), 1, 100)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = repo.UseStep(context.Background(), 1, 100)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestMFARepo_RecoveryCodes(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewMFARepository(mockPool)
+	hashes := []string{"h1", "h2"}
+	mockPool.
+		ExpectExec(`DELETE FROM mfa_recovery_codes WHERE user_id = \$1.*INSERT INTO mfa_recovery_codes`).
+		WithArgs(int64(1), hashes).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mockPool.
+		ExpectExec(`UPDATE mfa_recovery_codes\s+SET used_at = now\(\)`).
+		WithArgs(int64(1), "h1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.
+		ExpectExec(`UPDATE mfa_recovery_codes\s+SET used_at = now\(\)`).
+		WithArgs(int64(1), "h1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	assert.NoError(t, repo.ReplaceRecoveryCodes(context.Background(), 1, hashes))
+	used, err := repo.UseRecoveryCode(context.Background(), 1, "h1")
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = repo.UseRecoveryCode(context.Background(), 1, "h1")
+	assert.NoError(t, err)
+	assert.False(t, used)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,127 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/jackc/pgx/v4/stdlib"
+
+	"github.com/thornhall/simple-go-service/db/migrations"
+)
+
+// migrateLockTimeout bounds how long a migration waits for another process, e.g. a replica starting at the
+// same time, to finish its own.
+const migrateLockTimeout = 5 * time.Minute
+
+// Migrator applies the migrations embedded in the binary. Every command holds golang-migrate's Postgres
+// advisory lock while it runs, so replicas migrating at startup take turns and all but the first find
+// nothing left to do.
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// MigrationStatus is where the database stands relative to the embedded migrations.
+type MigrationStatus struct {
+	// Version is the last migration applied, 0 when there is none.
+	Version int64
+	Dirty   bool
+	// Pending are the embedded migrations newer than Version, oldest first.
+	Pending []int64
+}
+
+func NewMigrator(dsn string) (*Migrator, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+	m.LockTimeout = migrateLockTimeout
+	return &Migrator{m: m}, nil
+}
+
+// Up applies every pending migration. Having none is not an error.
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down() error {
+	return m.m.Steps(-1)
+}
+
+// Force records version as applied and clean without running anything. It is how a dirty database is
+// recovered once the failed migration has been fixed by hand.
+func (m *Migrator) Force(version int64) error {
+	return m.m.Force(int(version))
+}
+
+func (m *Migrator) Status() (MigrationStatus, error) {
+	version, dirty, err := m.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{}, err
+	}
+	status := MigrationStatus{Version: int64(version), Dirty: dirty}
+	available, err := EmbeddedVersions()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	for _, v := range available {
+		if v > status.Version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	return status, nil
+}
+
+// Close releases the migrator's database connection.
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// EmbeddedVersions lists the versions of the embedded migrations, oldest first.
+func EmbeddedVersions() ([]int64, error) {
+	files, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(files))
+	for _, name := range files {
+		prefix, _, _ := strings.Cut(name, "_")
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	// fs.Glob sorts by name and versions are fixed-width timestamps
+	return versions, nil
+}
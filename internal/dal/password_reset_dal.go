@@ -0,0 +1,55 @@
+package dal
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type PasswordResetRepo struct {
+	conn Conn
+}
+
+func NewPasswordResetRepository(conn Conn) repo.PasswordResetRepository {
+	return &PasswordResetRepo{conn: conn}
+}
+
+func (r *PasswordResetRepo) Create(ctx context.Context, t *model.PasswordResetToken) error {
+	const sql = `
+INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id, created_at;
+`
+	row := r.conn.QueryRow(ctx, sql, t.UserId, t.TokenHash, t.ExpiresAt)
+	return translate(row.Scan(&t.Id, &t.CreatedAt))
+}
+
+func (r *PasswordResetRepo) FindByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	const sql = `
+SELECT id, user_id, token_hash, expires_at, used_at, created_at
+  FROM password_reset_tokens
+WHERE token_hash = $1;
+`
+	t := &model.PasswordResetToken{}
+	err := r.conn.QueryRow(ctx, sql, tokenHash).
+		Scan(&t.Id, &t.UserId, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return t, nil
+}
+
+func (r *PasswordResetRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	const sql = `
+UPDATE password_reset_tokens
+   SET used_at = now()
+ WHERE id = $1
+   AND used_at IS NULL;
+`
+	cmd, err := r.conn.Exec(ctx, sql, id)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
@@ -0,0 +1,84 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestPasswordResetRepo_Create(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewPasswordResetRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	token := &model.PasswordResetToken{UserId: 1, TokenHash: "hash-1", ExpiresAt: now.Add(time.Hour)}
+
+	mockPool.
+		ExpectQuery(`INSERT INTO password_reset_tokens.*RETURNING id, created_at`).
+		WithArgs(token.UserId, token.TokenHash, token.ExpiresAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(5), now))
+
+	assert.NoError(t, repo.Create(context.Background(), token))
+	assert.Equal(t, int64(5), token.Id)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPasswordResetRepo_FindByHash(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewPasswordResetRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+
+	mockPool.
+		ExpectQuery(`SELECT id, user_id, token_hash, expires_at, used_at, created_at\s+FROM password_reset_tokens`).
+		WithArgs("hash-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"}).
+			AddRow(int64(5), int64(1), "hash-1", now, nil, now))
+	got, err := repo.FindByHash(context.Background(), "hash-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.PasswordResetToken{Id: 5, UserId: 1, TokenHash: "hash-1", ExpiresAt: now, CreatedAt: now}, got)
+
+	mockPool.
+		ExpectQuery(`SELECT id, user_id, token_hash`).
+		WithArgs("hash-missing").
+		WillReturnError(pgx.ErrNoRows)
+	got, err = repo.FindByHash(context.Background(), "hash-missing")
+	assert.Error(t, err)
+	assert.Nil(t, got)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestPasswordResetRepo_MarkUsed(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewPasswordResetRepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE password_reset_tokens\s+SET used_at = now\(\)`).
+		WithArgs(int64(5)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.
+		ExpectExec(`UPDATE password_reset_tokens\s+SET used_at = now\(\)`).
+		WithArgs(int64(5)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	used, err := repo.MarkUsed(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = repo.MarkUsed(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.False(t, used)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
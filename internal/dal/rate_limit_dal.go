@@ -0,0 +1,67 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RateLimitRepo struct {
+	conn Conn
+}
+
+func NewRateLimitRepository(conn Conn) repo.RateLimitRepository {
+	return &RateLimitRepo{conn: conn}
+}
+
+// Take refills and debits the bucket in a single upsert, so concurrent requests on any replica never take
+// the same token twice. An empty bucket is left untouched and a second query works out the wait.
+func (r *RateLimitRepo) Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error) {
+	const sql = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at)
+VALUES ($1, $2::float8 - 1, now())
+ON CONFLICT (key) DO UPDATE
+   SET tokens     = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) / $3::float8) - 1,
+       updated_at = now()
+ WHERE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) / $3::float8) >= 1
+RETURNING tokens;
+`
+	seconds := interval.Seconds()
+	var tokens float64
+	err := r.conn.QueryRow(ctx, sql, key, burst, seconds).Scan(&tokens)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, translate(err)
+	}
+
+	const waitSQL = `
+SELECT (1 - LEAST($2::float8, tokens + EXTRACT(EPOCH FROM now() - updated_at) / $3::float8)) * $3::float8
+  FROM rate_limit_buckets
+WHERE key = $1;
+`
+	var wait float64
+	if err := r.conn.QueryRow(ctx, waitSQL, key, burst, seconds).Scan(&wait); err != nil {
+		return 0, translate(err)
+	}
+	// the bucket may have refilled between the two queries; the caller still did not get a token
+	return max(time.Duration(wait*float64(time.Second)), time.Millisecond), nil
+}
+
+func (r *RateLimitRepo) Prune(ctx context.Context, prefix string, before time.Time) (int64, error) {
+	const sql = `
+DELETE FROM rate_limit_buckets
+ WHERE starts_with(key, $1)
+   AND updated_at < $2;
+`
+	cmd, err := r.conn.Exec(ctx, sql, prefix, before)
+	if err != nil {
+		return 0, translate(err)
+	}
+	return cmd.RowsAffected(), nil
+}
@@ -0,0 +1,93 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func TestRateLimitRepo_Take(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRateLimitRepository(mockPool)
+
+	mockPool.
+		ExpectQuery(`INSERT INTO rate_limit_buckets AS b.*ON CONFLICT \(key\) DO UPDATE.*WHERE LEAST.*>= 1\s+RETURNING tokens`).
+		WithArgs("login:a", 5, 2.0).
+		WillReturnRows(pgxmock.NewRows([]string{"tokens"}).AddRow(4.0))
+	wait, err := repo.Take(context.Background(), "login:a", 5, 2*time.Second)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// an empty bucket is not updated, so the upsert returns nothing and the wait is looked up
+	mockPool.
+		ExpectQuery(`INSERT INTO rate_limit_buckets`).
+		WithArgs("login:a", 5, 2.0).
+		WillReturnError(pgx.ErrNoRows)
+	mockPool.
+		ExpectQuery(`SELECT \(1 - LEAST.*FROM rate_limit_buckets\s+WHERE key = \$1`).
+		WithArgs("login:a", 5, 2.0).
+		WillReturnRows(pgxmock.NewRows([]string{"wait"}).AddRow(1.5))
+	wait, err = repo.Take(context.Background(), "login:a", 5, 2*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, wait)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRateLimitRepo_Prune(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRateLimitRepository(mockPool)
+	before := time.Now()
+
+	mockPool.
+		ExpectExec(`DELETE FROM rate_limit_buckets\s+WHERE starts_with\(key, \$1\)\s+AND updated_at < \$2`).
+		WithArgs("login:", before).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	n, err := repo.Prune(context.Background(), "login:", before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRateLimitRepo_TranslatesErrors(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRateLimitRepository(mockPool)
+
+	// a key longer than the column allows is invalid input
+	mockPool.ExpectQuery(`INSERT INTO rate_limit_buckets`).
+		WillReturnError(&pgconn.PgError{Code: "22001"})
+	_, err = repo.Take(context.Background(), "login:a", 5, 2*time.Second)
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+	var pgErr *pgconn.PgError
+	assert.ErrorAs(t, err, &pgErr, "the driver error stays reachable as the cause")
+
+	// the bucket was pruned between the two queries
+	mockPool.ExpectQuery(`INSERT INTO rate_limit_buckets`).WillReturnError(pgx.ErrNoRows)
+	mockPool.ExpectQuery(`SELECT .* FROM rate_limit_buckets`).WillReturnError(pgx.ErrNoRows)
+	_, err = repo.Take(context.Background(), "login:a", 5, 2*time.Second)
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+
+	mockPool.ExpectExec(`DELETE FROM rate_limit_buckets`).
+		WillReturnError(&pgconn.PgError{Code: "22001"})
+	_, err = repo.Prune(context.Background(), "login:", time.Now())
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,80 @@
+package dal
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RefreshTokenRepo struct {
+	conn Conn
+}
+
+func NewRefreshTokenRepository(conn Conn) repo.RefreshTokenRepository {
+	return &RefreshTokenRepo{conn: conn}
+}
+
+func (r *RefreshTokenRepo) Create(ctx context.Context, t *model.RefreshToken) error {
+	const sql = `
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at;
+`
+	row := r.conn.QueryRow(ctx, sql,
+		t.UserId, t.FamilyId, t.TokenHash, t.ExpiresAt,
+	)
+	return translate(row.Scan(&t.Id, &t.CreatedAt))
+}
+
+func (r *RefreshTokenRepo) FindByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	const sql = `
+SELECT id, user_id, family_id, token_hash, expires_at, rotated_at, revoked_at, created_at
+  FROM refresh_tokens
+WHERE token_hash = $1;
+`
+	t := &model.RefreshToken{}
+	err := r.conn.QueryRow(ctx, sql, tokenHash).
+		Scan(&t.Id, &t.UserId, &t.FamilyId, &t.TokenHash, &t.ExpiresAt, &t.RotatedAt, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return t, nil
+}
+
+func (r *RefreshTokenRepo) MarkRotated(ctx context.Context, id int64) (bool, error) {
+	const sql = `
+UPDATE refresh_tokens
+   SET rotated_at = now()
+ WHERE id = $1
+   AND rotated_at IS NULL
+   AND revoked_at IS NULL;
+`
+	cmd, err := r.conn.Exec(ctx, sql, id)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyId string) error {
+	const sql = `
+UPDATE refresh_tokens
+   SET revoked_at = now()
+ WHERE family_id = $1
+   AND revoked_at IS NULL;
+`
+	_, err := r.conn.Exec(ctx, sql, familyId)
+	return translate(err)
+}
+
+func (r *RefreshTokenRepo) RevokeAllForUser(ctx context.Context, userId int64) error {
+	const sql = `
+UPDATE refresh_tokens
+   SET revoked_at = now()
+ WHERE user_id = $1
+   AND revoked_at IS NULL;
+`
+	_, err := r.conn.Exec(ctx, sql, userId)
+	return translate(err)
+}
@@ -0,0 +1,198 @@
+package dal_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestRefreshTokenRepo_Create(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRefreshTokenRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	token := &model.RefreshToken{
+		UserId:    1,
+		FamilyId:  "family-1",
+		TokenHash: "hash-1",
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	mockPool.
+		ExpectQuery(`INSERT INTO refresh_tokens.*RETURNING id, created_at`).
+		WithArgs(token.UserId, token.FamilyId, token.TokenHash, token.ExpiresAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(9), now))
+
+	assert.NoError(t, repo.Create(context.Background(), token))
+	assert.Equal(t, int64(9), token.Id)
+	assert.Equal(t, now, token.CreatedAt)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo_FindByHash(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRefreshTokenRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		hash      string
+		mockSetup func()
+		wantToken *model.RefreshToken
+		wantErr   bool
+	}{
+		{
+			name: "found",
+			hash: "hash-1",
+			mockSetup: func() {
+				rows := pgxmock.NewRows([]string{
+					"id", "user_id", "family_id", "token_hash", "expires_at", "rotated_at", "revoked_at", "created_at",
+				}).AddRow(int64(9), int64(1), "family-1", "hash-1", now, nil, nil, now)
+
+				mockPool.
+					ExpectQuery(`SELECT id, user_id, family_id, token_hash, expires_at, rotated_at, revoked_at, created_at`).
+					WithArgs("hash-1").
+					WillReturnRows(rows)
+			},
+			wantToken: &model.RefreshToken{
+				Id:        9,
+				UserId:    1,
+				FamilyId:  "family-1",
+				TokenHash: "hash-1",
+				ExpiresAt: now,
+				CreatedAt: now,
+			},
+		},
+		{
+			name: "not found",
+			hash: "hash-missing",
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`SELECT id, user_id, family_id, token_hash`).
+					WithArgs("hash-missing").
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			got, err := repo.FindByHash(context.Background(), tt.hash)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantToken, got)
+			}
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefreshTokenRepo_MarkRotated(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRefreshTokenRepository(mockPool)
+
+	tests := []struct {
+		name        string
+		mockSetup   func()
+		wantRotated bool
+		wantErr     bool
+	}{
+		{
+			name: "rotated",
+			mockSetup: func() {
+				mockPool.
+					ExpectExec(`UPDATE refresh_tokens\s+SET rotated_at = now\(\)`).
+					WithArgs(int64(9)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			wantRotated: true,
+		},
+		{
+			name: "already used",
+			mockSetup: func() {
+				mockPool.
+					ExpectExec(`UPDATE refresh_tokens\s+SET rotated_at = now\(\)`).
+					WithArgs(int64(9)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			wantRotated: false,
+		},
+		{
+			name: "exec error",
+			mockSetup: func() {
+				mockPool.
+					ExpectExec(`UPDATE refresh_tokens\s+SET rotated_at = now\(\)`).
+					WithArgs(int64(9)).
+					WillReturnError(fmt.Errorf("db failure"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			rotated, err := repo.MarkRotated(context.Background(), 9)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRotated, rotated)
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefreshTokenRepo_RevokeFamily(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRefreshTokenRepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE refresh_tokens\s+SET revoked_at = now\(\)\s+WHERE family_id = \$1`).
+		WithArgs("family-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+
+	assert.NoError(t, repo.RevokeFamily(context.Background(), "family-1"))
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo_RevokeAllForUser(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRefreshTokenRepository(mockPool)
+	mockPool.
+		ExpectExec(`UPDATE refresh_tokens\s+SET revoked_at = now\(\)\s+WHERE user_id = \$1`).
+		WithArgs(int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+
+	assert.NoError(t, repo.RevokeAllForUser(context.Background(), 1))
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,60 @@
+package dal
+
+import (
+	"context"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RevocationRepo struct {
+	conn Conn
+}
+
+func NewRevocationRepository(conn Conn) repo.RevocationRepository {
+	return &RevocationRepo{conn: conn}
+}
+
+func (r *RevocationRepo) Create(ctx context.Context, rev *model.TokenRevocation) error {
+	const sql = `
+INSERT INTO token_revocations (jti, user_id, revoked_before, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at;
+`
+	row := r.conn.QueryRow(ctx, sql,
+		rev.Jti, rev.UserId, rev.RevokedBefore, rev.ExpiresAt,
+	)
+	return translate(row.Scan(&rev.Id, &rev.CreatedAt))
+}
+
+func (r *RevocationRepo) ListSince(ctx context.Context, since time.Time) ([]*model.TokenRevocation, error) {
+	const sql = `
+SELECT id, jti, user_id, revoked_before, expires_at, created_at
+  FROM token_revocations
+WHERE created_at >= $1
+  AND expires_at > now()
+ORDER BY created_at, id;
+`
+	rows, err := r.conn.Query(ctx, sql, since)
+	if err != nil {
+		return nil, translate(err)
+	}
+	defer rows.Close()
+
+	var revocations []*model.TokenRevocation
+	for rows.Next() {
+		rev := &model.TokenRevocation{}
+		if err := rows.Scan(&rev.Id, &rev.Jti, &rev.UserId, &rev.RevokedBefore, &rev.ExpiresAt, &rev.CreatedAt); err != nil {
+			return nil, translate(err)
+		}
+		revocations = append(revocations, rev)
+	}
+	return revocations, rows.Err()
+}
+
+func (r *RevocationRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	const sql = `DELETE FROM token_revocations WHERE expires_at <= $1;`
+	_, err := r.conn.Exec(ctx, sql, now)
+	return translate(err)
+}
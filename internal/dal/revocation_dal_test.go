@@ -0,0 +1,111 @@
+package dal_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestRevocationRepo_Create(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRevocationRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	jti := "jti-1"
+	rev := &model.TokenRevocation{Jti: &jti, UserId: 1, ExpiresAt: now.Add(time.Hour)}
+
+	mockPool.
+		ExpectQuery(`INSERT INTO token_revocations.*RETURNING id, created_at`).
+		WithArgs(rev.Jti, rev.UserId, rev.RevokedBefore, rev.ExpiresAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(int64(3), now))
+
+	assert.NoError(t, repo.Create(context.Background(), rev))
+	assert.Equal(t, int64(3), rev.Id)
+	assert.Equal(t, now, rev.CreatedAt)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRevocationRepo_ListSince(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRevocationRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	since := now.Add(-time.Minute)
+	jti := "jti-1"
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		want      []*model.TokenRevocation
+		wantErr   bool
+	}{
+		{
+			name: "rows",
+			mockSetup: func() {
+				rows := pgxmock.NewRows([]string{"id", "jti", "user_id", "revoked_before", "expires_at", "created_at"}).
+					AddRow(int64(1), &jti, int64(1), nil, now.Add(time.Hour), now).
+					AddRow(int64(2), nil, int64(2), &now, now.Add(time.Hour), now)
+				mockPool.
+					ExpectQuery(`SELECT id, jti, user_id, revoked_before, expires_at, created_at\s+FROM token_revocations`).
+					WithArgs(since).
+					WillReturnRows(rows)
+			},
+			want: []*model.TokenRevocation{
+				{Id: 1, Jti: &jti, UserId: 1, ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+				{Id: 2, UserId: 2, RevokedBefore: &now, ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+			},
+		},
+		{
+			name: "query error",
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`SELECT id, jti, user_id, revoked_before, expires_at, created_at\s+FROM token_revocations`).
+					WithArgs(since).
+					WillReturnError(fmt.Errorf("db failure"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			got, err := repo.ListSince(context.Background(), since)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRevocationRepo_DeleteExpired(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRevocationRepository(mockPool)
+	now := time.Now()
+	mockPool.
+		ExpectExec(`DELETE FROM token_revocations WHERE expires_at <= \$1`).
+		WithArgs(now).
+		WillReturnResult(pgxmock.NewResult("DELETE", 4))
+
+	assert.NoError(t, repo.DeleteExpired(context.Background(), now))
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,87 @@
+package dal
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RoleRepo struct {
+	conn Conn
+}
+
+func NewRoleRepository(conn Conn) repo.RoleRepository {
+	return &RoleRepo{conn: conn}
+}
+
+func (r *RoleRepo) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	const sql = `
+SELECT r.name, p.name
+  FROM roles r
+  LEFT JOIN role_permissions rp ON rp.role_id = r.id
+  LEFT JOIN permissions p ON p.id = rp.permission_id
+ ORDER BY r.name, p.name;
+`
+	rows, err := r.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, translate(err)
+	}
+	defer rows.Close()
+
+	perms := map[string][]string{}
+	for rows.Next() {
+		var role string
+		var perm *string
+		if err := rows.Scan(&role, &perm); err != nil {
+			return nil, translate(err)
+		}
+		if perm == nil {
+			perms[role] = nil
+			continue
+		}
+		perms[role] = append(perms[role], *perm)
+	}
+	return perms, rows.Err()
+}
+
+func (r *RoleRepo) Grant(ctx context.Context, userId int64, role string) (bool, error) {
+	const sql = `
+WITH role AS (
+    SELECT id FROM roles WHERE name = $2
+), granted AS (
+    INSERT INTO user_roles (user_id, role_id)
+    SELECT $1, id FROM role
+    ON CONFLICT (user_id, role_id) DO NOTHING
+    RETURNING user_id
+), bumped AS (
+    UPDATE users SET version = version + 1
+     WHERE id IN (SELECT user_id FROM granted)
+)
+SELECT EXISTS (SELECT 1 FROM role);
+`
+	var exists bool
+	if err := r.conn.QueryRow(ctx, sql, userId, role).Scan(&exists); err != nil {
+		return false, translate(err)
+	}
+	return exists, nil
+}
+
+func (r *RoleRepo) Revoke(ctx context.Context, userId int64, role string) (bool, error) {
+	const sql = `
+WITH revoked AS (
+    DELETE FROM user_roles ur
+     USING roles r
+     WHERE r.id = ur.role_id
+       AND ur.user_id = $1
+       AND r.name = $2
+    RETURNING ur.user_id
+)
+UPDATE users SET version = version + 1
+ WHERE id IN (SELECT user_id FROM revoked);
+`
+	cmd, err := r.conn.Exec(ctx, sql, userId, role)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
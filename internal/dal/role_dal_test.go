@@ -0,0 +1,97 @@
+package dal_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func TestRoleRepo_PermissionsByRole(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRoleRepository(mockPool)
+	admin, list, read := "users:delete", "users:list", "users:read"
+
+	mockPool.
+		ExpectQuery(`SELECT r.name, p.name\s+FROM roles r\s+LEFT JOIN role_permissions`).
+		WillReturnRows(pgxmock.NewRows([]string{"role", "permission"}).
+			AddRow("admin", &admin).
+			AddRow("support", &list).
+			AddRow("support", &read).
+			AddRow("user", nil))
+
+	perms, err := repo.PermissionsByRole(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"admin":   {"users:delete"},
+		"support": {"users:list", "users:read"},
+		"user":    nil,
+	}, perms)
+
+	mockPool.
+		ExpectQuery(`SELECT r.name, p.name`).
+		WillReturnError(fmt.Errorf("boom"))
+	_, err = repo.PermissionsByRole(context.Background())
+	assert.Error(t, err)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRoleRepo_Grant(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRoleRepository(mockPool)
+
+	mockPool.
+		ExpectQuery(`WITH role AS.*INSERT INTO user_roles.*ON CONFLICT \(user_id, role_id\) DO NOTHING.*SELECT EXISTS`).
+		WithArgs(int64(1), "support").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	ok, err := repo.Grant(context.Background(), 1, "support")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	mockPool.
+		ExpectQuery(`WITH role AS`).
+		WithArgs(int64(1), "wizard").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	ok, err = repo.Grant(context.Background(), 1, "wizard")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRoleRepo_Revoke(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewRoleRepository(mockPool)
+
+	mockPool.
+		ExpectExec(`DELETE FROM user_roles ur\s+USING roles r`).
+		WithArgs(int64(1), "support").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	ok, err := repo.Revoke(context.Background(), 1, "support")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	mockPool.
+		ExpectExec(`DELETE FROM user_roles`).
+		WithArgs(int64(1), "admin").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	ok, err = repo.Revoke(context.Background(), 1, "admin")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
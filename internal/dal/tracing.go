@@ -0,0 +1,196 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+const instrumentation = "github.com/thornhall/simple-go-service/internal/dal"
+
+// tracer looks the tracer up on every use rather than once, so it follows the current global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// NewTracedConn wraps conn so every query runs in a span and is logged to the request's logger. Spans and log
+// lines are named after the repository method that issued the query, e.g. UserRepo.FindByEmail, and spans
+// carry the SQL text and operation.
+func NewTracedConn(conn Conn) Conn {
+	return &tracedConn{conn: conn}
+}
+
+// NewTracedDB is NewTracedConn for a DB. Queries that join a transaction through their context go through
+// the DB and are traced like any other, so the transaction itself is returned unwrapped.
+func NewTracedDB(db DB) DB {
+	return &tracedDB{tracedConn: tracedConn{conn: db}, db: db}
+}
+
+type tracedConn struct {
+	conn Conn
+}
+
+func (c *tracedConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	q := startQuery(ctx, sql)
+	return &tracedRow{row: c.conn.QueryRow(q.ctx, sql, args...), query: q}
+}
+
+func (c *tracedConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	q := startQuery(ctx, sql)
+	rows, err := c.conn.Query(q.ctx, sql, args...)
+	if err != nil {
+		q.end(err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, query: q}, nil
+}
+
+func (c *tracedConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	q := startQuery(ctx, sql)
+	tag, err := c.conn.Exec(q.ctx, sql, args...)
+	if err == nil {
+		q.span.SetAttributes(attribute.Int64("db.response.rows_affected", tag.RowsAffected()))
+	}
+	q.end(err)
+	return tag, err
+}
+
+type tracedDB struct {
+	tracedConn
+	db DB
+}
+
+func (d *tracedDB) BeginTx(ctx context.Context, opts pgx.TxOptions) (Tx, error) {
+	return d.db.BeginTx(ctx, opts)
+}
+
+func (d *tracedDB) GetPool() *pgxpool.Pool {
+	return d.db.GetPool()
+}
+
+// tracedRow ends its query when the row is scanned, which is when QueryRow's error surfaces.
+type tracedRow struct {
+	row   pgx.Row
+	query *query
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	r.query.end(err)
+	return err
+}
+
+// tracedRows ends its query when the rows are closed.
+type tracedRows struct {
+	pgx.Rows
+	query *query
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.query.end(r.Rows.Err())
+}
+
+// query is one statement in flight.
+type query struct {
+	ctx   context.Context
+	span  trace.Span
+	name  string
+	start time.Time
+}
+
+func startQuery(ctx context.Context, sql string) *query {
+	// skip startQuery and the tracedConn method to reach the repository method
+	name := callerName(3)
+	ctx, span := tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation(sql)),
+			attribute.String("db.query.summary", name),
+			attribute.String("db.query.text", strings.Join(strings.Fields(sql), " ")),
+		),
+	)
+	return &query{ctx: ctx, span: span, name: name, start: time.Now()}
+}
+
+// end ends the span and logs the query, treating it as failed unless err is nil or just means no row
+// matched.
+func (q *query) end(err error) {
+	logger := logging.FromContext(q.ctx)
+	elapsed := float64(time.Since(q.start).Microseconds()) / 1000
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		q.span.RecordError(err)
+		q.span.SetStatus(codes.Error, err.Error())
+		logger.Warn("query failed", "query", q.name, "latency_ms", elapsed, "error", err)
+	} else {
+		logger.Debug("query", "query", q.name, "latency_ms", elapsed)
+	}
+	q.span.End()
+}
+
+// callerName returns the caller's function as Type.Method, dropping the package path and any closure
+// suffix. It falls back to "query" when the stack cannot be read.
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	fn := runtime.FuncForPC(pc)
+	if !ok || fn == nil {
+		return "query"
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// operation returns the statement's leading keyword, looking past a WITH clause to the statement it feeds.
+func operation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	op := strings.ToUpper(fields[0])
+	if op != "WITH" {
+		return op
+	}
+	// the main statement is the first one outside the parentheses of the common table expressions
+	var outside strings.Builder
+	depth := 0
+	for _, r := range sql {
+		switch {
+		case r == '(':
+			depth++
+			outside.WriteRune(' ')
+		case r == ')':
+			depth--
+			outside.WriteRune(' ')
+		case depth == 0:
+			outside.WriteRune(r)
+		}
+	}
+	for _, f := range strings.Fields(outside.String()) {
+		switch kw := strings.ToUpper(f); kw {
+		case "SELECT", "INSERT", "UPDATE", "DELETE":
+			return kw
+		}
+	}
+	return op
+}
@@ -0,0 +1,96 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracedConn_NamesSpansAfterRepositoryMethod(t *testing.T) {
+	recorder := recordSpans(t)
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+	repo := dal.NewRoleRepository(dal.NewTracedConn(mockPool))
+
+	mockPool.ExpectQuery(`WITH role AS`).
+		WithArgs(int64(1), "support").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	_, err = repo.Grant(context.Background(), 1, "support")
+	assert.NoError(t, err)
+
+	mockPool.ExpectQuery(`SELECT r.name, p.name`).
+		WillReturnRows(pgxmock.NewRows([]string{"role", "permission"}).AddRow("user", nil))
+	_, err = repo.PermissionsByRole(context.Background())
+	assert.NoError(t, err)
+
+	mockPool.ExpectExec(`DELETE FROM user_roles`).
+		WithArgs(int64(1), "support").
+		WillReturnError(errors.New("connection reset"))
+	_, err = repo.Revoke(context.Background(), 1, "support")
+	assert.Error(t, err)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	assert.Equal(t, "RoleRepo.Grant", spans[0].Name())
+	assert.Equal(t, "SELECT", spanAttr(spans[0], "db.operation.name"))
+	assert.Equal(t, "postgresql", spanAttr(spans[0], "db.system"))
+	assert.Contains(t, spanAttr(spans[0], "db.query.text"), "WITH role AS ( SELECT id FROM roles WHERE name = $2 )")
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "RoleRepo.PermissionsByRole", spans[1].Name())
+	assert.Equal(t, "SELECT", spanAttr(spans[1], "db.operation.name"))
+
+	assert.Equal(t, "RoleRepo.Revoke", spans[2].Name())
+	assert.Equal(t, "UPDATE", spanAttr(spans[2], "db.operation.name"))
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestTracedConn_NoRowsIsNotAnError(t *testing.T) {
+	recorder := recordSpans(t)
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+	repo := dal.NewUserRepository(dal.NewTracedConn(mockPool))
+
+	mockPool.ExpectQuery(`SELECT`).WithArgs("nobody@example.com").WillReturnError(pgx.ErrNoRows)
+	_, err = repo.FindByEmail(context.Background(), "nobody@example.com")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "UserRepo.FindByEmail", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
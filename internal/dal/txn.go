@@ -2,21 +2,153 @@ package dal
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
 
-	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// SQLSTATE codes that mean a transaction lost a race and may succeed if run again.
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+const (
+	defaultTxAttempts = 5
+	// txRetryBase and txRetryMax bound the backoff between attempts, which doubles after each one.
+	txRetryBase = 10 * time.Millisecond
+	txRetryMax  = 500 * time.Millisecond
 )
 
-// Run a group of operations inside of a Transaction. If any errors are returned, the transaction is rolled back.
-func RunInTx(ctx context.Context, db DB, fn func(ctx context.Context, conn Conn) (*model.UserResponse, error)) (*model.UserResponse, error) {
-	tx, err := db.Begin(ctx)
+// TxOptions configures RunInTx.
+type TxOptions struct {
+	// Isolation is the transaction's isolation level. Empty uses the server default, read committed.
+	Isolation pgx.TxIsoLevel
+	// MaxAttempts bounds how often the transaction runs when it keeps failing with a serialization failure
+	// or deadlock. Zero means 5.
+	MaxAttempts int
+}
+
+// txState is the transaction carried by a context. depth counts the savepoints nested inside it.
+type txState struct {
+	tx    Tx
+	depth int
+}
+
+type txKey struct{}
+
+func txFromContext(ctx context.Context) *txState {
+	tx, _ := ctx.Value(txKey{}).(*txState)
+	return tx
+}
+
+// RunInTx runs fn in a transaction and commits it if fn succeeds. Every query issued through a DB with the
+// context fn receives joins the transaction, so repositories need not know about it. fn must not use that
+// context from several goroutines at once.
+//
+// Serialization failures and deadlocks roll the transaction back and run fn again after a backoff, so fn
+// must be safe to repeat and should leave side effects such as sending mail until RunInTx returns.
+//
+// Called with a context that already carries a transaction, RunInTx runs fn in a savepoint of it instead:
+// if fn fails only its own writes are rolled back. The outer transaction's options apply and retries are
+// left to the outermost call, since a serialization failure dooms the whole transaction.
+func RunInTx[T any](ctx context.Context, db DB, opts TxOptions, fn func(ctx context.Context) (T, error)) (T, error) {
+	if outer := txFromContext(ctx); outer != nil {
+		return runInSavepoint(ctx, outer, fn)
+	}
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultTxAttempts
+	}
+	backoff := txRetryBase
+	for attempt := 1; ; attempt++ {
+		res, err := runTx(ctx, db, opts, fn)
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return res, err
+		}
+		// full jitter keeps transactions that collided from colliding again
+		wait := rand.N(backoff) + 1
+		logging.FromContext(ctx).Debug("retrying transaction", "attempt", attempt, "backoff_ms", wait.Milliseconds(), "error", err)
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, txRetryMax)
+	}
+}
+
+func runTx[T any](ctx context.Context, db DB, opts TxOptions, fn func(ctx context.Context) (T, error)) (_ T, err error) {
+	var zero T
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: opts.Isolation})
+	if err != nil {
+		return zero, translate(err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	res, err := fn(context.WithValue(ctx, txKey{}, &txState{tx: tx}))
 	if err != nil {
-		return nil, err
+		tx.Rollback(ctx)
+		return zero, err
 	}
-	defer tx.Rollback(ctx)
+	if err := tx.Commit(ctx); err != nil {
+		return zero, translate(err)
+	}
+	return res, nil
+}
 
-	res, err := fn(ctx, tx)
+func runInSavepoint[T any](ctx context.Context, outer *txState, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	inner := &txState{tx: outer.tx, depth: outer.depth + 1}
+	savepoint := fmt.Sprintf("sp_%d", inner.depth)
+	if _, err := outer.tx.Exec(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return zero, translate(err)
+	}
+	res, err := fn(context.WithValue(ctx, txKey{}, inner))
 	if err != nil {
-		return nil, err
+		if _, rbErr := outer.tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+			return zero, errors.Join(err, rbErr)
+		}
+		return zero, err
+	}
+	if _, err := outer.tx.Exec(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return zero, translate(err)
 	}
-	return res, tx.Commit(ctx)
+	return res, nil
+}
+
+// retryable reports whether err means the transaction lost a race with another one.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == codeSerializationFailure || pgErr.Code == codeDeadlockDetected)
+}
+
+type Transactor struct {
+	db   DB
+	opts TxOptions
+}
+
+// NewTransactor runs functions through RunInTx with opts, for services that only know the repo interfaces.
+func NewTransactor(db DB, opts TxOptions) repo.Transactor {
+	return &Transactor{db: db, opts: opts}
+}
+
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := RunInTx(ctx, t.db, t.opts, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
 }
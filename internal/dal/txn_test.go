@@ -0,0 +1,133 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func TestRunInTx_RepositoriesJoinTheTransaction(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+	db := dal.NewMockDB(mockPool)
+	users := dal.NewUserRepository(db)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+	mockPool.ExpectExec(`UPDATE users\s+SET password_hash`).WithArgs("hash", int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectCommit()
+
+	got, err := dal.RunInTx(context.Background(), db, dal.TxOptions{Isolation: pgx.Serializable},
+		func(ctx context.Context) (int, error) {
+			return 42, users.UpdatePassword(ctx, 7, "hash")
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 42, got)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRunInTx_RollsBackOnError(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+	db := dal.NewMockDB(mockPool)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectRollback()
+
+	errBoom := errors.New("boom")
+	calls := 0
+	_, err = dal.RunInTx(context.Background(), db, dal.TxOptions{}, func(ctx context.Context) (*int, error) {
+		calls++
+		return nil, errBoom
+	})
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, 1, calls, "ordinary errors are not retried")
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRunInTx_RetriesSerializationFailures(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+	db := dal.NewMockDB(mockPool)
+
+	// the first attempt fails in a query, the second at commit with a deadlock, the third succeeds
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectExec(`UPDATE users`).WillReturnError(&pgconn.PgError{Code: "40001"})
+	mockPool.ExpectRollback()
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectExec(`UPDATE users`).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectCommit().WillReturnError(&pgconn.PgError{Code: "40P01"})
+	mockPool.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	mockPool.ExpectExec(`UPDATE users`).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockPool.ExpectCommit()
+
+	calls := 0
+	_, err = dal.RunInTx(context.Background(), db, dal.TxOptions{Isolation: pgx.RepeatableRead},
+		func(ctx context.Context) (struct{}, error) {
+			calls++
+			return struct{}{}, dal.NewUserRepository(db).UpdatePassword(ctx, 1, "hash")
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRunInTx_GivesUpAfterMaxAttempts(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+	db := dal.NewMockDB(mockPool)
+
+	for range 2 {
+		mockPool.ExpectBeginTx(pgx.TxOptions{})
+		mockPool.ExpectRollback()
+	}
+	conflict := &pgconn.PgError{Code: "40001"}
+	_, err = dal.RunInTx(context.Background(), db, dal.TxOptions{MaxAttempts: 2}, func(ctx context.Context) (int, error) {
+		return 0, conflict
+	})
+	assert.ErrorIs(t, err, conflict)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestRunInTx_NestedCallsUseSavepoints(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mockPool.Close()
+	db := dal.NewMockDB(mockPool)
+
+	mockPool.ExpectBeginTx(pgx.TxOptions{})
+	mockPool.ExpectExec(`SAVEPOINT sp_1`).WillReturnResult(pgxmock.NewResult("SAVEPOINT", 0))
+	mockPool.ExpectExec(`SAVEPOINT sp_2`).WillReturnResult(pgxmock.NewResult("SAVEPOINT", 0))
+	mockPool.ExpectExec(`RELEASE SAVEPOINT sp_2`).WillReturnResult(pgxmock.NewResult("RELEASE", 0))
+	mockPool.ExpectExec(`ROLLBACK TO SAVEPOINT sp_1`).WillReturnResult(pgxmock.NewResult("ROLLBACK", 0))
+	mockPool.ExpectExec(`SAVEPOINT sp_1`).WillReturnResult(pgxmock.NewResult("SAVEPOINT", 0))
+	mockPool.ExpectExec(`RELEASE SAVEPOINT sp_1`).WillReturnResult(pgxmock.NewResult("RELEASE", 0))
+	mockPool.ExpectCommit()
+
+	errInner := errors.New("inner failed")
+	opts := dal.TxOptions{}
+	_, err = dal.RunInTx(context.Background(), db, opts, func(ctx context.Context) (bool, error) {
+		_, err := dal.RunInTx(ctx, db, opts, func(ctx context.Context) (bool, error) {
+			if _, err := dal.RunInTx(ctx, db, opts, func(ctx context.Context) (bool, error) { return true, nil }); err != nil {
+				return false, err
+			}
+			return false, errInner
+		})
+		assert.ErrorIs(t, err, errInner, "a failed savepoint does not abort the outer transaction")
+		return dal.RunInTx(ctx, db, opts, func(ctx context.Context) (bool, error) { return true, nil })
+	})
+	require.NoError(t, err)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
@@ -0,0 +1,30 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/repo"
+	"github.com/thornhall/simple-go-service/internal/repo/repotest"
+	"github.com/thornhall/simple-go-service/internal/testutil"
+)
+
+// TestUserRepo_Conformance runs the suite memstore also passes against a real database. It needs Docker
+// and is skipped without it.
+func TestUserRepo_Conformance(t *testing.T) {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	dsn, pgC := testutil.StartPostgresContainer(t)
+	t.Cleanup(func() { pgC.Terminate(context.Background()) })
+	db, err := dal.NewPostgresDB(dsn, 10, time.Minute)
+	require.NoError(t, err)
+	t.Cleanup(db.GetPool().Close)
+
+	repotest.UserRepository(t, func(t *testing.T) repo.UserRepository {
+		return dal.NewUserRepository(db)
+	})
+}
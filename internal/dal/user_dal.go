@@ -2,7 +2,11 @@ package dal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
 
 	"github.com/thornhall/simple-go-service/internal/model"
 	"github.com/thornhall/simple-go-service/internal/repo"
@@ -18,90 +22,259 @@ func NewUserRepository(conn Conn) repo.UserRepository {
 
 func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
 	const sql = `
-SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash
+SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash,
+       email_verified_at, pending_email, failed_login_attempts, locked_until,
+       ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+              WHERE ur.user_id = users.id ORDER BY r.name) AS roles,
+       version
   FROM users
-WHERE email = $1;
+WHERE email = $1
+  AND NOT is_deleted;
 `
 	u := &model.User{}
 	err := r.conn.QueryRow(ctx, sql, email).
-		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash)
+		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash,
+			&u.EmailVerifiedAt, &u.PendingEmail, &u.FailedLoginAttempts, &u.LockedUntil, &u.Roles, &u.Version)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 	return u, nil
 }
 
 func (r *UserRepo) FindById(ctx context.Context, id int64) (*model.User, error) {
 	const sql = `
-SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash
+SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash,
+       email_verified_at, pending_email, failed_login_attempts, locked_until,
+       ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+              WHERE ur.user_id = users.id ORDER BY r.name) AS roles,
+       version
   FROM users
-WHERE id = $1;
+WHERE id = $1
+  AND NOT is_deleted;
 `
 	u := &model.User{}
 	err := r.conn.QueryRow(ctx, sql, id).
-		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash)
+		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash,
+			&u.EmailVerifiedAt, &u.PendingEmail, &u.FailedLoginAttempts, &u.LockedUntil, &u.Roles, &u.Version)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 	return u, nil
 }
 
 func (r *UserRepo) FindByObjectId(ctx context.Context, objectId string) (*model.User, error) {
 	const sql = `
-SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash
+SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash,
+       email_verified_at, pending_email, failed_login_attempts, locked_until,
+       ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+              WHERE ur.user_id = users.id ORDER BY r.name) AS roles,
+       version
   FROM users
-WHERE object_id = $1;
+WHERE object_id = $1
+  AND NOT is_deleted;
 `
 	u := &model.User{}
 	err := r.conn.QueryRow(ctx, sql, objectId).
-		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash)
+		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash,
+			&u.EmailVerifiedAt, &u.PendingEmail, &u.FailedLoginAttempts, &u.LockedUntil, &u.Roles, &u.Version)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 	return u, nil
 }
 
+// Create inserts the user and grants it u.Roles in the same statement. Unknown role names are ignored.
 func (r *UserRepo) Create(ctx context.Context, u *model.User) error {
 	const sql = `
-INSERT INTO users (first_name, last_name, email, password_hash)
-VALUES ($1, $2, $3, $4)
-RETURNING object_id, created_at, updated_at;
+WITH inserted AS (
+    INSERT INTO users (first_name, last_name, email, password_hash)
+    VALUES ($1, $2, $3, $4)
+    RETURNING id, object_id, created_at, updated_at, version
+), granted AS (
+    INSERT INTO user_roles (user_id, role_id)
+    SELECT inserted.id, roles.id
+      FROM inserted, roles
+     WHERE roles.name = ANY($5::text[])
+)
+SELECT id, object_id, created_at, updated_at, version FROM inserted;
 `
 	row := r.conn.QueryRow(ctx, sql,
-		u.FirstName, u.LastName, u.Email, u.PasswordHash,
+		u.FirstName, u.LastName, u.Email, u.PasswordHash, u.Roles,
 	)
-	return row.Scan(&u.ObjectId, &u.CreatedAt, &u.UpdatedAt)
+	return translate(row.Scan(&u.Id, &u.ObjectId, &u.CreatedAt, &u.UpdatedAt, &u.Version))
 }
 
+// Update writes u's profile if the user is still at u.Version, and advances u.Version. It fails with
+// repo.ErrStale when the user was changed since u was read.
 func (r *UserRepo) Update(ctx context.Context, u *model.User) error {
 	const sql = `
 UPDATE users
-   SET first_name = $1,
-       last_name  = $2,
-       email      = $3,
-       updated_at = now()
- WHERE id = $4;
+   SET first_name    = $1,
+       last_name     = $2,
+       email         = $3,
+       pending_email = $4,
+       updated_at    = now(),
+       version       = version + 1
+ WHERE id = $5
+   AND NOT is_deleted
+   AND version = $6
+RETURNING version;
 `
-	cmd, err := r.conn.Exec(ctx, sql,
-		u.FirstName, u.LastName, u.Email, u.Id,
-	)
+	err := r.conn.QueryRow(ctx, sql,
+		u.FirstName, u.LastName, u.Email, u.PendingEmail, u.Id, u.Version,
+	).Scan(&u.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.staleOrMissing(ctx, u)
+	}
+	return translate(err)
+}
+
+// staleOrMissing explains why a conditional write to u matched no row.
+func (r *UserRepo) staleOrMissing(ctx context.Context, u *model.User) error {
+	const sql = `
+SELECT version
+  FROM users
+ WHERE id = $1
+   AND NOT is_deleted;
+`
+	var current int64
+	err := r.conn.QueryRow(ctx, sql, u.Id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row updated for object_id=%s", u.ObjectId))
+	} else if err != nil {
+		return translate(err)
+	}
+	return repo.ErrStale.Wrap(fmt.Errorf("object_id=%s is at version %d, not %d", u.ObjectId, current, u.Version))
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, userId int64, passwordHash string) error {
+	const sql = `
+UPDATE users
+   SET password_hash = $1,
+       updated_at    = now(),
+       version       = version + 1
+ WHERE id = $2
+   AND NOT is_deleted;
+`
+	cmd, err := r.conn.Exec(ctx, sql, passwordHash, userId)
 	if err != nil {
-		return err
+		return translate(err)
 	}
 	if cmd.RowsAffected() != 1 {
-		return fmt.Errorf("no row updated for object_id=%s", u.ObjectId)
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row updated for id=%d", userId))
 	}
 	return nil
 }
 
+func (r *UserRepo) ConfirmEmail(ctx context.Context, userId int64, email string) (bool, error) {
+	const sql = `
+UPDATE users
+   SET email             = $2,
+       email_verified_at = now(),
+       pending_email     = CASE WHEN pending_email = $2 THEN NULL ELSE pending_email END,
+       updated_at        = now(),
+       version           = version + 1
+ WHERE id = $1
+   AND NOT is_deleted
+   AND (email = $2 OR pending_email = $2);
+`
+	cmd, err := r.conn.Exec(ctx, sql, userId, email)
+	if err != nil {
+		return false, translate(err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+func (r *UserRepo) RecordLoginFailure(ctx context.Context, userId int64) (int, error) {
+	const sql = `
+UPDATE users
+   SET failed_login_attempts = failed_login_attempts + 1
+ WHERE id = $1
+RETURNING failed_login_attempts;
+`
+	var attempts int
+	if err := r.conn.QueryRow(ctx, sql, userId).Scan(&attempts); err != nil {
+		return 0, translate(err)
+	}
+	return attempts, nil
+}
+
+func (r *UserRepo) LockUntil(ctx context.Context, userId int64, until time.Time) error {
+	const sql = `
+UPDATE users
+   SET locked_until = $2
+ WHERE id = $1;
+`
+	_, err := r.conn.Exec(ctx, sql, userId, until)
+	return translate(err)
+}
+
+func (r *UserRepo) ResetLoginFailures(ctx context.Context, userId int64) error {
+	const sql = `
+UPDATE users
+   SET failed_login_attempts = 0,
+       locked_until          = NULL
+ WHERE id = $1;
+`
+	_, err := r.conn.Exec(ctx, sql, userId)
+	return translate(err)
+}
+
+// Delete soft-deletes the user. The row is kept until Purge removes it, so it can still be restored.
 func (r *UserRepo) Delete(ctx context.Context, objectId string) error {
-	const sql = `DELETE FROM users WHERE object_id = $1;`
+	const sql = `
+UPDATE users
+   SET is_deleted = TRUE,
+       deleted_at = now(),
+       updated_at = now(),
+       version    = version + 1
+ WHERE object_id = $1
+   AND NOT is_deleted;
+`
 	cmd, err := r.conn.Exec(ctx, sql, objectId)
 	if err != nil {
-		return err
+		return translate(err)
 	}
 	if cmd.RowsAffected() != 1 {
-		return fmt.Errorf("no row deleted for object_id=%s", objectId)
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row deleted for object_id=%s", objectId))
 	}
 	return nil
 }
+
+func (r *UserRepo) Restore(ctx context.Context, objectId string) (*model.User, error) {
+	const sql = `
+UPDATE users
+   SET is_deleted = FALSE,
+       deleted_at = NULL,
+       updated_at = now(),
+       version    = version + 1
+ WHERE object_id = $1
+   AND is_deleted
+RETURNING id, object_id, first_name, last_name, email, created_at, updated_at, password_hash,
+          email_verified_at, pending_email, failed_login_attempts, locked_until,
+          ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+                 WHERE ur.user_id = users.id ORDER BY r.name) AS roles,
+          version;
+`
+	u := &model.User{}
+	err := r.conn.QueryRow(ctx, sql, objectId).
+		Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.PasswordHash,
+			&u.EmailVerifiedAt, &u.PendingEmail, &u.FailedLoginAttempts, &u.LockedUntil, &u.Roles, &u.Version)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return u, nil
+}
+
+func (r *UserRepo) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const sql = `
+DELETE FROM users
+ WHERE is_deleted
+   AND deleted_at < $1;
+`
+	cmd, err := r.conn.Exec(ctx, sql, deletedBefore)
+	if err != nil {
+		return 0, translate(err)
+	}
+	return cmd.RowsAffected(), nil
+}
@@ -7,15 +7,21 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	pgxv4 "github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
 	"github.com/thornhall/simple-go-service/internal/dal"
 	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
 )
 
+var smith = "Smith"
+
 func TestUserRepo_FindByEmail(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.NoError(t, err)
@@ -40,10 +46,11 @@ func TestUserRepo_FindByEmail(t *testing.T) {
 			mockSetup: func() {
 				rows := pgxmock.NewRows([]string{
 					"id", "object_id", "first_name", "last_name", "email", "created_at", "updated_at", "password_hash",
-				}).AddRow(int64(1234), "uuid-1234", "Alice", "Smith", email, now, now, string(password))
+					"email_verified_at", "pending_email", "failed_login_attempts", "locked_until", "roles", "version",
+				}).AddRow(int64(1234), "uuid-1234", "Alice", &smith, email, now, now, string(password), nil, nil, 0, nil, []string{"user"}, int64(3))
 
 				mockPool.
-					ExpectQuery(`SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash`).
+					ExpectQuery(`SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash.*WHERE email = \$1\s+AND NOT is_deleted`).
 					WithArgs(email).
 					WillReturnRows(rows)
 			},
@@ -51,11 +58,13 @@ func TestUserRepo_FindByEmail(t *testing.T) {
 				Id:           int64(1234),
 				ObjectId:     "uuid-1234",
 				FirstName:    "Alice",
-				LastName:     "Smith",
+				LastName:     &smith,
 				Email:        email,
 				CreatedAt:    now,
 				UpdatedAt:    now,
 				PasswordHash: string(password),
+				Roles:        []string{"user"},
+				Version:      3,
 			},
 			wantErr: false,
 		},
@@ -113,7 +122,8 @@ func TestUserRepo_FindById(t *testing.T) {
 			mockSetup: func() {
 				rows := pgxmock.NewRows([]string{
 					"id", "object_id", "first_name", "last_name", "email", "created_at", "updated_at", "password_hash",
-				}).AddRow(int64(1234), "uuid-1234", "Alice", "Smith", "a@example.com", now, now, string(password))
+					"email_verified_at", "pending_email", "failed_login_attempts", "locked_until", "roles", "version",
+				}).AddRow(int64(1234), "uuid-1234", "Alice", &smith, "a@example.com", now, now, string(password), nil, nil, 0, nil, []string{"user"}, int64(3))
 
 				mockPool.
 					ExpectQuery(`SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash`).
@@ -124,11 +134,13 @@ func TestUserRepo_FindById(t *testing.T) {
 				Id:           int64(1234),
 				ObjectId:     "uuid-1234",
 				FirstName:    "Alice",
-				LastName:     "Smith",
+				LastName:     &smith,
 				Email:        "a@example.com",
 				CreatedAt:    now,
 				UpdatedAt:    now,
 				PasswordHash: string(password),
+				Roles:        []string{"user"},
+				Version:      3,
 			},
 			wantErr: false,
 		},
@@ -186,7 +198,8 @@ func TestUserRepo_FindByObjectID(t *testing.T) {
 			mockSetup: func() {
 				rows := pgxmock.NewRows([]string{
 					"id", "object_id", "first_name", "last_name", "email", "created_at", "updated_at", "password_hash",
-				}).AddRow(int64(1), "uuid-1234", "Alice", "Smith", "a@example.com", now, now, string(password))
+					"email_verified_at", "pending_email", "failed_login_attempts", "locked_until", "roles", "version",
+				}).AddRow(int64(1), "uuid-1234", "Alice", &smith, "a@example.com", now, now, string(password), nil, nil, 0, nil, []string{"user"}, int64(3))
 
 				mockPool.
 					ExpectQuery(`SELECT id, object_id, first_name, last_name, email, created_at, updated_at, password_hash`).
@@ -197,11 +210,13 @@ func TestUserRepo_FindByObjectID(t *testing.T) {
 				Id:           int64(1),
 				ObjectId:     "uuid-1234",
 				FirstName:    "Alice",
-				LastName:     "Smith",
+				LastName:     &smith,
 				Email:        "a@example.com",
 				CreatedAt:    now,
 				UpdatedAt:    now,
 				PasswordHash: string(password),
+				Roles:        []string{"user"},
+				Version:      3,
 			},
 			wantErr: false,
 		},
@@ -255,12 +270,12 @@ func TestUserRepo_Create(t *testing.T) {
 			name:     "success",
 			objectId: uuid.New().String(),
 			mockSetup: func(objectId string, inputUser *model.User) {
-				rows := pgxmock.NewRows([]string{"object_id", "created_at", "updated_at"}).
-					AddRow(objectId, now, now)
+				rows := pgxmock.NewRows([]string{"id", "object_id", "created_at", "updated_at", "version"}).
+					AddRow(int64(42), objectId, now, now, int64(1))
 
 				mockPool.
-					ExpectQuery(`INSERT INTO users.*RETURNING object_id, created_at, updated_at`).
-					WithArgs(inputUser.FirstName, inputUser.LastName, inputUser.Email, inputUser.PasswordHash).
+					ExpectQuery(`INSERT INTO users.*RETURNING id, object_id, created_at, updated_at, version`).
+					WithArgs(inputUser.FirstName, inputUser.LastName, inputUser.Email, inputUser.PasswordHash, inputUser.Roles).
 					WillReturnRows(rows)
 			},
 			wantErr: false,
@@ -269,8 +284,8 @@ func TestUserRepo_Create(t *testing.T) {
 			name: "query error",
 			mockSetup: func(objectId string, inputUser *model.User) {
 				mockPool.
-					ExpectQuery(`INSERT INTO users.*RETURNING object_id, created_at, updated_at`).
-					WithArgs(inputUser.FirstName, inputUser.LastName, inputUser.Email, inputUser.PasswordHash).
+					ExpectQuery(`INSERT INTO users.*RETURNING id, object_id, created_at, updated_at, version`).
+					WithArgs(inputUser.FirstName, inputUser.LastName, inputUser.Email, inputUser.PasswordHash, inputUser.Roles).
 					WillReturnError(fmt.Errorf("insert failed"))
 			},
 			wantErr: true,
@@ -282,9 +297,10 @@ func TestUserRepo_Create(t *testing.T) {
 
 			inputUser := &model.User{
 				FirstName:    "Alice",
-				LastName:     "Smith",
+				LastName:     &smith,
 				Email:        "alice@example.com",
 				PasswordHash: string(password),
+				Roles:        []string{"user"},
 			}
 
 			testObjectId := uuid.New().String()
@@ -293,14 +309,17 @@ func TestUserRepo_Create(t *testing.T) {
 			err := repo.Create(context.Background(), inputUser)
 			if tt.wantErr {
 				assert.Error(t, err)
+				assert.Zero(t, inputUser.Id)
 				assert.Zero(t, inputUser.ObjectId)
 				assert.True(t, inputUser.CreatedAt.IsZero())
 				assert.True(t, inputUser.UpdatedAt.IsZero())
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, int64(42), inputUser.Id)
 				assert.Equal(t, testObjectId, inputUser.ObjectId)
 				assert.Equal(t, now, inputUser.CreatedAt)
 				assert.Equal(t, now, inputUser.UpdatedAt)
+				assert.Equal(t, int64(1), inputUser.Version)
 			}
 			assert.NoError(t, mockPool.ExpectationsWereMet())
 		})
@@ -311,53 +330,68 @@ func TestUserRepo_Update(t *testing.T) {
 	mockPool, err := pgxmock.NewPool()
 	assert.NoError(t, err)
 
-	repo := dal.NewUserRepository(mockPool)
+	users := dal.NewUserRepository(mockPool)
 
 	baseUser := &model.User{
 		Id:        int64(123),
 		ObjectId:  "uuid-123",
 		FirstName: "Old",
-		LastName:  "Name",
+		LastName:  &smith,
 		Email:     "old@example.com",
+		Version:   4,
+	}
+	expectUpdate := func(u *model.User) *pgxmock.ExpectedQuery {
+		return mockPool.
+			ExpectQuery(`UPDATE users.*version\s+= version \+ 1\s+WHERE id = \$5\s+AND NOT is_deleted\s+AND version = \$6\s+RETURNING version`).
+			WithArgs(u.FirstName, u.LastName, u.Email, u.PendingEmail, u.Id, u.Version)
+	}
+	expectCurrent := func() *pgxmock.ExpectedQuery {
+		return mockPool.
+			ExpectQuery(`SELECT version\s+FROM users\s+WHERE id = \$1\s+AND NOT is_deleted`).
+			WithArgs(baseUser.Id)
 	}
 
 	tests := []struct {
-		name      string
-		mockSetup func(u *model.User)
-		wantErr   bool
-		errMsg    string
+		name        string
+		mockSetup   func(u *model.User)
+		wantErr     error
+		errMsg      string
+		wantVersion int64
 	}{
 		{
 			name: "success",
 			mockSetup: func(u *model.User) {
-				mockPool.
-					ExpectExec(`UPDATE users`).
-					WithArgs(u.FirstName, u.LastName, u.Email, u.Id).
-					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectUpdate(u).WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(int64(5)))
 			},
-			wantErr: false,
+			wantVersion: 5,
 		},
 		{
-			name: "no rows affected",
+			name: "stale version",
 			mockSetup: func(u *model.User) {
-				mockPool.
-					ExpectExec(`UPDATE users`).
-					WithArgs(u.FirstName, u.LastName, u.Email, u.Id).
-					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				expectUpdate(u).WillReturnError(pgxv4.ErrNoRows)
+				expectCurrent().WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(int64(6)))
 			},
-			wantErr: true,
-			errMsg:  fmt.Sprintf("no row updated for object_id=%s", baseUser.ObjectId),
+			wantErr:     repo.ErrStale,
+			errMsg:      "object_id=uuid-123 is at version 6, not 4",
+			wantVersion: 4,
 		},
 		{
-			name: "exec error",
+			name: "missing user",
 			mockSetup: func(u *model.User) {
-				mockPool.
-					ExpectExec(`UPDATE users`).
-					WithArgs(u.FirstName, u.LastName, u.Email, u.Id).
-					WillReturnError(fmt.Errorf("db failure"))
+				expectUpdate(u).WillReturnError(pgxv4.ErrNoRows)
+				expectCurrent().WillReturnError(pgxv4.ErrNoRows)
 			},
-			wantErr: true,
-			errMsg:  "db failure",
+			wantErr:     repo.ErrNotFound,
+			errMsg:      fmt.Sprintf("no row updated for object_id=%s", baseUser.ObjectId),
+			wantVersion: 4,
+		},
+		{
+			name: "query error",
+			mockSetup: func(u *model.User) {
+				expectUpdate(u).WillReturnError(fmt.Errorf("db failure"))
+			},
+			errMsg:      "db failure",
+			wantVersion: 4,
 		},
 	}
 
@@ -366,15 +400,17 @@ func TestUserRepo_Update(t *testing.T) {
 			u := *baseUser
 			tt.mockSetup(&u)
 
-			err := repo.Update(context.Background(), &u)
-			if tt.wantErr {
+			err := users.Update(context.Background(), &u)
+			if tt.errMsg != "" {
 				assert.Error(t, err)
-				if tt.errMsg != "" {
-					assert.Contains(t, err.Error(), tt.errMsg)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
 				}
 			} else {
 				assert.NoError(t, err)
 			}
+			assert.Equal(t, tt.wantVersion, u.Version)
 
 			assert.NoError(t, mockPool.ExpectationsWereMet())
 		})
@@ -399,9 +435,9 @@ func TestUserRepo_Delete(t *testing.T) {
 			id:   "uuid-123",
 			mockSetup: func() {
 				mockPool.
-					ExpectExec(`DELETE FROM users WHERE object_id = \$1`).
+					ExpectExec(`UPDATE users\s+SET is_deleted = TRUE,\s+deleted_at = now\(\).*AND NOT is_deleted`).
 					WithArgs("uuid-123").
-					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 			},
 			wantErr: false,
 		},
@@ -410,9 +446,9 @@ func TestUserRepo_Delete(t *testing.T) {
 			id:   "uuid-missing",
 			mockSetup: func() {
 				mockPool.
-					ExpectExec(`DELETE FROM users WHERE object_id = \$1`).
+					ExpectExec(`UPDATE users\s+SET is_deleted = TRUE,\s+deleted_at = now\(\).*AND NOT is_deleted`).
 					WithArgs("uuid-missing").
-					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
 			},
 			wantErr: true,
 			errMsg:  "no row deleted for object_id=uuid-missing",
@@ -422,7 +458,7 @@ func TestUserRepo_Delete(t *testing.T) {
 			id:   "uuid-error",
 			mockSetup: func() {
 				mockPool.
-					ExpectExec(`DELETE FROM users WHERE object_id = \$1`).
+					ExpectExec(`UPDATE users\s+SET is_deleted = TRUE,\s+deleted_at = now\(\).*AND NOT is_deleted`).
 					WithArgs("uuid-error").
 					WillReturnError(fmt.Errorf("db error"))
 			},
@@ -449,3 +485,168 @@ func TestUserRepo_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestUserRepo_UpdatePassword(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+
+	repo := dal.NewUserRepository(mockPool)
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET password_hash = \$1`).
+		WithArgs("new-hash", int64(123)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.UpdatePassword(context.Background(), 123, "new-hash"))
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET password_hash = \$1`).
+		WithArgs("new-hash", int64(404)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	err = repo.UpdatePassword(context.Background(), 404, "new-hash")
+	assert.ErrorContains(t, err, "no row updated for id=404")
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestUserRepo_ConfirmEmail(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewUserRepository(mockPool)
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET email\s+= \$2,\s+email_verified_at = now\(\)`).
+		WithArgs(int64(123), "new@example.com").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	confirmed, err := repo.ConfirmEmail(context.Background(), 123, "new@example.com")
+	assert.NoError(t, err)
+	assert.True(t, confirmed)
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET email\s+= \$2`).
+		WithArgs(int64(123), "stale@example.com").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	confirmed, err = repo.ConfirmEmail(context.Background(), 123, "stale@example.com")
+	assert.NoError(t, err)
+	assert.False(t, confirmed)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestUserRepo_Restore(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewUserRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+
+	mockPool.
+		ExpectQuery(`UPDATE users\s+SET is_deleted = FALSE,\s+deleted_at = NULL.*AND is_deleted\s+RETURNING id`).
+		WithArgs("uuid-123").
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "object_id", "first_name", "last_name", "email", "created_at", "updated_at", "password_hash",
+			"email_verified_at", "pending_email", "failed_login_attempts", "locked_until", "roles", "version",
+		}).AddRow(int64(123), "uuid-123", "Alice", &smith, "a@example.com", now, now, "hash", nil, nil, 0, nil, []string{"user"}, int64(3)))
+	u, err := repo.Restore(context.Background(), "uuid-123")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123), u.Id)
+	assert.Equal(t, []string{"user"}, u.Roles)
+
+	mockPool.
+		ExpectQuery(`UPDATE users\s+SET is_deleted = FALSE`).
+		WithArgs("uuid-live").
+		WillReturnError(pgx.ErrNoRows)
+	u, err = repo.Restore(context.Background(), "uuid-live")
+	assert.Error(t, err)
+	assert.Nil(t, u)
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestUserRepo_Purge(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewUserRepository(mockPool)
+	cutoff := time.Now().Add(-time.Hour)
+
+	mockPool.
+		ExpectExec(`DELETE FROM users\s+WHERE is_deleted\s+AND deleted_at < \$1`).
+		WithArgs(cutoff).
+		WillReturnResult(pgxmock.NewResult("DELETE", 4))
+	n, err := repo.Purge(context.Background(), cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestUserRepo_LoginFailures(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewUserRepository(mockPool)
+	until := time.Now().Add(time.Minute)
+
+	mockPool.
+		ExpectQuery(`UPDATE users\s+SET failed_login_attempts = failed_login_attempts \+ 1.*RETURNING failed_login_attempts`).
+		WithArgs(int64(7)).
+		WillReturnRows(pgxmock.NewRows([]string{"failed_login_attempts"}).AddRow(3))
+	attempts, err := repo.RecordLoginFailure(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET locked_until = \$2`).
+		WithArgs(int64(7), until).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.LockUntil(context.Background(), 7, until))
+
+	mockPool.
+		ExpectExec(`UPDATE users\s+SET failed_login_attempts = 0,\s+locked_until\s+= NULL`).
+		WithArgs(int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.ResetLoginFailures(context.Background(), 7))
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
+
+func TestUserRepo_TranslatesDriverErrors(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+	repo := dal.NewUserRepository(mockPool)
+
+	// a duplicate email is a conflict
+	mockPool.ExpectQuery(`INSERT INTO users`).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+	err = repo.Create(context.Background(), &model.User{Email: "taken@example.com"})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+	var pgErr *pgconn.PgError
+	assert.ErrorAs(t, err, &pgErr, "the driver error stays reachable as the cause")
+
+	// an object id that is not a uuid is invalid input
+	mockPool.ExpectQuery(`SELECT .* FROM users`).
+		WillReturnError(&pgconn.PgError{Code: "22P02"})
+	_, err = repo.FindByObjectId(context.Background(), "not-a-uuid")
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+
+	// no row is not found
+	mockPool.ExpectQuery(`SELECT .* FROM users`).
+		WillReturnError(pgxv4.ErrNoRows)
+	_, err = repo.FindByObjectId(context.Background(), uuid.NewString())
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+
+	// anything else is passed on untouched
+	mockPool.ExpectQuery(`SELECT .* FROM users`).
+		WillReturnError(fmt.Errorf("connection reset"))
+	_, err = repo.FindByObjectId(context.Background(), uuid.NewString())
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, apperr.KindInternal, apperr.KindOf(err))
+
+	assert.NoError(t, mockPool.ExpectationsWereMet())
+}
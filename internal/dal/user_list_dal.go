@@ -0,0 +1,116 @@
+package dal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+// sortColumn is the SQL expression users are ordered on and the type cursor values are cast to.
+type sortColumn struct {
+	expr, cast string
+	// folded text sorts case-insensitively, then case-sensitively to break ties, under the C collation
+	// whatever the database's default is. lower only folds ASCII letters under it, which memstore mirrors.
+	folded bool
+}
+
+// terms returns the sort keys of expr, an expression of the column's type.
+func (c sortColumn) terms(expr string) []string {
+	if !c.folded {
+		return []string{expr}
+	}
+	pinned := expr + ` COLLATE "C"`
+	return []string{"lower(" + pinned + ")", pinned}
+}
+
+// userSortColumns whitelists the fields users can be listed by.
+var userSortColumns = map[string]sortColumn{
+	"created_at": {expr: "created_at", cast: "timestamptz"},
+	"updated_at": {expr: "updated_at", cast: "timestamptz"},
+	"email":      {expr: "email", cast: "text", folded: true},
+	"first_name": {expr: "first_name", cast: "text", folded: true},
+	"last_name":  {expr: "COALESCE(last_name, '')", cast: "text", folded: true},
+}
+
+// List returns up to q.Limit users in (sort field, id) order, starting after q.After when it is set.
+func (r *UserRepo) List(ctx context.Context, q model.UserListQuery) ([]*model.User, error) {
+	col, ok := userSortColumns[q.SortField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", q.SortField)
+	}
+	dir, cmp := "ASC", ">"
+	if q.Descending {
+		dir, cmp = "DESC", "<"
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.Deleted != nil {
+		where = append(where, "is_deleted = "+arg(*q.Deleted))
+	}
+	if q.EmailPrefix != "" {
+		where = append(where, "email LIKE "+arg(escapeLike(q.EmailPrefix)+"%"))
+	}
+	if q.Name != "" {
+		where = append(where, "(first_name || ' ' || COALESCE(last_name, '')) ILIKE "+arg("%"+escapeLike(q.Name)+"%"))
+	}
+	if q.CreatedAfter != nil {
+		where = append(where, "created_at >= "+arg(*q.CreatedAfter))
+	}
+	if q.CreatedBefore != nil {
+		where = append(where, "created_at < "+arg(*q.CreatedBefore))
+	}
+	if q.After != nil {
+		value := arg(q.After.Value) + "::" + col.cast
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)",
+			strings.Join(col.terms(col.expr), ", "), cmp, strings.Join(col.terms(value), ", "), arg(q.After.Id)))
+	}
+	var order []string
+	for _, term := range append(col.terms(col.expr), "id") {
+		order = append(order, term+" "+dir)
+	}
+
+	sql := `
+SELECT id, object_id, first_name, last_name, email, created_at, updated_at,
+       email_verified_at, pending_email,
+       ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+              WHERE ur.user_id = users.id ORDER BY r.name) AS roles,
+       is_deleted, deleted_at, version
+  FROM users`
+	if len(where) > 0 {
+		sql += "\n WHERE " + strings.Join(where, "\n   AND ")
+	}
+	sql += fmt.Sprintf("\n ORDER BY %s\n LIMIT %s;", strings.Join(order, ", "), arg(q.Limit))
+
+	rows, err := r.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, translate(err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		u := &model.User{}
+		err := rows.Scan(&u.Id, &u.ObjectId, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt,
+			&u.EmailVerifiedAt, &u.PendingEmail, &u.Roles, &u.IsDeleted, &u.DeletedAt, &u.Version)
+		if err != nil {
+			return nil, translate(err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translate(err)
+	}
+	return users, nil
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
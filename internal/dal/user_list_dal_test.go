@@ -0,0 +1,149 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/testutil"
+)
+
+var listColumns = []string{
+	"id", "object_id", "first_name", "last_name", "email", "created_at", "updated_at",
+	"email_verified_at", "pending_email", "roles", "is_deleted", "deleted_at", "version",
+}
+
+func TestUserRepo_List(t *testing.T) {
+	mockPool, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mockPool.Close()
+
+	repo := dal.NewUserRepository(mockPool)
+	now := time.Now().Truncate(time.Second)
+	live := false
+
+	tests := []struct {
+		name      string
+		query     model.UserListQuery
+		mockSetup func()
+		wantLen   int
+		wantErr   bool
+	}{
+		{
+			name:  "first page with filters",
+			query: model.UserListQuery{SortField: "created_at", Deleted: &live, EmailPrefix: "a_b", Name: "50%", Limit: 3},
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`WHERE is_deleted = \$1\s+AND email LIKE \$2\s+AND .* ILIKE \$3\s+ORDER BY created_at ASC, id ASC\s+LIMIT \$4`).
+					WithArgs(false, `a\_b%`, `%50\%%`, 3).
+					WillReturnRows(pgxmock.NewRows(listColumns).
+						AddRow(int64(1), "uuid-1", "Ann", nil, "a_b@example.com", now, now, nil, nil, []string{"user"}, false, nil, int64(1)))
+			},
+			wantLen: 1,
+		},
+		{
+			name: "descending page after a cursor",
+			query: model.UserListQuery{
+				SortField:  "email",
+				Descending: true,
+				After:      &model.UserCursor{Sort: "-email", Value: "m@example.com", Id: 7},
+				Limit:      2,
+			},
+			mockSetup: func() {
+				mockPool.
+					ExpectQuery(`WHERE \(lower\(email COLLATE "C"\), email COLLATE "C", id\) < `+
+						`\(lower\(\$1::text COLLATE "C"\), \$1::text COLLATE "C", \$2\)\s+`+
+						`ORDER BY lower\(email COLLATE "C"\) DESC, email COLLATE "C" DESC, id DESC\s+LIMIT \$3`).
+					WithArgs("m@example.com", int64(7), 2).
+					WillReturnRows(pgxmock.NewRows(listColumns))
+			},
+			wantLen: 0,
+		},
+		{
+			name:      "sort field outside the whitelist",
+			query:     model.UserListQuery{SortField: "password_hash", Limit: 2},
+			mockSetup: func() {},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			users, err := repo.List(context.Background(), tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, users, tt.wantLen)
+			}
+			assert.NoError(t, mockPool.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestUserRepo_List_Postgres runs the list query against a real database, where the collation, row-value
+// comparisons and LIKE escaping that the mocks above only match as text actually take effect. It needs
+// Docker and is skipped without it.
+func TestUserRepo_List_Postgres(t *testing.T) {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	dsn, pgC := testutil.StartPostgresContainer(t)
+	t.Cleanup(func() { pgC.Terminate(context.Background()) })
+	db, err := dal.NewPostgresDB(dsn, 10, time.Minute)
+	require.NoError(t, err)
+	t.Cleanup(db.GetPool().Close)
+	repo, ctx := dal.NewUserRepository(db), context.Background()
+
+	create := func(email, first string) *model.User {
+		u := &model.User{FirstName: first, Email: email, PasswordHash: "hash"}
+		require.NoError(t, repo.Create(ctx, u))
+		return u
+	}
+	// ties on the sort key, names differing only in case, and LIKE wildcards in the emails
+	bob1 := create("pg_1%@example.com", "bob")
+	bob2 := create("pg_2%@example.com", "bob")
+	upperBob := create("pg_3@example.com", "Bob")
+	adam := create("pg_4@example.com", "adam")
+	zed := create("pg_5@example.com", "Zed")
+	card := create("pg_1x@example.com", "Card")
+	create("pgx1@example.com", "Wild")
+
+	// pages walks every page of q three users at a time, resuming from the last user of each page, so the
+	// tied bobs are split across a page boundary in both directions
+	pages := func(q model.UserListQuery) []int64 {
+		q.Limit = 3
+		var seen []int64
+		for {
+			page, err := repo.List(ctx, q)
+			require.NoError(t, err)
+			for _, u := range page {
+				seen = append(seen, u.Id)
+			}
+			if len(page) < q.Limit {
+				return seen
+			}
+			last := page[len(page)-1]
+			q.After = &model.UserCursor{Value: last.FirstName, Id: last.Id}
+		}
+	}
+
+	q := model.UserListQuery{EmailPrefix: "pg_", SortField: "first_name"}
+	assert.Equal(t, []int64{adam.Id, upperBob.Id, bob1.Id, bob2.Id, card.Id, zed.Id}, pages(q),
+		"case-insensitive order, bytewise between names differing in case, by id between equal names")
+	q.Descending = true
+	assert.Equal(t, []int64{zed.Id, card.Id, bob2.Id, bob1.Id, upperBob.Id, adam.Id}, pages(q))
+
+	q = model.UserListQuery{EmailPrefix: "pg_1%", SortField: "email", Limit: 10}
+	users, err := repo.List(ctx, q)
+	require.NoError(t, err)
+	require.Len(t, users, 1, "% and _ in a prefix match only themselves")
+	assert.Equal(t, bob1.Id, users[0].Id)
+}
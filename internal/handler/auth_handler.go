@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+type AuthHandler struct {
+	Tokens *service.TokenService
+	Keys   *auth.Keyring
+}
+
+func NewAuthHandler(tokens *service.TokenService, keys *auth.Keyring) *AuthHandler {
+	return &AuthHandler{Tokens: tokens, Keys: keys}
+}
+
+// JWKS publishes the public verification keys so other services can validate our access tokens.
+func (h *AuthHandler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.Keys.JWKS())
+}
+
+func (h *AuthHandler) Refresh(ctx *gin.Context) {
+	var input model.RefreshTokenInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	tokens, err := h.Tokens.Refresh(ctx, input.RefreshToken)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+// maxBodyBytes caps how much of a request body handlers read. Larger bodies are refused with 413.
+const maxBodyBytes = 1 << 20
+
+var (
+	errEmptyBody    = apperr.Validation("empty_body", "request body cannot be empty")
+	errInvalidBody  = apperr.Validation("invalid_body", "request body is not valid JSON")
+	errBodyTooLarge = apperr.PayloadTooLarge("body_too_large", "request body is too large")
+)
+
+// fail records err for apperr.Middleware, which renders it once the handler returns. Errors that are not
+// an *apperr.Error reach the client as a bare 500.
+func fail(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+}
+
+// bindJSON decodes the request body into dst, then normalizes and validates it. When either fails, it
+// records the error and reports false.
+func bindJSON(ctx *gin.Context, dst any) bool {
+	err := decodeJSON(ctx, dst)
+	if err == nil {
+		err = validation.Struct(dst)
+	}
+	if err != nil {
+		fail(ctx, err)
+		return false
+	}
+	return true
+}
+
+// bindQuery maps the query string onto dst's `form` fields, then normalizes and validates it.
+func bindQuery(ctx *gin.Context, dst any) bool {
+	query := ctx.Request.URL.Query()
+	err := binding.MapFormWithTag(dst, query, "form")
+	if err != nil {
+		err = queryError(dst, query)
+	} else {
+		err = validation.Struct(dst)
+	}
+	if err != nil {
+		fail(ctx, err)
+		return false
+	}
+	return true
+}
+
+// queryError reports the query parameters that do not map onto dst's fields, such as a limit that is not a
+// number. The binder's own error quotes parser internals, so each parameter is mapped again on its own to
+// find the ones at fault.
+func queryError(dst any, query url.Values) error {
+	t := reflect.TypeOf(dst).Elem()
+	var problems []apperr.FieldError
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("form"), ",")
+		values, ok := query[name]
+		if !ok || name == "" || name == "-" {
+			continue
+		}
+		if binding.MapFormWithTag(reflect.New(t).Interface(), url.Values{name: values}, "form") != nil {
+			problems = append(problems, apperr.FieldError{Field: name, Code: "invalid", Message: "is not a valid value"})
+		}
+	}
+	return validation.ErrInvalid.WithFields(problems...)
+}
+
+// decodeJSON decodes the request body into dst. A value of the wrong JSON type is reported against its
+// field like any other validation failure.
+func decodeJSON(ctx *gin.Context, dst any) error {
+	if ctx.Request.Body == nil {
+		return errEmptyBody
+	}
+	err := json.NewDecoder(limitBody(ctx)).Decode(dst)
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.As(err, &tooLarge):
+		return errBodyTooLarge.Wrap(err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return validation.TypeError(typeErr)
+	default:
+		return errInvalidBody.Wrap(err)
+	}
+}
+
+// readBody reads the whole request body, up to maxBodyBytes.
+func readBody(ctx *gin.Context) ([]byte, error) {
+	if ctx.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(limitBody(ctx))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return body, nil
+	case errors.As(err, &tooLarge):
+		return nil, errBodyTooLarge.Wrap(err)
+	default:
+		return nil, errInvalidBody.Wrap(err)
+	}
+}
+
+// limitBody returns the request body, cut off with an error after maxBodyBytes.
+func limitBody(ctx *gin.Context) io.Reader {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBodyBytes)
+	return ctx.Request.Body
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+// etag is the entity tag of a user at version. Versions only grow, so the tag is strong.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag returns the version an entity tag made by etag names. Weak tags never match a strong one, so
+// they are rejected like tags this service did not issue.
+func parseETag(tag string) (int64, bool) {
+	unquoted, ok := strings.CutPrefix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	return version, err == nil && version > 0
+}
+
+// etagList splits the comma separated entity tags of every occurrence of header.
+func etagList(ctx *gin.Context, header string) []string {
+	var tags []string
+	for _, value := range ctx.Request.Header.Values(header) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// ifMatch reads the If-Match header into the precondition a write must meet.
+func ifMatch(ctx *gin.Context) service.Precondition {
+	tags := etagList(ctx, "If-Match")
+	if len(tags) == 0 {
+		return service.Precondition{}
+	}
+	var versions []int64
+	for _, tag := range tags {
+		if tag == "*" {
+			return service.IfMatchAny()
+		}
+		if version, ok := parseETag(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+	return service.IfMatch(versions...)
+}
+
+// notModified reports whether If-None-Match names the user at version, comparing tags weakly as RFC 9110
+// prescribes for that header.
+func notModified(ctx *gin.Context, version int64) bool {
+	for _, tag := range etagList(ctx, "If-None-Match") {
+		if tag == "*" {
+			return true
+		}
+		if v, ok := parseETag(strings.TrimPrefix(tag, "W/")); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/health"
+)
+
+type HealthHandler struct {
+	Checks *health.Checker
+}
+
+func NewHealthHandler(checks *health.Checker) *HealthHandler {
+	return &HealthHandler{Checks: checks}
+}
+
+// Live reports that the process is up and serving. It checks no dependencies, so an orchestrator never
+// restarts the service because Postgres is unreachable.
+func (h *HealthHandler) Live(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Ready runs every registered check and answers 503 with the per-check detail if any of them failed.
+func (h *HealthHandler) Ready(ctx *gin.Context) {
+	report := h.Checks.Run(ctx.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+var errMFALoginFailed = apperr.Unauthorized("invalid_mfa_code", "invalid mfa code")
+
+type MFAHandler struct {
+	Svc *service.MFAService
+}
+
+func NewMFAHandler(svc *service.MFAService) *MFAHandler {
+	return &MFAHandler{Svc: svc}
+}
+
+func (h *MFAHandler) Enroll(ctx *gin.Context) {
+	callerId, ok := callerIdFrom(ctx)
+	if !ok {
+		return
+	}
+	enrollment, err := h.Svc.Enroll(ctx, callerId, ctx.Param("object_id"))
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+func (h *MFAHandler) Confirm(ctx *gin.Context) {
+	callerId, ok := callerIdFrom(ctx)
+	if !ok {
+		return
+	}
+	var input model.MFACodeInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	codes, err := h.Svc.Confirm(ctx, callerId, ctx.Param("object_id"), input.Code)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Login is the second step of login for accounts with MFA enabled.
+func (h *MFAHandler) Login(ctx *gin.Context) {
+	var input model.MFALoginInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	tokens, err := h.Svc.Login(ctx, input)
+	if errors.Is(err, service.ErrInvalidMFACode) {
+		// a wrong second factor fails the login, so here it is an authentication failure rather than bad input
+		err = errMFALoginFailed
+	}
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,96 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestMFAHandler_EnrollAndLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Mo","email":"mo@example.com","password":"mo_password"}`)
+	other := createUser(t, router, `{"first_name":"Ed","email":"ed@example.com","password":"ed_password"}`)
+
+	post := func(path, bearer, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func() model.LoginResponse {
+		w := post("/users/login", "", `{"email":"mo@example.com","password":"mo_password"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp model.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	enrollPath := "/users/" + created.ObjectId + "/mfa/enroll"
+	confirmPath := "/users/" + created.ObjectId + "/mfa/confirm"
+
+	assert.Equal(t, http.StatusUnauthorized, post(enrollPath, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, post(enrollPath, other.AccessToken, "").Code)
+
+	w := post(enrollPath, created.AccessToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment model.MFAEnrollmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	step := auth.TOTPStep(time.Now())
+	assert.Equal(t, http.StatusBadRequest, post(confirmPath, created.AccessToken, `{"code":"000000"}`).Code)
+	w = post(confirmPath, created.AccessToken, `{"code":"`+auth.TOTPCode(secret, step)+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var recovery model.RecoveryCodesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	assert.NotEmpty(t, recovery.RecoveryCodes)
+	assert.Equal(t, http.StatusConflict, post(enrollPath, created.AccessToken, "").Code)
+
+	// the password step now only yields an mfa token, which the API does not accept
+	pending := login()
+	require.True(t, pending.MFARequired)
+	assert.Nil(t, pending.TokenPair)
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/"+created.ObjectId, nil)
+	req.Header.Set("Authorization", "Bearer "+pending.MFAToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized,
+		post("/users/login/mfa", "", `{"mfa_token":"`+pending.MFAToken+`","code":"`+auth.TOTPCode(secret, step)+`"}`).Code)
+	w = post("/users/login/mfa", "", `{"mfa_token":"`+pending.MFAToken+`","code":"`+auth.TOTPCode(secret, step+1)+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var pair model.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	assert.NotEmpty(t, pair.AccessToken)
+
+	// recovery codes are single use
+	pending = login()
+	assert.Equal(t, http.StatusOK,
+		post("/users/login/mfa", "", `{"mfa_token":"`+pending.MFAToken+`","code":"`+recovery.RecoveryCodes[0]+`"}`).Code)
+	pending = login()
+	assert.Equal(t, http.StatusUnauthorized,
+		post("/users/login/mfa", "", `{"mfa_token":"`+pending.MFAToken+`","code":"`+recovery.RecoveryCodes[0]+`"}`).Code)
+}
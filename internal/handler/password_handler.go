@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+type PasswordHandler struct {
+	Svc *service.PasswordService
+}
+
+func NewPasswordHandler(svc *service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{Svc: svc}
+}
+
+// Forgot always answers 202 so callers cannot tell whether the email belongs to an account.
+func (h *PasswordHandler) Forgot(ctx *gin.Context) {
+	var input model.ForgotPasswordInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	if err := h.Svc.Forgot(ctx, input.Email); err != nil {
+		logging.FromContext(ctx).Error("password reset request failed", "error", err)
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) Reset(ctx *gin.Context) {
+	var input model.ResetPasswordInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	err := h.Svc.Reset(ctx, input.Token, input.Password)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+)
+
+func lastMailedToken(t *testing.T, to string) string {
+	messages, err := testMailer.Messages()
+	require.NoError(t, err)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
+		}
+		for _, field := range strings.Fields(messages[i].Body) {
+			if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+				return u.Query().Get("token")
+			}
+		}
+	}
+	t.Fatalf("no email with a token sent to %s", to)
+	return ""
+}
+
+func TestPasswordHandler_ForgotAndReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Pat","email":"pat@example.com","password":"old_password"}`)
+
+	post := func(path, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// unknown and known emails get the same answer
+	assert.Equal(t, http.StatusAccepted, post("/users/password/forgot", `{"email":"nobody@example.com"}`))
+	assert.Equal(t, http.StatusAccepted, post("/users/password/forgot", `{"email":"pat@example.com"}`))
+	token := lastMailedToken(t, "pat@example.com")
+
+	assert.Equal(t, http.StatusBadRequest, post("/users/password/reset", `{"token":"bogus","password":"new_password"}`))
+	assert.Equal(t, http.StatusBadRequest, post("/users/password/reset", `{"token":"`+token+`","password":"short"}`))
+	assert.Equal(t, http.StatusNoContent, post("/users/password/reset", `{"token":"`+token+`","password":"new_password"}`))
+	assert.Equal(t, http.StatusBadRequest, post("/users/password/reset", `{"token":"`+token+`","password":"newer_password"}`))
+
+	// old sessions are gone and only the new password works
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/"+created.ObjectId, nil)
+	req.Header.Set("Authorization", "Bearer "+created.AccessToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, post("/users/login", `{"email":"pat@example.com","password":"old_password"}`))
+	assert.Equal(t, http.StatusOK, post("/users/login", `{"email":"pat@example.com","password":"new_password"}`))
+}
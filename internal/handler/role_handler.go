@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+type RoleHandler struct {
+	Svc *service.RoleService
+}
+
+func NewRoleHandler(svc *service.RoleService) *RoleHandler {
+	return &RoleHandler{Svc: svc}
+}
+
+func (h *RoleHandler) Grant(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
+	var input model.GrantRoleInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	user, err := h.Svc.Grant(ctx, caller, ctx.Param("object_id"), input.Role)
+	h.respond(ctx, user, err)
+}
+
+func (h *RoleHandler) Revoke(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
+	user, err := h.Svc.Revoke(ctx, caller, ctx.Param("object_id"), ctx.Param("role"))
+	h.respond(ctx, user, err)
+}
+
+func (h *RoleHandler) respond(ctx *gin.Context, user *model.UserResponse, err error) {
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,71 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestRoleHandler_GrantAndRevoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	admin := createUser(t, router, `{"first_name":"Rho","email":"role-admin@example.com","password":"test_pass"}`)
+	admin.AccessToken = grantRole(t, db, router, admin, auth.RoleAdmin)
+	agent := createUser(t, router, `{"first_name":"Sam","email":"role-agent@example.com","password":"test_pass"}`)
+	member := createUser(t, router, `{"first_name":"Mel","email":"role-member@example.com","password":"test_pass"}`)
+	assert.Equal(t, []string{auth.RoleUser}, member.Roles)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// only roles:manage may change roles
+	assert.Equal(t, http.StatusForbidden, do("POST", "/users/"+agent.ObjectId+"/roles", agent.AccessToken, `{"role":"admin"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/users/"+agent.ObjectId+"/roles", admin.AccessToken, `{"role":"wizard"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/users/"+agent.ObjectId+"/roles", admin.AccessToken, ``).Code)
+
+	w := do("POST", "/users/"+agent.ObjectId+"/roles", admin.AccessToken, `{"role":"support"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp model.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{auth.RoleSupport, auth.RoleUser}, resp.Roles)
+
+	// the new role applies from the next refresh: support can read other users but not delete them
+	assert.Equal(t, http.StatusForbidden, do("GET", "/users/"+member.ObjectId, agent.AccessToken, "").Code)
+	supportToken := refreshAccessToken(t, router, agent.RefreshToken)
+	assert.Equal(t, http.StatusOK, do("GET", "/users/"+member.ObjectId, supportToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("DELETE", "/users/"+member.ObjectId, supportToken, "").Code)
+
+	// admins manage any user through the regular endpoints
+	assert.Equal(t, http.StatusOK, do("PUT", "/users/"+member.ObjectId, admin.AccessToken, `{"first_name":"Melody","email":"role-member@example.com"}`).Code)
+
+	// revoking kills tokens that carry the role
+	w = do("DELETE", "/users/"+agent.ObjectId+"/roles/support", admin.AccessToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{auth.RoleUser}, resp.Roles)
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/"+member.ObjectId, supportToken, "").Code)
+
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/users/does-not-exist/roles/support", admin.AccessToken, "").Code)
+}
@@ -2,13 +2,13 @@ package handler
 
 import (
 	"errors"
-	"fmt"
-	"io"
-	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/patch"
 	"github.com/thornhall/simple-go-service/internal/service"
 )
 
@@ -22,86 +22,208 @@ func NewUserHandler(svc *service.UserService) *UserHandler {
 
 func (h *UserHandler) Login(ctx *gin.Context) {
 	var input model.LoginUserInput
-	if err := ctx.ShouldBindJSON(&input); err != nil {
-		if errors.Is(err, io.EOF) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "request body cannot be empty"})
-			return
-		} else {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	if !bindJSON(ctx, &input) {
+		return
 	}
-	jwt, err := h.Svc.Login(ctx, input)
+	tokens, err := h.Svc.Login(ctx, input)
 	if err != nil {
-		log.Println(fmt.Errorf("unable to login user due to error: %w", err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "unable to login"})
+		fail(ctx, err)
+		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{"jwt": jwt})
+	ctx.JSON(http.StatusOK, tokens)
 }
 
+// Get serves the user with its version as the ETag, or 304 when If-None-Match already names it.
 func (h *UserHandler) Get(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
 	objectId := ctx.Param("object_id")
-	user, err := h.Svc.Get(ctx, objectId)
-	if err == service.ErrNotFound {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	user, err := h.Svc.Get(ctx, caller, objectId)
+	if err != nil {
+		fail(ctx, err)
 		return
-	} else if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	ctx.Header("ETag", etag(user.Version))
+	if notModified(ctx, user.Version) {
+		ctx.Status(http.StatusNotModified)
 		return
 	}
 	ctx.JSON(http.StatusOK, user)
 }
 
+// List pages through users. It is limited to callers holding users:list.
+func (h *UserHandler) List(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
+	var params model.ListUsersParams
+	if !bindQuery(ctx, &params) {
+		return
+	}
+	page, err := h.Svc.List(ctx, caller, params)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, page)
+}
+
 func (h *UserHandler) Create(ctx *gin.Context) {
 	var input model.CreateUserInput
-	if err := ctx.ShouldBindJSON(&input); err != nil {
-		if errors.Is(err, io.EOF) {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "request body cannot be empty"})
-			return
-		} else {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	if !bindJSON(ctx, &input) {
+		return
 	}
-	user, jwt, err := h.Svc.Create(ctx, input)
+	user, tokens, err := h.Svc.Create(ctx, input)
 	if err != nil {
-		log.Printf("user create failed with error: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "encountered an error while creating a new user"})
+		fail(ctx, err)
 		return
 	}
 
 	resp := &model.CreateUserResponse{
 		UserResponse: user,
-		JWT:          jwt,
+		TokenPair:    tokens,
 	}
 	ctx.JSON(http.StatusCreated, resp)
 }
 
+// Update honors If-Match, refusing with 412 when the user has changed since the client read it.
 func (h *UserHandler) Update(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
 	objectId := ctx.Param("object_id")
 	var input model.UpdateUserInput
-	if err := ctx.ShouldBindJSON(&input); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(ctx, &input) {
+		return
+	}
+	user, err := h.Svc.Update(ctx, caller, objectId, ifMatch(ctx), input)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Header("ETag", etag(user.Version))
+	ctx.JSON(http.StatusOK, user)
+}
+
+// acceptPatch lists the patch formats Patch takes, for the Accept-Patch header (RFC 5789).
+var acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// Patch applies a merge patch or a JSON patch to the user, answering any other body with 415 and the
+// formats it takes. It honors If-Match like Update.
+func (h *UserHandler) Patch(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
 		return
 	}
-	user, err := h.Svc.Update(ctx, objectId, input)
-	if err == service.ErrNotFound {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	objectId := ctx.Param("object_id")
+	body, err := readBody(ctx)
+	if err != nil {
+		fail(ctx, err)
 		return
-	} else if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	p, err := patch.Parse(ctx.ContentType(), body, model.UserPatchFields...)
+	if err != nil {
+		if errors.Is(err, patch.ErrUnsupportedType) {
+			ctx.Header("Accept-Patch", acceptPatch)
+		}
+		fail(ctx, err)
+		return
+	}
+	user, err := h.Svc.Patch(ctx, caller, objectId, ifMatch(ctx), p)
+	if err != nil {
+		fail(ctx, err)
 		return
 	}
+	ctx.Header("ETag", etag(user.Version))
 	ctx.JSON(http.StatusOK, user)
 }
 
+// Delete honors If-Match like Update.
 func (h *UserHandler) Delete(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
+	objectId := ctx.Param("object_id")
+	if err := h.Svc.Delete(ctx, caller, objectId, ifMatch(ctx)); err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// Restore undoes a soft delete. It is limited to callers holding users:restore.
+func (h *UserHandler) Restore(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
+	objectId := ctx.Param("object_id")
+	user, err := h.Svc.Restore(ctx, caller, objectId)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Header("ETag", etag(user.Version))
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (h *UserHandler) Logout(ctx *gin.Context) {
+	callerId, ok := callerIdFrom(ctx)
+	if !ok {
+		return
+	}
+	claims, ok := auth.ClaimsFrom(ctx)
+	if !ok || claims.ExpiresAt == nil {
+		fail(ctx, auth.ErrInvalidToken)
+		return
+	}
+	var input model.LogoutInput
+	// the body is optional
+	if err := decodeJSON(ctx, &input); err != nil && !errors.Is(err, errEmptyBody) {
+		fail(ctx, err)
+		return
+	}
+	if err := h.Svc.Logout(ctx, callerId, claims.ID, claims.ExpiresAt.Time, input.RefreshToken); err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *UserHandler) RevokeSessions(ctx *gin.Context) {
+	caller, ok := callerFrom(ctx)
+	if !ok {
+		return
+	}
 	objectId := ctx.Param("object_id")
-	if err := h.Svc.Delete(ctx, objectId); err == service.ErrNotFound {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-	} else if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-	} else {
-		ctx.Status(http.StatusNoContent)
+	if err := h.Svc.RevokeSessions(ctx, caller, objectId); err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// callerIdFrom reads the user id that auth.JWTAuth placed on the context. If it is missing or malformed
+// a 401 is recorded and ok is false.
+func callerIdFrom(ctx *gin.Context) (int64, bool) {
+	callerId, err := strconv.ParseInt(ctx.GetString(auth.UserIdKey), 10, 64)
+	if err != nil {
+		fail(ctx, auth.ErrInvalidToken)
+		return 0, false
+	}
+	return callerId, true
+}
+
+// callerFrom is callerIdFrom plus the permissions granted by the roles in the caller's token.
+func callerFrom(ctx *gin.Context) (service.Caller, bool) {
+	callerId, ok := callerIdFrom(ctx)
+	if !ok {
+		return service.Caller{}, false
 	}
+	return service.Caller{Id: callerId, Permissions: auth.PermissionsFrom(ctx)}, true
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,36 +17,123 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
 	"github.com/thornhall/simple-go-service/internal/dal"
 	"github.com/thornhall/simple-go-service/internal/handler"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/model"
 	"github.com/thornhall/simple-go-service/internal/service"
 	"github.com/thornhall/simple-go-service/internal/testutil"
 )
 
+var (
+	testKeys       *auth.Keyring
+	testMailer     *mail.FileSender
+	testMFASecrets *auth.SecretBox
+)
+
 func TestMain(m *testing.M) {
 	t := &testing.T{}
 	dsn, container := testutil.StartPostgresContainer(t)
 	os.Setenv("DATABASE_URL", dsn)
-	os.Setenv("JWT_SECRET", "test_secret")
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	testKeys = keys
+	if testMFASecrets, err = auth.NewGeneratedSecretBox(); err != nil {
+		panic(err)
+	}
+	mailDir, err := os.MkdirTemp("", "mail")
+	if err != nil {
+		panic(err)
+	}
+	if testMailer, err = mail.NewFileSender(mailDir); err != nil {
+		panic(err)
+	}
 	code := m.Run()
 	testcontainers.CleanupContainer(t, container, testcontainers.StopContext(context.Background()))
+	os.RemoveAll(mailDir)
 	os.Exit(code)
 }
 
 func setupRouter(db dal.Conn) *gin.Engine {
 	repo := dal.NewUserRepository(db)
-	svc := service.NewUserService(repo)
+	denylist := auth.NewDenylist(dal.NewRevocationRepository(db), service.AccessTokenTTL)
+	tokens := service.NewTokenService(repo, dal.NewRefreshTokenRepository(db), testKeys, denylist)
+	verifier := service.NewVerificationService(repo, dal.NewEmailVerificationRepository(db), testMailer, "http://localhost/verify")
+	mfa := service.NewMFAService(repo, dal.NewMFARepository(db), tokens, testMFASecrets)
+	svc := service.NewUserService(repo, tokens, verifier, mfa)
 	h := handler.NewUserHandler(svc)
+	vh := handler.NewVerificationHandler(verifier)
+	mh := handler.NewMFAHandler(mfa)
+	ah := handler.NewAuthHandler(tokens, testKeys)
+	ph := handler.NewPasswordHandler(service.NewPasswordService(repo, dal.NewPasswordResetRepository(db), tokens, testMailer, "http://localhost/reset"))
+	roleRepo := dal.NewRoleRepository(db)
+	rh := handler.NewRoleHandler(service.NewRoleService(repo, roleRepo, tokens))
+	policy := auth.NewPolicy(roleRepo)
+	if err := policy.Load(context.Background()); err != nil {
+		panic(err)
+	}
 
 	r := gin.New()
-	r.GET("/users/:object_id", h.Get)
+	r.Use(apperr.Middleware(), auth.WithPolicy(policy))
 	r.POST("/users", h.Create)
-	r.PUT("/users/:object_id", h.Update)
-	r.DELETE("/users/:object_id", h.Delete)
+	r.POST("/users/login", h.Login)
+	r.POST("/auth/refresh", ah.Refresh)
+	r.POST("/users/password/forgot", ph.Forgot)
+	r.POST("/users/password/reset", ph.Reset)
+	r.GET("/users/verify-email", vh.VerifyEmail)
+	r.POST("/users/login/mfa", mh.Login)
+	authMiddleware := auth.JWTAuth(testKeys, denylist)
+	r.GET("/users", authMiddleware, auth.RequirePermission(auth.PermUsersList), h.List)
+	r.GET("/users/:object_id", authMiddleware, h.Get)
+	r.PUT("/users/:object_id", authMiddleware, h.Update)
+	r.PATCH("/users/:object_id", authMiddleware, h.Patch)
+	r.DELETE("/users/:object_id", authMiddleware, h.Delete)
+	r.POST("/users/logout", authMiddleware, h.Logout)
+	r.POST("/users/:object_id/sessions/revoke-all", authMiddleware, h.RevokeSessions)
+	r.POST("/users/:object_id/restore", authMiddleware, auth.RequirePermission(auth.PermUsersRestore), h.Restore)
+	r.POST("/users/:object_id/mfa/enroll", authMiddleware, mh.Enroll)
+	r.POST("/users/:object_id/mfa/confirm", authMiddleware, mh.Confirm)
+	r.POST("/users/:object_id/roles", authMiddleware, auth.RequirePermission(auth.PermRolesManage), rh.Grant)
+	r.DELETE("/users/:object_id/roles/:role", authMiddleware, auth.RequirePermission(auth.PermRolesManage), rh.Revoke)
 	return r
 }
 
+// grantRole gives the user a role straight in the database and returns a refreshed access token carrying it.
+func grantRole(t *testing.T, db dal.Conn, router *gin.Engine, user model.CreateUserResponse, role string) string {
+	_, err := db.Exec(context.Background(), `
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r WHERE u.object_id = $1 AND r.name = $2`, user.ObjectId, role)
+	require.NoError(t, err)
+	return refreshAccessToken(t, router, user.RefreshToken)
+}
+
+func refreshAccessToken(t *testing.T, router *gin.Engine, refreshToken string) string {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{"refresh_token":"`+refreshToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var pair model.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+	return pair.AccessToken
+}
+
+func createUser(t *testing.T, router *gin.Engine, body string) model.CreateUserResponse {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created model.CreateUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created
+}
+
 func TestUserHandler_CRUD(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	dbURL := os.Getenv("DATABASE_URL")
@@ -59,27 +147,29 @@ func TestUserHandler_CRUD(t *testing.T) {
 
 	router := setupRouter(db)
 
-	createBody := `{"first_name":"Alice","last_name":"Smith","email":"alice@example.com","password":"test_pass"}`
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(createBody))
-	req.Header.Set("Content-Type", "application/json")
-	router.ServeHTTP(w, req)
-	assert.Equal(t, http.StatusCreated, w.Code)
-
-	var created model.UserResponse
-	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	created := createUser(t, router, `{"first_name":"Alice","last_name":"Smith","email":"alice@example.com","password":"test_pass"}`)
 	assert.Equal(t, "Alice", created.FirstName)
-	assert.Equal(t, "Smith", created.LastName)
+	require.NotNil(t, created.LastName)
+	assert.Equal(t, "Smith", *created.LastName)
 	assert.Equal(t, "alice@example.com", created.Email)
 	objID := created.ObjectId
+	bearer := "Bearer " + created.AccessToken
 
 	_, err = uuid.Parse(created.ObjectId)
 	assert.NoError(t, err)
+	// 2) GET
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/"+objID, nil)
+	req.Header.Set("Authorization", bearer)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
 	// 3) UPDATE
-	updateBody := `{"first_name":"Alicia"}`
+	updateBody := `{"first_name":"Alicia","last_name":"Smith","email":"alice@example.com"}`
 	w = httptest.NewRecorder()
 	req = httptest.NewRequest("PUT", "/users/"+objID, bytes.NewBufferString(updateBody))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bearer)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
@@ -90,12 +180,450 @@ func TestUserHandler_CRUD(t *testing.T) {
 	// 4) DELETE
 	w = httptest.NewRecorder()
 	req = httptest.NewRequest("DELETE", "/users/"+objID, nil)
+	req.Header.Set("Authorization", bearer)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNoContent, w.Code)
 
-	// 5) GET again → 404
+	// 5) GET again → 401, deleting a user revokes their tokens
 	w = httptest.NewRecorder()
 	req = httptest.NewRequest("GET", "/users/"+objID, nil)
+	req.Header.Set("Authorization", bearer)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUserHandler_ErrorsAreProblems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	body := `{"first_name":"Dup","email":"dup@example.com","password":"test_pass"}`
+	created := createUser(t, router, body)
+
+	problem := func(w *httptest.ResponseRecorder) apperr.Problem {
+		assert.Equal(t, apperr.ContentType, w.Header().Get("Content-Type"))
+		var p apperr.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, w.Code, p.Status)
+		return p
+	}
+
+	// the unique violation on users.email becomes a conflict rather than a 500
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "email_taken", problem(w).Code)
+
+	// a malformed object id names no user
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/users/not-a-uuid", nil)
+	req.Header.Set("Authorization", "Bearer "+created.AccessToken)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "user_not_found", problem(w).Code)
+
+	// an empty body
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/users/login", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "empty_body", problem(w).Code)
+}
+
+func TestUserHandler_ConditionalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Etag","email":"etag@example.com","password":"test_pass"}`)
+	path := "/users/" + created.ObjectId
+	do := func(method string, header http.Header, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header = header
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+created.AccessToken)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("GET", http.Header{}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	// — a client that already holds the current version gets no body
+	w = do("GET", http.Header{"If-None-Match": {`W/"1"`}}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = do("PUT", http.Header{"If-Match": {`"1"`}}, `{"first_name":"Renamed","email":"etag@example.com"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// — a second write based on the same read is refused
+	w = do("PUT", http.Header{"If-Match": {`"1"`}}, `{"first_name":"Clobbered","email":"etag@example.com"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	var p apperr.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "version_mismatch", p.Code)
+
+	w = do("GET", http.Header{"If-None-Match": {`"1"`}}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got model.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "Renamed", got.FirstName)
+
+	w = do("DELETE", http.Header{"If-Match": {`"1"`}}, "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = do("DELETE", http.Header{"If-Match": {"*"}}, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestUserHandler_Patch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Pat","last_name":"Cher","email":"pat@example.com","password":"test_pass"}`)
+	do := func(contentType string, header http.Header, body string) (*httptest.ResponseRecorder, model.UserResponse, apperr.Problem) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PATCH", "/users/"+created.ObjectId, bytes.NewBufferString(body))
+		req.Header = header
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+created.AccessToken)
+		router.ServeHTTP(w, req)
+		var user model.UserResponse
+		var p apperr.Problem
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		} else {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		}
+		return w, user, p
+	}
+
+	// — a merge patch null clears the last name and leaves the rest alone
+	w, user, _ := do("application/merge-patch+json", http.Header{"If-Match": {`"1"`}}, `{"last_name":null}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, "Pat", user.FirstName)
+	assert.Nil(t, user.LastName)
+	assert.Equal(t, "pat@example.com", user.Email)
+
+	w, user, _ = do("application/json-patch+json", http.Header{},
+		`[{"op":"test","path":"/last_name","value":null},{"op":"replace","path":"/last_name","value":"Cher"}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, user.LastName)
+	assert.Equal(t, "Cher", *user.LastName)
+
+	// — plain JSON is refused with the formats that are accepted
+	w, _, p := do("application/json", http.Header{}, `{"first_name":"Nope"}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", w.Header().Get("Accept-Patch"))
+	assert.Equal(t, "unsupported_patch_type", p.Code)
+
+	// — fields outside the allowlist, failed tests and invalid results change nothing
+	w, _, p = do("application/merge-patch+json", http.Header{}, `{"roles":["admin"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []apperr.FieldError{{Field: "roles", Code: "not_allowed", Message: "cannot be changed"}}, p.Errors)
+	w, _, p = do("application/json-patch+json", http.Header{}, `[{"op":"test","path":"/first_name","value":"Bob"}]`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "patch_conflict", p.Code)
+	w, _, p = do("application/merge-patch+json", http.Header{}, `{"email":"not an address"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "validation_failed", p.Code)
+	w, _, _ = do("application/merge-patch+json", http.Header{"If-Match": {`"1"`}}, `{"first_name":"Late"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// — bodies are capped like JSON bodies elsewhere
+	w, _, p = do("application/merge-patch+json", http.Header{}, `{"first_name":"`+strings.Repeat("a", 1<<20)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "body_too_large", p.Code)
+}
+
+func TestUserHandler_ValidationErrorsListFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	send := func(method, path, token, body string) (int, apperr.Problem) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		var p apperr.Problem
+		_ = json.Unmarshal(w.Body.Bytes(), &p)
+		return w.Code, p
+	}
+
+	code, p := send("POST", "/users", "", `{"first_name":"","email":"Val <val@example.com>","password":"password"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "first_name", Code: "required", Message: "is required"},
+		{Field: "email", Code: "email_address", Message: "must be a valid email address"},
+		{Field: "password", Code: "password", Message: "must be 8 to 64 characters and contain a letter and a digit or symbol"},
+	}, p.Errors)
+
+	code, p = send("POST", "/users", "", `{"first_name":7,"email":"val@example.com","password":"test_pass"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, []apperr.FieldError{{Field: "first_name", Code: "type", Message: "must be a string"}}, p.Errors)
+
+	// emails are stored lowercased, so any casing logs in
+	created := createUser(t, router, `{"first_name":"Vera","email":" Vera@Example.com ","password":"test_pass"}`)
+	assert.Equal(t, "vera@example.com", created.Email)
+	code, _ = send("POST", "/users/login", "", `{"email":"VERA@example.com","password":"test_pass"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, p = send("PUT", "/users/"+created.ObjectId, created.AccessToken, `{"first_name":"  ","email":"vera@example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "first_name", p.Errors[0].Field)
+}
+
+func TestUserHandler_SoftDeleteAndRestore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	admin := createUser(t, router, `{"first_name":"Ada","email":"ada@example.com","password":"test_pass"}`)
+	admin.AccessToken = grantRole(t, db, router, admin, auth.RoleAdmin)
+	gone := createUser(t, router, `{"first_name":"Gus","email":"gus@example.com","password":"test_pass"}`)
+	peer := createUser(t, router, `{"first_name":"Pia","email":"pia@example.com","password":"test_pass"}`)
+
+	do := func(method, path, bearer, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, do("DELETE", "/users/"+gone.ObjectId, gone.AccessToken, ""))
+
+	// the row is kept but invisible, including to login
+	var deletedAt *time.Time
+	require.NoError(t, db.QueryRow(context.Background(),
+		`SELECT deleted_at FROM users WHERE object_id = $1 AND is_deleted`, gone.ObjectId).Scan(&deletedAt))
+	assert.NotNil(t, deletedAt)
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/users/login", "", `{"email":"gus@example.com","password":"test_pass"}`))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/users/"+gone.ObjectId, admin.AccessToken, ""))
+
+	// only callers holding users:restore can restore
+	assert.Equal(t, http.StatusForbidden, do("POST", "/users/"+gone.ObjectId+"/restore", peer.AccessToken, ""))
+	assert.Equal(t, http.StatusNotFound, do("POST", "/users/"+peer.ObjectId+"/restore", admin.AccessToken, ""))
+	assert.Equal(t, http.StatusOK, do("POST", "/users/"+gone.ObjectId+"/restore", admin.AccessToken, ""))
+	assert.Equal(t, http.StatusOK, do("POST", "/users/login", "", `{"email":"gus@example.com","password":"test_pass"}`))
+
+	// the purger only removes users deleted before the retention window
+	require.Equal(t, http.StatusNoContent, do("DELETE", "/users/"+peer.ObjectId, peer.AccessToken, ""))
+	countPeer := func() int {
+		var n int
+		require.NoError(t, db.QueryRow(context.Background(),
+			`SELECT count(*) FROM users WHERE object_id = $1`, peer.ObjectId).Scan(&n))
+		return n
+	}
+	_, err = service.NewUserPurger(dal.NewUserRepository(db), time.Hour).Purge(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, countPeer())
+	_, err = service.NewUserPurger(dal.NewUserRepository(db), -time.Minute).Purge(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, countPeer())
+	assert.Equal(t, http.StatusNotFound, do("POST", "/users/"+peer.ObjectId+"/restore", admin.AccessToken, ""))
+}
+
+func TestUserHandler_Ownership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbURL := os.Getenv("DATABASE_URL")
+
+	db, err := dal.NewPostgresDB(dbURL, 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	owner := createUser(t, router, `{"first_name":"Owner","email":"owner@example.com","password":"test_pass"}`)
+	other := createUser(t, router, `{"first_name":"Other","email":"other@example.com","password":"test_pass"}`)
+
+	tests := []struct {
+		name   string
+		method string
+		suffix string
+		body   string
+		header string
+		want   int
+	}{
+		{"get without token", "GET", "", "", "", http.StatusUnauthorized},
+		{"update without token", "PUT", "", `{"first_name":"Mallory","email":"owner@example.com"}`, "", http.StatusUnauthorized},
+		{"delete without token", "DELETE", "", "", "", http.StatusUnauthorized},
+		{"revoke-all without token", "POST", "/sessions/revoke-all", "", "", http.StatusUnauthorized},
+		{"get as other user", "GET", "", "", "Bearer " + other.AccessToken, http.StatusForbidden},
+		{"update as other user", "PUT", "", `{"first_name":"Mallory","email":"owner@example.com"}`, "Bearer " + other.AccessToken, http.StatusForbidden},
+		{"delete as other user", "DELETE", "", "", "Bearer " + other.AccessToken, http.StatusForbidden},
+		{"revoke-all as other user", "POST", "/sessions/revoke-all", "", "Bearer " + other.AccessToken, http.StatusForbidden},
+		{"get as owner", "GET", "", "", "Bearer " + owner.AccessToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/users/"+owner.ObjectId+tt.suffix, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	// the owner's record is untouched by the rejected calls
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/users/"+owner.ObjectId, nil)
+	req.Header.Set("Authorization", "Bearer "+owner.AccessToken)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got model.UserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "Owner", got.FirstName)
+}
+
+func TestAuthHandler_RefreshRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbURL := os.Getenv("DATABASE_URL")
+
+	db, err := dal.NewPostgresDB(dbURL, 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	createUser(t, router, `{"first_name":"Rita","email":"rita@example.com","password":"test_pass"}`)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/users/login", bytes.NewBufferString(`{"email":"rita@example.com","password":"test_pass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var login model.TokenPair
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	refresh := func(token string) (int, model.TokenPair) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{"refresh_token":"`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		var pair model.TokenPair
+		_ = json.Unmarshal(w.Body.Bytes(), &pair)
+		return w.Code, pair
+	}
+
+	// first use rotates the token
+	code, rotated := refresh(login.RefreshToken)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, login.RefreshToken, rotated.RefreshToken)
+
+	// replaying the rotated-out token is rejected and revokes the family
+	code, _ = refresh(login.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(rotated.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// wrong password
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/users/login", bytes.NewBufferString(`{"email":"rita@example.com","password":"nope_nope"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUserHandler_LogoutAndRevokeAll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbURL := os.Getenv("DATABASE_URL")
+
+	db, err := dal.NewPostgresDB(dbURL, 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Lou","email":"lou@example.com","password":"test_pass"}`)
+
+	login := func() model.TokenPair {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/users/login", bytes.NewBufferString(`{"email":"lou@example.com","password":"test_pass"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var pair model.TokenPair
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pair))
+		return pair
+	}
+	do := func(method, path, token, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// logout revokes only the presented access token and its refresh token family
+	session := login()
+	assert.Equal(t, http.StatusNoContent, do("POST", "/users/logout", session.AccessToken, `{"refresh_token":"`+session.RefreshToken+`"}`))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/"+created.ObjectId, session.AccessToken, ""))
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/auth/refresh", "", `{"refresh_token":"`+session.RefreshToken+`"}`))
+	assert.Equal(t, http.StatusOK, do("GET", "/users/"+created.ObjectId, created.AccessToken, ""))
+
+	// revoke-all signs out every session, including the caller's
+	assert.Equal(t, http.StatusNoContent, do("POST", "/users/"+created.ObjectId+"/sessions/revoke-all", created.AccessToken, ""))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/"+created.ObjectId, created.AccessToken, ""))
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/auth/refresh", "", `{"refresh_token":"`+created.RefreshToken+`"}`))
+}
+
+func TestUserHandler_LoginLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	createUser(t, router, `{"first_name":"Lou","email":"lockout@example.com","password":"test_pass"}`)
+	login := func(password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/users/login", bytes.NewBufferString(`{"email":"lockout@example.com","password":"`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < service.DefaultLockoutPolicy.Threshold; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("wrong_pass").Code)
+	}
+	w := login("test_pass")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// lifting the lock lets the right password in and clears the count
+	_, err = db.Exec(context.Background(), `UPDATE users SET locked_until = now() WHERE email = 'lockout@example.com'`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, login("test_pass").Code)
+	var attempts int
+	require.NoError(t, db.QueryRow(context.Background(),
+		`SELECT failed_login_attempts FROM users WHERE email = 'lockout@example.com'`).Scan(&attempts))
+	assert.Zero(t, attempts)
 }
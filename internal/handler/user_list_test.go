@@ -0,0 +1,113 @@
+package handler_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestUserHandler_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	admin := createUser(t, router, `{"first_name":"Lis","email":"admin-lister@example.com","password":"test_pass"}`)
+	admin.AccessToken = grantRole(t, db, router, admin, auth.RoleSupport)
+
+	start := time.Now().Add(-time.Second)
+	var emails []string
+	for i := 0; i < 5; i++ {
+		email := fmt.Sprintf("list%d@example.com", i)
+		emails = append(emails, email)
+		createUser(t, router, fmt.Sprintf(`{"first_name":"Row%d","last_name":"Lister","email":"%s","password":"test_pass"}`, i, email))
+	}
+	doomed := createUser(t, router, `{"first_name":"Gone","email":"list-gone@example.com","password":"test_pass"}`)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/users/"+doomed.ObjectId, nil)
+	req.Header.Set("Authorization", "Bearer "+doomed.AccessToken)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	list := func(bearer string, params url.Values) (int, model.ListUsersResponse) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		router.ServeHTTP(w, req)
+		var page model.ListUsersResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		}
+		return w.Code, page
+	}
+	collect := func(params url.Values) []string {
+		var got []string
+		for {
+			code, page := list(admin.AccessToken, params)
+			require.Equal(t, http.StatusOK, code)
+			for _, u := range page.Users {
+				got = append(got, u.Email)
+			}
+			if page.NextCursor == "" {
+				return got
+			}
+			params.Set("cursor", page.NextCursor)
+		}
+	}
+
+	// — keyset pages cover every match exactly once, in order
+	assert.Equal(t, emails, collect(url.Values{"email_prefix": {"list"}, "limit": {"2"}}))
+	reversed := []string{emails[4], emails[3], emails[2], emails[1], emails[0]}
+	assert.Equal(t, reversed, collect(url.Values{"email_prefix": {"list"}, "limit": {"2"}, "sort": {"-email"}}))
+
+	// — filters
+	assert.Equal(t, emails, collect(url.Values{"name": {"lister"}, "created_after": {start.Format(time.RFC3339)}}))
+	assert.Empty(t, collect(url.Values{"email_prefix": {"list"}, "created_before": {start.Format(time.RFC3339)}}))
+	assert.Equal(t, []string{"list-gone@example.com"}, collect(url.Values{"email_prefix": {"list"}, "deleted": {"true"}}))
+	assert.Len(t, collect(url.Values{"email_prefix": {"list"}, "deleted": {"any"}}), 6)
+
+	// — bad requests and non-admins
+	code, _ := list(admin.AccessToken, url.Values{"sort": {"password_hash"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = list(admin.AccessToken, url.Values{"limit": {"1000"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/users?limit=ten&created_after=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer "+admin.AccessToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var p apperr.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "limit", Code: "invalid", Message: "is not a valid value"},
+		{Field: "created_after", Code: "invalid", Message: "is not a valid value"},
+	}, p.Errors, "parameters that do not parse are named without the parser's error")
+	code, _ = list(admin.AccessToken, url.Values{"cursor": {"garbage"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, page := list(admin.AccessToken, url.Values{"email_prefix": {"list"}, "limit": {"1"}})
+	code, _ = list(admin.AccessToken, url.Values{"cursor": {page.NextCursor}, "sort": {"email"}})
+	assert.Equal(t, http.StatusBadRequest, code, "a cursor only resumes the sort order it came from")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"created_at","v":"yesterday","id":1}`))
+	code, _ = list(admin.AccessToken, url.Values{"cursor": {tampered}})
+	assert.Equal(t, http.StatusBadRequest, code, "a cursor value that is not a time never reaches the query")
+
+	other := createUser(t, router, `{"first_name":"Nope","email":"nolist@example.com","password":"test_pass"}`)
+	code, _ = list(other.AccessToken, url.Values{})
+	assert.Equal(t, http.StatusForbidden, code)
+}
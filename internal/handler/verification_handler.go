@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/service"
+)
+
+type VerificationHandler struct {
+	Svc *service.VerificationService
+}
+
+func NewVerificationHandler(svc *service.VerificationService) *VerificationHandler {
+	return &VerificationHandler{Svc: svc}
+}
+
+// VerifyEmail is the target of the emailed link, so the token arrives as a query parameter.
+func (h *VerificationHandler) VerifyEmail(ctx *gin.Context) {
+	var params model.VerifyEmailParams
+	if !bindQuery(ctx, &params) {
+		return
+	}
+	err := h.Svc.Verify(ctx, params.Token)
+	if err != nil {
+		fail(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": "verified"})
+}
@@ -0,0 +1,78 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestVerificationHandler_VerifyEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := dal.NewPostgresDB(os.Getenv("DATABASE_URL"), 25, 5*time.Minute)
+	require.NoError(t, err)
+	defer db.GetPool().Close()
+
+	router := setupRouter(db)
+	created := createUser(t, router, `{"first_name":"Val","email":"val@example.com","password":"val_password"}`)
+	assert.False(t, created.EmailVerified)
+	bearer := "Bearer " + created.AccessToken
+
+	verify := func(token string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/users/verify-email?token="+token, nil))
+		return w.Code
+	}
+	get := func() model.UserResponse {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/users/"+created.ObjectId, nil)
+		req.Header.Set("Authorization", bearer)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp model.UserResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// signup mails a link for the signup address
+	assert.Equal(t, http.StatusBadRequest, verify(""))
+	assert.Equal(t, http.StatusBadRequest, verify("bogus"))
+	signupToken := lastMailedToken(t, "val@example.com")
+	assert.Equal(t, http.StatusOK, verify(signupToken))
+	assert.Equal(t, http.StatusBadRequest, verify(signupToken))
+	assert.True(t, get().EmailVerified)
+
+	// an email change is staged until the new address confirms it
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/users/"+created.ObjectId, bytes.NewBufferString(`{"first_name":"Val","email":"valerie@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bearer)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	staged := get()
+	assert.Equal(t, "val@example.com", staged.Email)
+	require.NotNil(t, staged.PendingEmail)
+	assert.Equal(t, "valerie@example.com", *staged.PendingEmail)
+
+	assert.Equal(t, http.StatusOK, verify(lastMailedToken(t, "valerie@example.com")))
+	changed := get()
+	assert.Equal(t, "valerie@example.com", changed.Email)
+	assert.Nil(t, changed.PendingEmail)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/users/login", bytes.NewBufferString(`{"email":"valerie@example.com","password":"val_password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,114 @@
+// Package health runs the dependency checks behind the readiness probe.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout bounds each check when the Checker is built without one.
+const DefaultTimeout = 2 * time.Second
+
+// Check probes one dependency. The detail, when not nil, is reported alongside the check's status whether
+// or not the check failed.
+type Check func(ctx context.Context) (detail any, err error)
+
+// Result is the outcome of a single check. The probe is unauthenticated, so a failing check's error is only
+// logged and never reported.
+type Result struct {
+	Status string `json:"status"`
+	Detail any    `json:"detail,omitempty"`
+}
+
+// Report is the outcome of every registered check. Status is ok only when every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker holds the registered checks. Dependencies register their own checks as they are wired up.
+type Checker struct {
+	timeout time.Duration
+	mu      sync.RWMutex
+	names   []string
+	checks  map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Register adds a check under name, replacing any check already registered with that name.
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs every check concurrently, each bounded by the checker's timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, names[i], check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+		report.Checks[name] = results[i]
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, name string, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan Result, 1)
+	go func() {
+		detail, err := check(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Warn("readiness check failed", "check", name, "error", err)
+			done <- Result{Status: StatusFail, Detail: detail}
+			return
+		}
+		done <- Result{Status: StatusOK, Detail: detail}
+	}()
+	// a check that ignores its context must not hold up the probe
+	select {
+	case r := <-done:
+		return r
+	case <-ctx.Done():
+		logging.FromContext(ctx).Warn("readiness check failed", "check", name, "error", ctx.Err())
+		return Result{Status: StatusFail}
+	}
+}
@@ -0,0 +1,69 @@
+package health_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/health"
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+func TestChecker_AllPassing(t *testing.T) {
+	c := health.NewChecker(time.Second)
+	c.Register("a", func(ctx context.Context) (any, error) { return map[string]int{"n": 1}, nil })
+	c.Register("b", func(ctx context.Context) (any, error) { return nil, nil })
+
+	report := c.Run(context.Background())
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, health.Result{Status: health.StatusOK, Detail: map[string]int{"n": 1}}, report.Checks["a"])
+	assert.Equal(t, health.Result{Status: health.StatusOK}, report.Checks["b"])
+}
+
+func TestChecker_FailingCheckFailsReport(t *testing.T) {
+	c := health.NewChecker(time.Second)
+	c.Register("ok", func(ctx context.Context) (any, error) { return nil, nil })
+	c.Register("bad", func(ctx context.Context) (any, error) { return "detail", errors.New("boom") })
+
+	var buf bytes.Buffer
+	report := c.Run(logging.WithLogger(context.Background(), logging.New(&buf, slog.LevelDebug)))
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["ok"].Status)
+	assert.Equal(t, health.Result{Status: health.StatusFail, Detail: "detail"}, report.Checks["bad"])
+	// the error stays in the server's log rather than the public report
+	assert.Contains(t, buf.String(), `"check":"bad"`)
+	assert.Contains(t, buf.String(), `"error":"boom"`)
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := health.NewChecker(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	c.Register("stuck", func(ctx context.Context) (any, error) {
+		<-block
+		return nil, nil
+	})
+
+	var buf bytes.Buffer
+	start := time.Now()
+	report := c.Run(logging.WithLogger(context.Background(), logging.New(&buf, slog.LevelDebug)))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, health.Result{Status: health.StatusFail}, report.Checks["stuck"])
+	assert.Contains(t, buf.String(), context.DeadlineExceeded.Error())
+}
+
+func TestChecker_RegisterReplaces(t *testing.T) {
+	c := health.NewChecker(time.Second)
+	c.Register("a", func(ctx context.Context) (any, error) { return nil, errors.New("old") })
+	c.Register("a", func(ctx context.Context) (any, error) { return nil, nil })
+
+	report := c.Run(context.Background())
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Len(t, report.Checks, 1)
+}
@@ -0,0 +1,99 @@
+// Package logging provides the service's structured logger. Loggers travel in the request context so every
+// line logged while serving a request carries its request id, trace id and, once authenticated, user id.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+type loggerKey struct{}
+
+// New returns a JSON logger that redacts sensitive attributes.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact}))
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger has args added to it.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// Redacted replaces the value of attributes whose key names a secret.
+const Redacted = "[REDACTED]"
+
+// secretKeys are attribute keys, lowercased, whose values are never logged.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"new_password":  true,
+	"password_hash": true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"mfa_token":     true,
+	"code":          true,
+	"secret":        true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// redact blanks secrets by key and masks anything that looks like an email address, whatever its key, down
+// to its domain. Addresses are masked wherever they appear in a string, so ones quoted inside an error
+// message are caught too. Errors and Stringers are masked in the text form they are logged as.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	if s, ok := text(a.Value.Resolve()); ok && strings.IndexByte(s, '@') >= 0 {
+		return slog.String(a.Key, maskEmails(s))
+	}
+	return a
+}
+
+// text returns the text a value is logged as, when it is logged as text.
+func text(v slog.Value) (string, bool) {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String(), true
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return x.Error(), true
+		case fmt.Stringer:
+			return x.String(), true
+		}
+	}
+	return "", false
+}
+
+// emailPattern matches an email address within a longer string, capturing its domain. Quotes, brackets and
+// punctuation that commonly surround an address are not part of it.
+var emailPattern = regexp.MustCompile(`[^\s@"'<>()\[\],;:]+@([^\s@"'<>()\[\],;:]+\.[^\s@"'<>()\[\],;:]+)`)
+
+func maskEmails(s string) string {
+	return emailPattern.ReplaceAllString(s, "***@$1")
+}
@@ -0,0 +1,180 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+// lines decodes every JSON log line written to buf.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &m))
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestNew_RedactsSecretsAndEmails(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo)
+
+	logger.Info("login",
+		"password", "hunter2",
+		"Refresh_Token", "abc",
+		slog.Group("input", "email", "jane@doe.com", "code", "123456"),
+		"to", "bob@example.org",
+		"note", "mail me @ home",
+		"error", `create: email "jane@doe.com" is taken, ask <bob@example.org>`,
+		"user_id", "42",
+	)
+
+	entry := lines(t, &buf)[0]
+	assert.Equal(t, logging.Redacted, entry["password"])
+	assert.Equal(t, logging.Redacted, entry["Refresh_Token"])
+	assert.Equal(t, map[string]any{"email": "***@doe.com", "code": logging.Redacted}, entry["input"])
+	assert.Equal(t, "***@example.org", entry["to"])
+	assert.Equal(t, "mail me @ home", entry["note"])
+	assert.Equal(t, `create: email "***@doe.com" is taken, ask <***@example.org>`, entry["error"], "addresses inside a string are masked too")
+	assert.Equal(t, "42", entry["user_id"])
+}
+
+// recipient is a LogValuer that resolves to an email address.
+type recipient string
+
+func (r recipient) LogValue() slog.Value { return slog.StringValue(string(r)) }
+
+// mailbox is a Stringer that is not an error.
+type mailbox struct{ addr string }
+
+func (m mailbox) String() string { return "<" + m.addr + ">" }
+
+func TestNew_MasksEmailsInErrorsAndStringers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo)
+
+	logger.Info("mail failed",
+		"error", fmt.Errorf("send to jane@doe.com failed"),
+		"mailbox", mailbox{"bob@example.org"},
+		"to", recipient("ann@example.net"),
+		"cause", errors.New("connection refused"),
+	)
+
+	entry := lines(t, &buf)[0]
+	assert.Equal(t, "send to ***@doe.com failed", entry["error"])
+	assert.Equal(t, "<***@example.org>", entry["mailbox"])
+	assert.Equal(t, "***@example.net", entry["to"])
+	assert.Equal(t, "connection refused", entry["cause"], "values without an address are left alone")
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), logging.FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), logging.New(&buf, slog.LevelInfo))
+	ctx = logging.With(ctx, "user_id", "7")
+	logging.FromContext(ctx).Info("hello")
+	assert.Equal(t, "7", lines(t, &buf)[0]["user_id"])
+}
+
+func TestMiddleware_RequestIDAndAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(logging.Middleware(logging.New(&buf, slog.LevelInfo)))
+	r.GET("/users/:object_id", func(ctx *gin.Context) {
+		// what an auth middleware does once it knows the caller
+		ctx.Request = ctx.Request.WithContext(logging.With(ctx.Request.Context(), "user_id", "9"))
+		logging.FromContext(ctx.Request.Context()).Info("inside handler")
+		ctx.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/users/abc", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "req-123", w.Header().Get(logging.RequestIDHeader))
+
+	entries := lines(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "inside handler", entries[0]["msg"])
+	assert.Equal(t, "req-123", entries[0]["request_id"])
+	access := entries[1]
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "req-123", access["request_id"])
+	assert.Equal(t, "9", access["user_id"])
+	assert.Equal(t, "/users/:object_id", access["route"])
+	assert.Equal(t, float64(http.StatusNoContent), access["status"])
+	assert.Contains(t, access, "latency_ms")
+}
+
+func TestMiddleware_MasksEmailsInErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(logging.Middleware(logging.New(&buf, slog.LevelInfo)))
+	r.POST("/users", func(ctx *gin.Context) {
+		_ = ctx.Error(fmt.Errorf("create user: %w", fmt.Errorf("email %q is taken", "jane@doe.com")))
+		ctx.Status(http.StatusConflict)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+	access := lines(t, &buf)[0]
+	assert.Contains(t, access["error"], `"***@doe.com"`)
+	assert.NotContains(t, access["error"], "jane")
+}
+
+func TestMiddleware_ReplacesUnusableRequestIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logging.Middleware(logging.New(&bytes.Buffer{}, slog.LevelInfo)))
+	r.GET("/", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	for _, sent := range []string{"", "has space", strings.Repeat("x", 129)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if sent != "" {
+			req.Header.Set(logging.RequestIDHeader, sent)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		_, err := uuid.Parse(w.Header().Get(logging.RequestIDHeader))
+		assert.NoErrorf(t, err, "sent %q", sent)
+	}
+}
+
+func TestRecovery_LogsPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(logging.Middleware(logging.New(&buf, slog.LevelInfo)), logging.Recovery())
+	r.GET("/", func(ctx *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	entries := lines(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "boom", entries[0]["panic"])
+	assert.Equal(t, "ERROR", entries[1]["level"])
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+)
+
+// RequestIDHeader carries the request id in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds ids accepted from clients so they cannot bloat every log line.
+const maxRequestIDLength = 128
+
+// Middleware tags the request with an id, taken from X-Request-ID when the client sent a usable one and
+// generated otherwise, echoes it back, and puts a logger carrying it in the request context. Once the
+// request is served it writes one access log line.
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		ctx.Header(RequestIDHeader, requestID)
+
+		l := logger.With("request_id", requestID)
+		if span := trace.SpanFromContext(ctx.Request.Context()); span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String("request.id", requestID))
+			l = l.With("trace_id", span.SpanContext().TraceID().String())
+		}
+		ctx.Request = ctx.Request.WithContext(WithLogger(ctx.Request.Context(), l))
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		attrs := []any{
+			"method", ctx.Request.Method,
+			"route", ctx.FullPath(),
+			"path", ctx.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", ctx.ClientIP(),
+			"bytes", ctx.Writer.Size(),
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, "error", ctx.Errors.String())
+		}
+		// the handler chain may have added attributes, such as the user id, to the request's logger
+		FromContext(ctx.Request.Context()).Log(ctx.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Recovery turns a panic in a handler into a 500 problem and logs it, with its stack, to the request's logger.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, recovered any) {
+		FromContext(ctx.Request.Context()).Error("panic serving request", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+		apperr.Abort(ctx, apperr.ErrInternal)
+	})
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers transactional email. Production deployments plug in a real provider; LogSender and
+// FileSender are meant for local development and tests.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender logs who every message is for instead of delivering it. Bodies are left out: they carry live
+// password reset and verification links, which would let anyone reading the logs use them. Use FileSender to
+// read the messages themselves.
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	logging.FromContext(ctx).Info("mail", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// FileSender writes each message to its own file in Dir so tests and developers can read it back.
+type FileSender struct {
+	Dir string
+}
+
+func NewFileSender(dir string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSender{Dir: dir}, nil
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), uuid.NewString())
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o644)
+}
+
+// Messages reads back every message written to Dir, oldest first.
+func (s *FileSender) Messages() ([]Message, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		headers, body, _ := strings.Cut(string(data), "\r\n\r\n")
+		msg := Message{Body: strings.TrimSuffix(body, "\r\n")}
+		for _, line := range strings.Split(headers, "\r\n") {
+			if v, ok := strings.CutPrefix(line, "To: "); ok {
+				msg.To = v
+			} else if v, ok := strings.CutPrefix(line, "Subject: "); ok {
+				msg.Subject = v
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
@@ -0,0 +1,38 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/mail"
+)
+
+func TestFileSender_RoundTrip(t *testing.T) {
+	sender, err := mail.NewFileSender(t.TempDir())
+	require.NoError(t, err)
+
+	first := mail.Message{To: "a@example.com", Subject: "Hello", Body: "line one\nline two"}
+	second := mail.Message{To: "b@example.com", Subject: "Again", Body: "body"}
+	require.NoError(t, sender.Send(context.Background(), first))
+	require.NoError(t, sender.Send(context.Background(), second))
+
+	got, err := sender.Messages()
+	require.NoError(t, err)
+	assert.Equal(t, []mail.Message{first, second}, got)
+}
+
+func TestLogSender_Send(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), logging.New(&buf, slog.LevelDebug))
+	var sender mail.Sender = mail.NewLogSender()
+	msg := mail.Message{To: "a@example.com", Subject: "Reset your password", Body: "https://x/reset?token=s3cret"}
+	require.NoError(t, sender.Send(ctx, msg))
+	assert.Contains(t, buf.String(), "Reset your password")
+	assert.NotContains(t, buf.String(), "s3cret", "bodies carry live tokens and are never logged")
+}
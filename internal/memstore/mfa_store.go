@@ -0,0 +1,119 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type recoveryCode struct {
+	codeHash string
+	usedAt   *time.Time
+}
+
+type MFARepo struct {
+	s *Store
+}
+
+func NewMFARepository(s *Store) repo.MFARepository {
+	return &MFARepo{s: s}
+}
+
+// Upsert stores a new enrollment, replacing an unconfirmed one. A confirmed enrollment is left alone and
+// reported as not found, as the guarded ON CONFLICT in dal is.
+func (r *MFARepo) Upsert(ctx context.Context, m *model.UserMFA) error {
+	if m.SecretCiphertext == nil {
+		return repo.ErrInvalid.Wrap(fmt.Errorf("secret_ciphertext is required"))
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !r.s.userExists(m.UserId) {
+		return errNoUser(m.UserId)
+	}
+	if existing, ok := r.s.mfa[m.UserId]; ok && existing.ConfirmedAt != nil {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("mfa already confirmed for user_id=%d", m.UserId))
+	}
+	row := &model.UserMFA{
+		UserId:           m.UserId,
+		SecretCiphertext: bytes.Clone(m.SecretCiphertext),
+		CreatedAt:        r.s.timestamp(),
+	}
+	r.s.mfa[m.UserId] = row
+	m.CreatedAt = row.CreatedAt
+	return nil
+}
+
+func (r *MFARepo) FindByUserId(ctx context.Context, userId int64) (*model.UserMFA, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	m, ok := r.s.mfa[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &model.UserMFA{
+		UserId:           m.UserId,
+		SecretCiphertext: bytes.Clone(m.SecretCiphertext),
+		ConfirmedAt:      timePtr(m.ConfirmedAt),
+		LastUsedStep:     int64Ptr(m.LastUsedStep),
+		CreatedAt:        m.CreatedAt,
+	}, nil
+}
+
+func (r *MFARepo) Confirm(ctx context.Context, userId int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	m, ok := r.s.mfa[userId]
+	if !ok || m.ConfirmedAt != nil {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no pending mfa enrollment for user_id=%d", userId))
+	}
+	now := r.s.timestamp()
+	m.ConfirmedAt = &now
+	return nil
+}
+
+func (r *MFARepo) UseStep(ctx context.Context, userId int64, step int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	m, ok := r.s.mfa[userId]
+	if !ok || (m.LastUsedStep != nil && *m.LastUsedStep >= step) {
+		return false, nil
+	}
+	m.LastUsedStep = &step
+	return true, nil
+}
+
+func (r *MFARepo) ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if len(codeHashes) > 0 && !r.s.userExists(userId) {
+		return errNoUser(userId)
+	}
+	codes := make([]*recoveryCode, 0, len(codeHashes))
+	seen := map[string]bool{}
+	for _, h := range codeHashes {
+		if seen[h] {
+			return repo.ErrConflict.Wrap(fmt.Errorf("duplicate recovery code for user_id=%d", userId))
+		}
+		seen[h] = true
+		codes = append(codes, &recoveryCode{codeHash: h})
+	}
+	r.s.recoveryCodes[userId] = codes
+	return nil
+}
+
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, c := range r.s.recoveryCodes[userId] {
+		if c.codeHash == codeHash && c.usedAt == nil {
+			now := r.s.timestamp()
+			c.usedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
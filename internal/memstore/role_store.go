@@ -0,0 +1,58 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RoleRepo struct {
+	s *Store
+}
+
+func NewRoleRepository(s *Store) repo.RoleRepository {
+	return &RoleRepo{s: s}
+}
+
+func (r *RoleRepo) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	perms := make(map[string][]string, len(r.s.roles))
+	for role, granted := range r.s.roles {
+		perms[role] = slices.Clone(granted)
+	}
+	return perms, nil
+}
+
+func (r *RoleRepo) Grant(ctx context.Context, userId int64, role string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.roles[role]; !ok {
+		return false, nil
+	}
+	u, ok := r.s.users[userId]
+	if !ok {
+		return false, errNoUser(userId)
+	}
+	if i, held := slices.BinarySearch(u.Roles, role); !held {
+		u.Roles = slices.Insert(u.Roles, i, role)
+		u.Version++
+	}
+	return true, nil
+}
+
+func (r *RoleRepo) Revoke(ctx context.Context, userId int64, role string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.users[userId]
+	if !ok {
+		return false, nil
+	}
+	i, held := slices.BinarySearch(u.Roles, role)
+	if held {
+		u.Roles = slices.Delete(u.Roles, i, i+1)
+		u.Version++
+	}
+	return held, nil
+}
@@ -0,0 +1,144 @@
+// Package memstore implements the repositories in process memory, for tests and for running the server
+// without Postgres. It mirrors the Postgres implementations in internal/dal, including their constraints
+// and the errors they return, and the conformance suite in internal/repo/repotest keeps the two in step.
+// Nothing is persisted.
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// Store holds every table. Repositories built on the same Store see each other's writes, the way
+// repositories sharing a database do, and a single lock makes each method atomic.
+type Store struct {
+	mu  sync.Mutex
+	now func() time.Time
+	// seq is the last id handed out per table, like a BIGSERIAL sequence.
+	seq map[string]int64
+
+	// users keep their granted roles in Roles, sorted.
+	users map[int64]*model.User
+	// roles maps each role to the permissions it grants, as seeded by the RBAC migration.
+	roles              map[string][]string
+	refreshTokens      map[int64]*model.RefreshToken
+	revocations        map[int64]*model.TokenRevocation
+	passwordResets     map[int64]*model.PasswordResetToken
+	emailVerifications map[int64]*model.EmailVerificationToken
+	mfa                map[int64]*model.UserMFA
+	// recoveryCodes are keyed by user id.
+	recoveryCodes map[int64][]*recoveryCode
+}
+
+// New returns an empty store with the roles and permissions the migrations create.
+func New() *Store {
+	return &Store{
+		now: time.Now,
+		seq: map[string]int64{},
+
+		users: map[int64]*model.User{},
+		roles: map[string][]string{
+			"admin":   {"roles:manage", "users:delete", "users:list", "users:read", "users:restore", "users:update"},
+			"support": {"users:list", "users:read"},
+			"user":    nil,
+		},
+		refreshTokens:      map[int64]*model.RefreshToken{},
+		revocations:        map[int64]*model.TokenRevocation{},
+		passwordResets:     map[int64]*model.PasswordResetToken{},
+		emailVerifications: map[int64]*model.EmailVerificationToken{},
+		mfa:                map[int64]*model.UserMFA{},
+		recoveryCodes:      map[int64][]*recoveryCode{},
+	}
+}
+
+// nextId advances the sequence of table. Callers hold s.mu.
+func (s *Store) nextId(table string) int64 {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+// timestamp is the current time at the microsecond precision Postgres stores. Callers hold s.mu.
+func (s *Store) timestamp() time.Time {
+	return s.now().Truncate(time.Microsecond)
+}
+
+// userExists stands in for a foreign key to users. Soft-deleted users still satisfy it. Callers hold s.mu.
+func (s *Store) userExists(userId int64) bool {
+	_, ok := s.users[userId]
+	return ok
+}
+
+// parseUUID rejects malformed ids the way a uuid column does and returns the canonical form Postgres
+// would read back.
+func parseUUID(id string) (string, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return "", repo.ErrInvalid.Wrap(fmt.Errorf("invalid uuid %q: %w", id, err))
+	}
+	return u.String(), nil
+}
+
+// deleteUser removes the user and every row that references it, as ON DELETE CASCADE does. Revocations
+// have no foreign key and outlive the user until they expire. Callers hold s.mu.
+func (s *Store) deleteUser(userId int64) {
+	delete(s.users, userId)
+	for id, t := range s.refreshTokens {
+		if t.UserId == userId {
+			delete(s.refreshTokens, id)
+		}
+	}
+	for id, t := range s.passwordResets {
+		if t.UserId == userId {
+			delete(s.passwordResets, id)
+		}
+	}
+	for id, t := range s.emailVerifications {
+		if t.UserId == userId {
+			delete(s.emailVerifications, id)
+		}
+	}
+	delete(s.mfa, userId)
+	delete(s.recoveryCodes, userId)
+}
+
+func errNoUser(userId int64) error {
+	return repo.ErrConflict.Wrap(fmt.Errorf("no user with id=%d", userId))
+}
+
+func timePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func stringPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+// deref reads a missing optional text column as empty, like the COALESCE dal sorts and searches by.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func int64Ptr(n *int64) *int64 {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	return &c
+}
@@ -0,0 +1,273 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type RefreshTokenRepo struct {
+	s *Store
+}
+
+func NewRefreshTokenRepository(s *Store) repo.RefreshTokenRepository {
+	return &RefreshTokenRepo{s: s}
+}
+
+func (r *RefreshTokenRepo) Create(ctx context.Context, t *model.RefreshToken) error {
+	familyId, err := parseUUID(t.FamilyId)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !r.s.userExists(t.UserId) {
+		return errNoUser(t.UserId)
+	}
+	for _, other := range r.s.refreshTokens {
+		if other.TokenHash == t.TokenHash {
+			return repo.ErrConflict.Wrap(fmt.Errorf("refresh token hash is taken by id=%d", other.Id))
+		}
+	}
+	row := &model.RefreshToken{
+		Id:        r.s.nextId("refresh_tokens"),
+		UserId:    t.UserId,
+		FamilyId:  familyId,
+		TokenHash: t.TokenHash,
+		ExpiresAt: t.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt: r.s.timestamp(),
+	}
+	r.s.refreshTokens[row.Id] = row
+	t.Id, t.CreatedAt = row.Id, row.CreatedAt
+	return nil
+}
+
+func (r *RefreshTokenRepo) FindByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, t := range r.s.refreshTokens {
+		if t.TokenHash == tokenHash {
+			c := *t
+			c.RotatedAt, c.RevokedAt = timePtr(t.RotatedAt), timePtr(t.RevokedAt)
+			return &c, nil
+		}
+	}
+	return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no refresh token with that hash"))
+}
+
+func (r *RefreshTokenRepo) MarkRotated(ctx context.Context, id int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	t, ok := r.s.refreshTokens[id]
+	if !ok || t.RotatedAt != nil || t.RevokedAt != nil {
+		return false, nil
+	}
+	now := r.s.timestamp()
+	t.RotatedAt = &now
+	return true, nil
+}
+
+func (r *RefreshTokenRepo) RevokeFamily(ctx context.Context, familyId string) error {
+	familyId, err := parseUUID(familyId)
+	if err != nil {
+		return err
+	}
+	r.revokeWhere(func(t *model.RefreshToken) bool { return t.FamilyId == familyId })
+	return nil
+}
+
+func (r *RefreshTokenRepo) RevokeAllForUser(ctx context.Context, userId int64) error {
+	r.revokeWhere(func(t *model.RefreshToken) bool { return t.UserId == userId })
+	return nil
+}
+
+func (r *RefreshTokenRepo) revokeWhere(match func(t *model.RefreshToken) bool) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := r.s.timestamp()
+	for _, t := range r.s.refreshTokens {
+		if match(t) && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+}
+
+type RevocationRepo struct {
+	s *Store
+}
+
+func NewRevocationRepository(s *Store) repo.RevocationRepository {
+	return &RevocationRepo{s: s}
+}
+
+func (r *RevocationRepo) Create(ctx context.Context, rev *model.TokenRevocation) error {
+	if rev.Jti == nil && rev.RevokedBefore == nil {
+		return repo.ErrInvalid.Wrap(fmt.Errorf("revocation needs a jti or revoked_before"))
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row := &model.TokenRevocation{
+		Id:        r.s.nextId("token_revocations"),
+		Jti:       stringPtr(rev.Jti),
+		UserId:    rev.UserId,
+		ExpiresAt: rev.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt: r.s.timestamp(),
+	}
+	if rev.RevokedBefore != nil {
+		before := rev.RevokedBefore.Truncate(time.Microsecond)
+		row.RevokedBefore = &before
+	}
+	r.s.revocations[row.Id] = row
+	rev.Id, rev.CreatedAt = row.Id, row.CreatedAt
+	return nil
+}
+
+func (r *RevocationRepo) ListSince(ctx context.Context, since time.Time) ([]*model.TokenRevocation, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := r.s.timestamp()
+	var revocations []*model.TokenRevocation
+	for _, rev := range r.s.revocations {
+		if !rev.CreatedAt.Before(since) && rev.ExpiresAt.After(now) {
+			c := *rev
+			c.Jti, c.RevokedBefore = stringPtr(rev.Jti), timePtr(rev.RevokedBefore)
+			revocations = append(revocations, &c)
+		}
+	}
+	slices.SortFunc(revocations, func(a, b *model.TokenRevocation) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return revocations, nil
+}
+
+func (r *RevocationRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, rev := range r.s.revocations {
+		if !rev.ExpiresAt.After(now) {
+			delete(r.s.revocations, id)
+		}
+	}
+	return nil
+}
+
+type PasswordResetRepo struct {
+	s *Store
+}
+
+func NewPasswordResetRepository(s *Store) repo.PasswordResetRepository {
+	return &PasswordResetRepo{s: s}
+}
+
+func (r *PasswordResetRepo) Create(ctx context.Context, t *model.PasswordResetToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !r.s.userExists(t.UserId) {
+		return errNoUser(t.UserId)
+	}
+	for _, other := range r.s.passwordResets {
+		if other.TokenHash == t.TokenHash {
+			return repo.ErrConflict.Wrap(fmt.Errorf("password reset token hash is taken by id=%d", other.Id))
+		}
+	}
+	row := &model.PasswordResetToken{
+		Id:        r.s.nextId("password_reset_tokens"),
+		UserId:    t.UserId,
+		TokenHash: t.TokenHash,
+		ExpiresAt: t.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt: r.s.timestamp(),
+	}
+	r.s.passwordResets[row.Id] = row
+	t.Id, t.CreatedAt = row.Id, row.CreatedAt
+	return nil
+}
+
+func (r *PasswordResetRepo) FindByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, t := range r.s.passwordResets {
+		if t.TokenHash == tokenHash {
+			c := *t
+			c.UsedAt = timePtr(t.UsedAt)
+			return &c, nil
+		}
+	}
+	return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no password reset token with that hash"))
+}
+
+func (r *PasswordResetRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	t, ok := r.s.passwordResets[id]
+	if !ok || t.UsedAt != nil {
+		return false, nil
+	}
+	now := r.s.timestamp()
+	t.UsedAt = &now
+	return true, nil
+}
+
+type EmailVerificationRepo struct {
+	s *Store
+}
+
+func NewEmailVerificationRepository(s *Store) repo.EmailVerificationRepository {
+	return &EmailVerificationRepo{s: s}
+}
+
+func (r *EmailVerificationRepo) Create(ctx context.Context, t *model.EmailVerificationToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !r.s.userExists(t.UserId) {
+		return errNoUser(t.UserId)
+	}
+	for _, other := range r.s.emailVerifications {
+		if other.TokenHash == t.TokenHash {
+			return repo.ErrConflict.Wrap(fmt.Errorf("email verification token hash is taken by id=%d", other.Id))
+		}
+	}
+	row := &model.EmailVerificationToken{
+		Id:        r.s.nextId("email_verification_tokens"),
+		UserId:    t.UserId,
+		Email:     t.Email,
+		TokenHash: t.TokenHash,
+		ExpiresAt: t.ExpiresAt.Truncate(time.Microsecond),
+		CreatedAt: r.s.timestamp(),
+	}
+	r.s.emailVerifications[row.Id] = row
+	t.Id, t.CreatedAt = row.Id, row.CreatedAt
+	return nil
+}
+
+func (r *EmailVerificationRepo) FindByHash(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, t := range r.s.emailVerifications {
+		if t.TokenHash == tokenHash {
+			c := *t
+			c.UsedAt = timePtr(t.UsedAt)
+			return &c, nil
+		}
+	}
+	return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no email verification token with that hash"))
+}
+
+func (r *EmailVerificationRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	t, ok := r.s.emailVerifications[id]
+	if !ok || t.UsedAt != nil {
+		return false, nil
+	}
+	now := r.s.timestamp()
+	t.UsedAt = &now
+	return true, nil
+}
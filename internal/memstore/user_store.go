@@ -0,0 +1,409 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type UserRepo struct {
+	s *Store
+}
+
+func NewUserRepository(s *Store) repo.UserRepository {
+	return &UserRepo{s: s}
+}
+
+// found copies a user as the Find methods read it: everything but the soft-delete columns.
+func found(u *model.User) *model.User {
+	c := *u
+	c.IsDeleted, c.DeletedAt = false, nil
+	c.EmailVerifiedAt = timePtr(u.EmailVerifiedAt)
+	c.LastName = stringPtr(u.LastName)
+	c.PendingEmail = stringPtr(u.PendingEmail)
+	c.LockedUntil = timePtr(u.LockedUntil)
+	c.Roles = slices.Clone(u.Roles)
+	return &c
+}
+
+// listed copies a user as List reads it, without credentials or login throttling state.
+func listed(u *model.User) *model.User {
+	return &model.User{
+		Id:              u.Id,
+		ObjectId:        u.ObjectId,
+		FirstName:       u.FirstName,
+		LastName:        stringPtr(u.LastName),
+		Email:           u.Email,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		EmailVerifiedAt: timePtr(u.EmailVerifiedAt),
+		PendingEmail:    stringPtr(u.PendingEmail),
+		Roles:           slices.Clone(u.Roles),
+		IsDeleted:       u.IsDeleted,
+		DeletedAt:       timePtr(u.DeletedAt),
+		Version:         u.Version,
+	}
+}
+
+// live returns the user unless it is missing or soft-deleted. Callers hold s.mu.
+func (r *UserRepo) live(userId int64) (*model.User, bool) {
+	u, ok := r.s.users[userId]
+	if !ok || u.IsDeleted {
+		return nil, false
+	}
+	return u, true
+}
+
+// byObjectId finds a user by object id, deleted or not. Callers hold s.mu.
+func (r *UserRepo) byObjectId(objectId string) (*model.User, error) {
+	objectId, err := parseUUID(objectId)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range r.s.users {
+		if u.ObjectId == objectId {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+// emailTaken enforces the unique email constraint, which soft-deleted users still hold. Callers hold s.mu.
+func (r *UserRepo) emailTaken(email string, exceptId int64) error {
+	for _, u := range r.s.users {
+		if u.Email == email && u.Id != exceptId {
+			return repo.ErrConflict.Wrap(fmt.Errorf("email is taken by id=%d", u.Id))
+		}
+	}
+	return nil
+}
+
+func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, u := range r.s.users {
+		if u.Email == email && !u.IsDeleted {
+			return found(u), nil
+		}
+	}
+	return nil, repo.ErrNotFound.Wrap(errors.New("no user with that email"))
+}
+
+func (r *UserRepo) FindById(ctx context.Context, id int64) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if u, ok := r.live(id); ok {
+		return found(u), nil
+	}
+	return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no user with id=%d", id))
+}
+
+func (r *UserRepo) FindByObjectId(ctx context.Context, objectId string) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, err := r.byObjectId(objectId)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.IsDeleted {
+		return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no user with object_id=%s", objectId))
+	}
+	return found(u), nil
+}
+
+// Create inserts the user and grants it u.Roles. Unknown role names are ignored.
+func (r *UserRepo) Create(ctx context.Context, u *model.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.emailTaken(u.Email, 0); err != nil {
+		return err
+	}
+	roles := []string{}
+	for _, role := range u.Roles {
+		if _, ok := r.s.roles[role]; ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+
+	now := r.s.timestamp()
+	row := &model.User{
+		Id:           r.s.nextId("users"),
+		ObjectId:     uuid.NewString(),
+		FirstName:    u.FirstName,
+		LastName:     stringPtr(u.LastName),
+		Email:        u.Email,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Roles:        roles,
+		Version:      1,
+	}
+	r.s.users[row.Id] = row
+	u.Id, u.ObjectId, u.CreatedAt, u.UpdatedAt, u.Version = row.Id, row.ObjectId, row.CreatedAt, row.UpdatedAt, row.Version
+	return nil
+}
+
+func (r *UserRepo) Update(ctx context.Context, u *model.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, ok := r.live(u.Id)
+	if !ok {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row updated for object_id=%s", u.ObjectId))
+	}
+	if row.Version != u.Version {
+		return repo.ErrStale.Wrap(fmt.Errorf("object_id=%s is at version %d, not %d", u.ObjectId, row.Version, u.Version))
+	}
+	if err := r.emailTaken(u.Email, u.Id); err != nil {
+		return err
+	}
+	row.FirstName = u.FirstName
+	row.LastName = stringPtr(u.LastName)
+	row.Email = u.Email
+	row.PendingEmail = stringPtr(u.PendingEmail)
+	row.UpdatedAt = r.s.timestamp()
+	row.Version++
+	u.Version = row.Version
+	return nil
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, userId int64, passwordHash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, ok := r.live(userId)
+	if !ok {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row updated for id=%d", userId))
+	}
+	row.PasswordHash = passwordHash
+	row.UpdatedAt = r.s.timestamp()
+	row.Version++
+	return nil
+}
+
+func (r *UserRepo) ConfirmEmail(ctx context.Context, userId int64, email string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, ok := r.live(userId)
+	pending := ok && row.PendingEmail != nil && *row.PendingEmail == email
+	if !ok || (row.Email != email && !pending) {
+		return false, nil
+	}
+	if err := r.emailTaken(email, userId); err != nil {
+		return false, err
+	}
+	now := r.s.timestamp()
+	row.Email = email
+	row.EmailVerifiedAt = &now
+	if pending {
+		row.PendingEmail = nil
+	}
+	row.UpdatedAt = now
+	row.Version++
+	return true, nil
+}
+
+func (r *UserRepo) RecordLoginFailure(ctx context.Context, userId int64) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, ok := r.s.users[userId]
+	if !ok {
+		return 0, repo.ErrNotFound.Wrap(fmt.Errorf("no user with id=%d", userId))
+	}
+	row.FailedLoginAttempts++
+	return row.FailedLoginAttempts, nil
+}
+
+func (r *UserRepo) LockUntil(ctx context.Context, userId int64, until time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if row, ok := r.s.users[userId]; ok {
+		until = until.Truncate(time.Microsecond)
+		row.LockedUntil = &until
+	}
+	return nil
+}
+
+func (r *UserRepo) ResetLoginFailures(ctx context.Context, userId int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if row, ok := r.s.users[userId]; ok {
+		row.FailedLoginAttempts = 0
+		row.LockedUntil = nil
+	}
+	return nil
+}
+
+// Delete soft-deletes the user. It is kept until Purge removes it, so it can still be restored.
+func (r *UserRepo) Delete(ctx context.Context, objectId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, err := r.byObjectId(objectId)
+	if err != nil {
+		return err
+	}
+	if row == nil || row.IsDeleted {
+		return repo.ErrNotFound.Wrap(fmt.Errorf("no row deleted for object_id=%s", objectId))
+	}
+	now := r.s.timestamp()
+	row.IsDeleted = true
+	row.DeletedAt = &now
+	row.UpdatedAt = now
+	row.Version++
+	return nil
+}
+
+func (r *UserRepo) Restore(ctx context.Context, objectId string) (*model.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	row, err := r.byObjectId(objectId)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil || !row.IsDeleted {
+		return nil, repo.ErrNotFound.Wrap(fmt.Errorf("no deleted user with object_id=%s", objectId))
+	}
+	row.IsDeleted = false
+	row.DeletedAt = nil
+	row.UpdatedAt = r.s.timestamp()
+	row.Version++
+	return found(row), nil
+}
+
+func (r *UserRepo) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var n int64
+	for id, u := range r.s.users {
+		if u.IsDeleted && u.DeletedAt != nil && u.DeletedAt.Before(deletedBefore) {
+			r.s.deleteUser(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// userSortKey reads the value a user is listed by and parses cursor values of the same type.
+type userSortKey struct {
+	value func(u *model.User) any
+	parse func(v string) (any, error)
+}
+
+func timeKey(field func(u *model.User) time.Time) userSortKey {
+	return userSortKey{
+		value: func(u *model.User) any { return field(u) },
+		parse: func(v string) (any, error) { return time.Parse(time.RFC3339Nano, v) },
+	}
+}
+
+func textKey(field func(u *model.User) string) userSortKey {
+	return userSortKey{
+		value: func(u *model.User) any { return field(u) },
+		parse: func(v string) (any, error) { return v, nil },
+	}
+}
+
+// userSortKeys whitelists the fields users can be listed by, like dal's userSortColumns.
+var userSortKeys = map[string]userSortKey{
+	"created_at": timeKey(func(u *model.User) time.Time { return u.CreatedAt }),
+	"updated_at": timeKey(func(u *model.User) time.Time { return u.UpdatedAt }),
+	"email":      textKey(func(u *model.User) string { return u.Email }),
+	"first_name": textKey(func(u *model.User) string { return u.FirstName }),
+	"last_name":  textKey(func(u *model.User) string { return deref(u.LastName) }),
+}
+
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return compareText(a.(string), b.(string))
+	}
+}
+
+// compareText orders text like dal's sort keys: case-insensitively first and bytewise to break ties, as
+// lower and comparison do under the C collation. Only ASCII letters are folded.
+func compareText(a, b string) int {
+	if c := strings.Compare(foldASCII(a), foldASCII(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func foldASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// List returns up to q.Limit users in (sort field, id) order, starting after q.After when it is set.
+func (r *UserRepo) List(ctx context.Context, q model.UserListQuery) ([]*model.User, error) {
+	key, ok := userSortKeys[q.SortField]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", q.SortField)
+	}
+	compare := func(av any, aId int64, bv any, bId int64) int {
+		c := compareSortValues(av, bv)
+		if c == 0 {
+			c = cmp.Compare(aId, bId)
+		}
+		if q.Descending {
+			c = -c
+		}
+		return c
+	}
+	var after any
+	if q.After != nil {
+		v, err := key.parse(q.After.Value)
+		if err != nil {
+			return nil, repo.ErrInvalid.Wrap(err)
+		}
+		after = v
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var users []*model.User
+	for _, u := range r.s.users {
+		if q.Deleted != nil && u.IsDeleted != *q.Deleted {
+			continue
+		}
+		if !strings.HasPrefix(u.Email, q.EmailPrefix) {
+			continue
+		}
+		if q.Name != "" && !strings.Contains(strings.ToLower(u.FirstName+" "+deref(u.LastName)), strings.ToLower(q.Name)) {
+			continue
+		}
+		if q.CreatedAfter != nil && u.CreatedAt.Before(*q.CreatedAfter) {
+			continue
+		}
+		if q.CreatedBefore != nil && !u.CreatedAt.Before(*q.CreatedBefore) {
+			continue
+		}
+		if q.After != nil && compare(key.value(u), u.Id, after, q.After.Id) <= 0 {
+			continue
+		}
+		users = append(users, u)
+	}
+	slices.SortFunc(users, func(a, b *model.User) int {
+		return compare(key.value(a), a.Id, key.value(b), b.Id)
+	})
+	if len(users) > q.Limit {
+		users = users[:max(q.Limit, 0)]
+	}
+	for i, u := range users {
+		users[i] = listed(u)
+	}
+	return users, nil
+}
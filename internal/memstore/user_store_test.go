@@ -0,0 +1,15 @@
+package memstore_test
+
+import (
+	"testing"
+
+	"github.com/thornhall/simple-go-service/internal/memstore"
+	"github.com/thornhall/simple-go-service/internal/repo"
+	"github.com/thornhall/simple-go-service/internal/repo/repotest"
+)
+
+func TestUserRepo_Conformance(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) repo.UserRepository {
+		return memstore.NewUserRepository(memstore.New())
+	})
+}
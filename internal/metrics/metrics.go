@@ -0,0 +1,109 @@
+// Package metrics defines the Prometheus collectors the service exports on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "simple_go_service"
+
+// UnmatchedRoute labels requests that matched no route, so unknown paths cannot blow up label cardinality.
+const UnmatchedRoute = "unmatched"
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of repository calls by repository, method and outcome.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"repository", "method", "outcome"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	Lockouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_lockouts_total",
+		Help:      "Accounts locked after repeated wrong passwords.",
+	})
+
+	JWTValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_jwt_validation_failures_total",
+		Help:      "Access tokens rejected by the auth middleware, by reason.",
+	}, []string{"reason"})
+)
+
+// NewRegistry returns a registry holding the process, Go runtime and service collectors, plus stats for
+// pool when it is not nil. The service collectors are package level, so every registry shares them.
+func NewRegistry(pool *pgxpool.Pool) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		QueryDuration,
+		Logins,
+		Lockouts,
+		JWTValidationFailures,
+	)
+	if pool != nil {
+		reg.MustRegister(NewPoolCollector(pool))
+	}
+	return reg
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler(reg *prometheus.Registry) gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+}
+
+// Middleware counts and times every request. Requests are labelled with the route template, not the raw
+// path, so ids in the URL do not create a series per user.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+		HTTPRequests.WithLabelValues(ctx.Request.Method, route, status).Inc()
+		HTTPRequestDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveQuery records how long a repository call took. It is meant to be deferred with the call's start
+// time and a pointer to its error.
+func ObserveQuery(repository, method string, start time.Time, err *error) {
+	outcome := "ok"
+	if *err != nil {
+		outcome = "error"
+	}
+	QueryDuration.WithLabelValues(repository, method, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thornhall/simple-go-service/internal/metrics"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(metrics.Middleware())
+	r.GET("/users/:object_id", func(ctx *gin.Context) { ctx.Status(http.StatusNoContent) })
+
+	ok := metrics.HTTPRequests.WithLabelValues("GET", "/users/:object_id", "204")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", metrics.UnmatchedRoute, "404")
+	okBefore, unmatchedBefore := testutil.ToFloat64(ok), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/users/a", "/users/b", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, okBefore+2, testutil.ToFloat64(ok))
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+}
+
+func TestHandler_ExposesServiceMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", metrics.Handler(metrics.NewRegistry(nil)))
+	metrics.Lockouts.Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, "simple_go_service_auth_lockouts_total"))
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
+
+func TestNewRegistry_CanBeBuiltRepeatedly(t *testing.T) {
+	assert.NotPanics(t, func() {
+		metrics.NewRegistry(nil)
+		metrics.NewRegistry(nil)
+	})
+}
+
+type stubUserRepo struct {
+	repo.UserRepository
+	err error
+}
+
+func (r *stubUserRepo) FindById(ctx context.Context, userId int64) (*model.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &model.User{Id: userId}, nil
+}
+
+func TestInstrumentUserRepository_ObservesByMethodAndOutcome(t *testing.T) {
+	okBefore := observations(t, "user", "FindById", "ok")
+	errBefore := observations(t, "user", "FindById", "error")
+
+	u, err := metrics.InstrumentUserRepository(&stubUserRepo{}).FindById(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), u.Id)
+
+	_, err = metrics.InstrumentUserRepository(&stubUserRepo{err: errors.New("boom")}).FindById(context.Background(), 7)
+	assert.EqualError(t, err, "boom")
+
+	assert.Equal(t, okBefore+1, observations(t, "user", "FindById", "ok"))
+	assert.Equal(t, errBefore+1, observations(t, "user", "FindById", "error"))
+}
+
+// observations returns how many samples the query histogram holds for the given labels.
+func observations(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	assert.NoError(t, metrics.QueryDuration.WithLabelValues(labels...).(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector exports pgxpool statistics, read fresh on every scrape.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired         *prometheus.Desc
+	idle             *prometheus.Desc
+	constructing     *prometheus.Desc
+	total            *prometheus.Desc
+	max              *prometheus.Desc
+	acquires         *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquires    *prometheus.Desc
+	canceledAcquires *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &PoolCollector{
+		pool:             pool,
+		acquired:         desc("acquired_connections", "Connections currently checked out of the pool."),
+		idle:             desc("idle_connections", "Idle connections in the pool."),
+		constructing:     desc("constructing_connections", "Connections being established."),
+		total:            desc("total_connections", "Connections in the pool, whatever their state."),
+		max:              desc("max_connections", "Maximum size of the pool."),
+		acquires:         desc("acquires_total", "Successful connection acquisitions."),
+		acquireDuration:  desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		emptyAcquires:    desc("empty_acquires_total", "Acquisitions that had to wait because no connection was idle."),
+		canceledAcquires: desc("canceled_acquires_total", "Acquisitions abandoned because their context was cancelled."),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.constructing
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquires
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.acquired, float64(stat.AcquiredConns()))
+	gauge(c.idle, float64(stat.IdleConns()))
+	gauge(c.constructing, float64(stat.ConstructingConns()))
+	gauge(c.total, float64(stat.TotalConns()))
+	gauge(c.max, float64(stat.MaxConns()))
+	counter(c.acquires, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(c.canceledAcquires, float64(stat.CanceledAcquireCount()))
+}
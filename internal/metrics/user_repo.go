@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+const userRepository = "user"
+
+// UserRepository times every call to the wrapped repository under its method name.
+type UserRepository struct {
+	repo.UserRepository
+}
+
+func InstrumentUserRepository(r repo.UserRepository) repo.UserRepository {
+	return &UserRepository{r}
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (u *model.User, err error) {
+	defer ObserveQuery(userRepository, "FindByEmail", time.Now(), &err)
+	return r.UserRepository.FindByEmail(ctx, email)
+}
+
+func (r *UserRepository) FindById(ctx context.Context, userId int64) (u *model.User, err error) {
+	defer ObserveQuery(userRepository, "FindById", time.Now(), &err)
+	return r.UserRepository.FindById(ctx, userId)
+}
+
+func (r *UserRepository) FindByObjectId(ctx context.Context, objectID string) (u *model.User, err error) {
+	defer ObserveQuery(userRepository, "FindByObjectId", time.Now(), &err)
+	return r.UserRepository.FindByObjectId(ctx, objectID)
+}
+
+func (r *UserRepository) List(ctx context.Context, q model.UserListQuery) (users []*model.User, err error) {
+	defer ObserveQuery(userRepository, "List", time.Now(), &err)
+	return r.UserRepository.List(ctx, q)
+}
+
+func (r *UserRepository) Create(ctx context.Context, u *model.User) (err error) {
+	defer ObserveQuery(userRepository, "Create", time.Now(), &err)
+	return r.UserRepository.Create(ctx, u)
+}
+
+func (r *UserRepository) Update(ctx context.Context, u *model.User) (err error) {
+	defer ObserveQuery(userRepository, "Update", time.Now(), &err)
+	return r.UserRepository.Update(ctx, u)
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, userId int64, passwordHash string) (err error) {
+	defer ObserveQuery(userRepository, "UpdatePassword", time.Now(), &err)
+	return r.UserRepository.UpdatePassword(ctx, userId, passwordHash)
+}
+
+func (r *UserRepository) ConfirmEmail(ctx context.Context, userId int64, email string) (ok bool, err error) {
+	defer ObserveQuery(userRepository, "ConfirmEmail", time.Now(), &err)
+	return r.UserRepository.ConfirmEmail(ctx, userId, email)
+}
+
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, userId int64) (n int, err error) {
+	defer ObserveQuery(userRepository, "RecordLoginFailure", time.Now(), &err)
+	return r.UserRepository.RecordLoginFailure(ctx, userId)
+}
+
+func (r *UserRepository) LockUntil(ctx context.Context, userId int64, until time.Time) (err error) {
+	defer ObserveQuery(userRepository, "LockUntil", time.Now(), &err)
+	return r.UserRepository.LockUntil(ctx, userId, until)
+}
+
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, userId int64) (err error) {
+	defer ObserveQuery(userRepository, "ResetLoginFailures", time.Now(), &err)
+	return r.UserRepository.ResetLoginFailures(ctx, userId)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, objectID string) (err error) {
+	defer ObserveQuery(userRepository, "Delete", time.Now(), &err)
+	return r.UserRepository.Delete(ctx, objectID)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, objectID string) (u *model.User, err error) {
+	defer ObserveQuery(userRepository, "Restore", time.Now(), &err)
+	return r.UserRepository.Restore(ctx, objectID)
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (n int64, err error) {
+	defer ObserveQuery(userRepository, "Purge", time.Now(), &err)
+	return r.UserRepository.Purge(ctx, deletedBefore)
+}
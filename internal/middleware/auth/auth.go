@@ -2,84 +2,176 @@ package auth
 
 import (
 	"errors"
-	"log"
-	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/metrics"
+)
+
+var (
+	// ErrInvalidToken rejects requests without a usable access token.
+	ErrInvalidToken = apperr.Unauthorized("invalid_token", "missing or invalid Authorization header")
+	// ErrRevokedToken rejects access tokens found on the denylist.
+	ErrRevokedToken = apperr.Unauthorized("token_revoked", "token has been revoked")
+	// ErrForbidden rejects callers whose roles do not grant the permission a route requires.
+	ErrForbidden = apperr.Forbidden("forbidden", "forbidden")
 )
 
-func IssueJWT(userID int64, email string) (string, error) {
+// UserIdKey is the gin context key under which JWTAuth stores the authenticated user's id.
+const UserIdKey = "userId"
+
+// ClaimsKey is the gin context key under which JWTAuth stores the verified *Claims.
+const ClaimsKey = "claims"
+
+// Claims are the claims carried by access tokens.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// MFAPendingAudience marks a token that proves the password step of login succeeded but cannot be used
+// to call the API. JWTAuth rejects it; it can only be exchanged for a real access token.
+const MFAPendingAudience = "mfa_pending"
+
+// IssueJWT signs an access token for the user with the keyring's active key. It expires after ttl.
+func (k *Keyring) IssueJWT(userID int64, email string, roles []string, ttl time.Duration) (string, error) {
 	strUserId := strconv.FormatInt(userID, 10)
 	claims := jwt.MapClaims{
 		"sub":   strUserId,
 		"email": email,
-		"exp":   time.Now().Add(15 * 24 * time.Hour).Unix(),
+		"roles": roles,
+		"exp":   time.Now().Add(ttl).Unix(),
 		"iat":   time.Now().Unix(),
+		"jti":   uuid.NewString(),
+	}
+	return k.Sign(claims)
+}
+
+// IssueMFAPendingJWT signs a token for a user who passed the password check and still has to present a
+// second factor. It expires after ttl.
+func (k *Keyring) IssueMFAPendingJWT(userID int64, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": strconv.FormatInt(userID, 10),
+		"aud": MFAPendingAudience,
+		"exp": time.Now().Add(ttl).Unix(),
+		"iat": time.Now().Unix(),
+		"jti": uuid.NewString(),
+	}
+	return k.Sign(claims)
+}
+
+// ParseMFAPendingJWT verifies a token from IssueMFAPendingJWT and returns its claims.
+func (k *Keyring) ParseMFAPendingJWT(raw string) (*jwt.RegisteredClaims, error) {
+	token, err := jwt.ParseWithClaims(
+		raw,
+		&jwt.RegisteredClaims{},
+		k.Keyfunc,
+		jwt.WithValidMethods(k.ValidMethods()),
+		jwt.WithAudience(MFAPendingAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("encountered an error when creating user")
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return nil, jwt.ErrTokenInvalidClaims
 	}
-	return token.SignedString([]byte(jwtSecret))
+	return claims, nil
 }
 
-func JWTAuth(jwtSecret []byte) gin.HandlerFunc {
+// JWTAuth verifies the bearer token against the keyring and stores the subject under UserIdKey. Tokens
+// found on the denylist are rejected; a nil denylist skips that check.
+func JWTAuth(keys *Keyring, denylist *Denylist) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		auth := ctx.GetHeader("Authorization")
 		parts := strings.SplitN(auth, " ", 2)
 		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			ctx.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "missing or invalid Authorization header"},
-			)
+			rejectToken(ctx, "missing_header", nil, ErrInvalidToken)
 			return
 		}
 
 		token, err := jwt.ParseWithClaims(
 			parts[1],
-			&jwt.RegisteredClaims{},
-			func(t *jwt.Token) (any, error) {
-				if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-					return nil, jwt.ErrTokenSignatureInvalid
-				}
-				return jwtSecret, nil
-			},
-			jwt.WithValidMethods([]string{"HS256"}),
+			&Claims{},
+			keys.Keyfunc,
+			jwt.WithValidMethods(keys.ValidMethods()),
 		)
 		if err != nil || !token.Valid {
-			log.Println(err.Error())
-			ctx.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "missing or invalid Authorization header"},
-			)
+			rejectToken(ctx, jwtFailureReason(err), err, ErrInvalidToken)
 			return
 		}
-		claims, ok := token.Claims.(*jwt.RegisteredClaims)
+		claims, ok := token.Claims.(*Claims)
 		if !ok {
-			log.Println("claims is not of type *MyClaims")
-			ctx.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "missing or invalid Authorization header"},
-			)
+			rejectToken(ctx, "malformed", nil, ErrInvalidToken)
 			return
 		}
 
-		if claims.Subject == "" {
-			log.Println("sub is empty")
-			ctx.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{"error": "missing or invalid Authorization header"},
-			)
+		if claims.Subject == "" || slices.Contains(claims.Audience, MFAPendingAudience) {
+			rejectToken(ctx, "not_access_token", nil, ErrInvalidToken)
 			return
 		}
 
-		ctx.Set("userId", claims.Subject)
+		if denylist != nil {
+			userId, _ := strconv.ParseInt(claims.Subject, 10, 64)
+			if claims.IssuedAt == nil || denylist.IsRevoked(claims.ID, userId, claims.IssuedAt.Time) {
+				rejectToken(ctx, "revoked", nil, ErrRevokedToken)
+				return
+			}
+		}
+
+		ctx.Set(UserIdKey, claims.Subject)
+		ctx.Set(ClaimsKey, claims)
+		ctx.Request = ctx.Request.WithContext(logging.With(ctx.Request.Context(), "user_id", claims.Subject))
 		ctx.Next()
 	}
 }
+
+// rejectToken answers with rejection and records why the token was refused. err, when set, is the parse
+// error; it is logged but never sent to the client.
+func rejectToken(ctx *gin.Context, reason string, err error, rejection *apperr.Error) {
+	metrics.JWTValidationFailures.WithLabelValues(reason).Inc()
+	attrs := []any{"reason", reason}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logging.FromContext(ctx.Request.Context()).Info("access token rejected", attrs...)
+	apperr.Abort(ctx, rejection)
+}
+
+// jwtFailureReason maps a parse error to the reason label of the validation failure metric.
+func jwtFailureReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "not_yet_valid"
+	case errors.Is(err, ErrUnknownKey):
+		return "unknown_key"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return "bad_signature"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	default:
+		return "invalid"
+	}
+}
+
+// ClaimsFrom returns the claims JWTAuth verified for this request.
+func ClaimsFrom(ctx *gin.Context) (*Claims, bool) {
+	v, ok := ctx.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*Claims)
+	return claims, ok
+}
@@ -3,12 +3,16 @@ package auth_test
 import (
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/metrics"
 	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 )
 
@@ -24,14 +28,10 @@ func TestJWTAuth_Middleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	assert.NotZero(t, jwtSecret)
-	if jwtSecret == "" {
-		return
-	}
-	jwtSecretBytes := []byte(jwtSecret)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
 	r.GET("/protected",
-		auth.JWTAuth(jwtSecretBytes),
+		auth.JWTAuth(keys, nil),
 		fakeProtectedHandler,
 	)
 
@@ -40,7 +40,8 @@ func TestJWTAuth_Middleware(t *testing.T) {
 	req := httptest.NewRequest("GET", "/protected", nil)
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
-	assert.Contains(t, w.Body.String(), `"error":"missing or invalid Authorization header"`)
+	assert.Equal(t, apperr.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"invalid_token"`)
 
 	// Case B: Badly formatted “Bearer” header → still 401
 	w = httptest.NewRecorder()
@@ -49,10 +50,10 @@ func TestJWTAuth_Middleware(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
-	//Case C: Valid “Bearer <token>,” but token signed with wrong secret → 401
-	os.Setenv("JWT_SECRET", "badSecret")
-	wrongToken, err := auth.IssueJWT(1, "thornhall@gmail.com")
-	os.Setenv("JWT_SECRET", jwtSecret)
+	//Case C: Valid “Bearer <token>,” but token signed by a different keyring → 401
+	otherKeys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	wrongToken, err := otherKeys.IssueJWT(1, "thornhall@gmail.com", nil, time.Minute)
 	assert.NoError(t, err)
 	if err != nil {
 		return
@@ -63,8 +64,28 @@ func TestJWTAuth_Middleware(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
-	// Case E: Valid “Bearer <token>,” correct secret, with “sub” claim → 200 + context set
-	validToken, err := auth.IssueJWT(1, "thornhall@gmail.com")
+	// Case D: HS256 token forged with the public key as the secret → 401
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	forged.Header["kid"] = keys.JWKS().Keys[0].Kid
+	forgedToken, err := forged.SignedString([]byte(keys.JWKS().Keys[0].X))
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+forgedToken)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Case E: mfa_pending token only proves the password step → 401
+	pendingToken, err := keys.IssueMFAPendingJWT(1, time.Minute)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+pendingToken)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Case F: Valid “Bearer <token>,” correct key, with “sub” claim → 200 + context set
+	validToken, err := keys.IssueJWT(1, "thornhall@gmail.com", nil, time.Minute)
 	assert.NoError(t, err)
 	if err != nil {
 		return
@@ -77,3 +98,71 @@ func TestJWTAuth_Middleware(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), `"got":"1"`)
 }
+
+func TestParseMFAPendingJWT(t *testing.T) {
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+
+	pending, err := keys.IssueMFAPendingJWT(7, time.Minute)
+	assert.NoError(t, err)
+	claims, err := keys.ParseMFAPendingJWT(pending)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", claims.Subject)
+
+	// an access token cannot stand in for an mfa token
+	access, err := keys.IssueJWT(7, "a@example.com", nil, time.Minute)
+	assert.NoError(t, err)
+	_, err = keys.ParseMFAPendingJWT(access)
+	assert.Error(t, err)
+}
+
+func TestNewOpaqueToken(t *testing.T) {
+	raw, hash, err := auth.NewOpaqueToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	assert.Equal(t, auth.HashOpaqueToken(raw), hash)
+	assert.NotEqual(t, raw, hash)
+
+	other, _, err := auth.NewOpaqueToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, raw, other)
+}
+
+func TestJWTAuth_CountsFailuresByReason(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	r.GET("/protected", auth.JWTAuth(keys, nil), fakeProtectedHandler)
+
+	otherKeys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	foreign, err := otherKeys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	assert.NoError(t, err)
+	expired, err := keys.IssueJWT(1, "a@example.com", nil, -time.Minute)
+	assert.NoError(t, err)
+	pending, err := keys.IssueMFAPendingJWT(1, time.Minute)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		header, reason string
+	}{
+		{"", "missing_header"},
+		{"Bearer not-a-jwt", "malformed"},
+		{"Bearer " + foreign, "unknown_key"},
+		{"Bearer " + expired, "expired"},
+		{"Bearer " + pending, "not_access_token"},
+	}
+	for _, tt := range tests {
+		counter := metrics.JWTValidationFailures.WithLabelValues(tt.reason)
+		before := testutil.ToFloat64(counter)
+		req := httptest.NewRequest("GET", "/protected", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equalf(t, before+1, testutil.ToFloat64(counter), "reason %s", tt.reason)
+	}
+}
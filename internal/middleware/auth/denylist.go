@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// syncOverlap re-reads revocations created shortly before the newest one already seen, so rows committed
+// out of created_at order by concurrent replicas are not skipped.
+const syncOverlap = 10 * time.Second
+
+// Denylist tracks revoked access tokens. Revocations are persisted in Postgres so every replica sees them
+// and are served from an in-process cache that Sync keeps up to date.
+type Denylist struct {
+	repo repo.RevocationRepository
+	// maxTokenTTL bounds how long a user-wide revocation must be remembered.
+	maxTokenTTL time.Duration
+
+	mu       sync.RWMutex
+	jtis     map[string]time.Time
+	cutoffs  map[int64]time.Time
+	expiries map[int64]time.Time
+	lastSeen time.Time
+}
+
+func NewDenylist(repo repo.RevocationRepository, maxTokenTTL time.Duration) *Denylist {
+	return &Denylist{
+		repo:        repo,
+		maxTokenTTL: maxTokenTTL,
+		jtis:        map[string]time.Time{},
+		cutoffs:     map[int64]time.Time{},
+		expiries:    map[int64]time.Time{},
+	}
+}
+
+// IsRevoked reports whether a token with the given id, subject and issue time has been revoked.
+func (d *Denylist) IsRevoked(jti string, userId int64, issuedAt time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, ok := d.jtis[jti]; ok && jti != "" {
+		return true
+	}
+	cutoff, ok := d.cutoffs[userId]
+	return ok && issuedAt.Before(cutoff)
+}
+
+// NotBefore returns the earliest issue time at which a new token for the user escapes the user's latest
+// revoke-all, or the zero time if there is none. Token issuers wait for it so a token issued right after
+// a revoke-all is not caught by it.
+func (d *Denylist) NotBefore(userId int64) time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.cutoffs[userId]
+}
+
+// Revoke denies a single access token until it expires.
+func (d *Denylist) Revoke(ctx context.Context, jti string, userId int64, expiresAt time.Time) error {
+	rev := &model.TokenRevocation{Jti: &jti, UserId: userId, ExpiresAt: expiresAt}
+	if err := d.repo.Create(ctx, rev); err != nil {
+		return err
+	}
+	d.apply(rev)
+	return nil
+}
+
+// RevokeAll denies every access token issued to the user up to now. Tokens carry their issue time in whole
+// seconds, so the cutoff is the start of the next second: a token issued earlier in the current one cannot
+// be told from one issued later, and both are revoked. See NotBefore.
+func (d *Denylist) RevokeAll(ctx context.Context, userId int64) error {
+	now := time.Now()
+	cutoff := now.Truncate(time.Second).Add(time.Second)
+	rev := &model.TokenRevocation{UserId: userId, RevokedBefore: &cutoff, ExpiresAt: now.Add(d.maxTokenTTL)}
+	if err := d.repo.Create(ctx, rev); err != nil {
+		return err
+	}
+	d.apply(rev)
+	return nil
+}
+
+// Sync loads revocations written by any replica since the last sync and forgets expired ones.
+func (d *Denylist) Sync(ctx context.Context) error {
+	d.mu.RLock()
+	since := d.lastSeen
+	d.mu.RUnlock()
+	if !since.IsZero() {
+		since = since.Add(-syncOverlap)
+	}
+
+	revocations, err := d.repo.ListSince(ctx, since)
+	if err != nil {
+		return err
+	}
+	for _, rev := range revocations {
+		d.apply(rev)
+	}
+	d.prune(time.Now())
+	return nil
+}
+
+// Run syncs the cache every interval until ctx is cancelled. Expired rows are purged from Postgres on the
+// same schedule.
+func (d *Denylist) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Sync(ctx); err != nil {
+				logging.FromContext(ctx).Error("token denylist sync failed", "error", err)
+			}
+			if err := d.repo.DeleteExpired(ctx, time.Now()); err != nil {
+				logging.FromContext(ctx).Error("token denylist purge failed", "error", err)
+			}
+		}
+	}
+}
+
+func (d *Denylist) apply(rev *model.TokenRevocation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rev.Jti != nil {
+		d.jtis[*rev.Jti] = rev.ExpiresAt
+	}
+	if rev.RevokedBefore != nil && rev.RevokedBefore.After(d.cutoffs[rev.UserId]) {
+		d.cutoffs[rev.UserId] = *rev.RevokedBefore
+		d.expiries[rev.UserId] = rev.ExpiresAt
+	}
+	if rev.CreatedAt.After(d.lastSeen) {
+		d.lastSeen = rev.CreatedAt
+	}
+}
+
+func (d *Denylist) prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for jti, expiresAt := range d.jtis {
+		if !expiresAt.After(now) {
+			delete(d.jtis, jti)
+		}
+	}
+	for userId, expiresAt := range d.expiries {
+		if !expiresAt.After(now) {
+			delete(d.cutoffs, userId)
+			delete(d.expiries, userId)
+		}
+	}
+}
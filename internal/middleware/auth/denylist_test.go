@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+// sharedRevocationRepo stands in for the Postgres table that every replica reads from.
+type sharedRevocationRepo struct {
+	mu          sync.Mutex
+	revocations []*model.TokenRevocation
+}
+
+func (f *sharedRevocationRepo) Create(ctx context.Context, r *model.TokenRevocation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.Id = int64(len(f.revocations) + 1)
+	r.CreatedAt = time.Now()
+	f.revocations = append(f.revocations, r)
+	return nil
+}
+
+func (f *sharedRevocationRepo) ListSince(ctx context.Context, since time.Time) ([]*model.TokenRevocation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*model.TokenRevocation
+	for _, r := range f.revocations {
+		if !r.CreatedAt.Before(since) && r.ExpiresAt.After(time.Now()) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (f *sharedRevocationRepo) DeleteExpired(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+func TestDenylist_Revoke(t *testing.T) {
+	d := auth.NewDenylist(&sharedRevocationRepo{}, time.Hour)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	assert.False(t, d.IsRevoked("jti-1", 1, issuedAt))
+	require.NoError(t, d.Revoke(context.Background(), "jti-1", 1, time.Now().Add(time.Hour)))
+	assert.True(t, d.IsRevoked("jti-1", 1, issuedAt))
+	assert.False(t, d.IsRevoked("jti-2", 1, issuedAt))
+	assert.False(t, d.IsRevoked("", 1, issuedAt))
+}
+
+func TestDenylist_RevokeAll(t *testing.T) {
+	d := auth.NewDenylist(&sharedRevocationRepo{}, time.Hour)
+
+	require.NoError(t, d.RevokeAll(context.Background(), 1))
+	assert.True(t, d.IsRevoked("jti-1", 1, time.Now().Add(-time.Minute)))
+	assert.False(t, d.IsRevoked("jti-1", 2, time.Now().Add(-time.Minute)))
+	// tokens issued after the cutoff second are still accepted
+	assert.False(t, d.IsRevoked("jti-1", 1, time.Now().Add(2*time.Second)))
+}
+
+func TestDenylist_RevokeAllInTheSameSecond(t *testing.T) {
+	d := auth.NewDenylist(&sharedRevocationRepo{}, time.Hour)
+	assert.True(t, d.NotBefore(1).IsZero())
+
+	second := time.Now().Truncate(time.Second)
+	require.NoError(t, d.RevokeAll(context.Background(), 1))
+	notBefore := d.NotBefore(1)
+	// iat has whole seconds, so every token stamped with the current second is revoked, whether it was
+	// issued before or after the call, and tokens issued from NotBefore on are not
+	assert.Equal(t, second.Add(time.Second), notBefore)
+	assert.True(t, d.IsRevoked("", 1, second))
+	assert.False(t, d.IsRevoked("", 1, notBefore))
+
+	// a later revoke-all in the same second leaves the cutoff where it is
+	require.NoError(t, d.RevokeAll(context.Background(), 1))
+	assert.False(t, d.IsRevoked("", 1, notBefore))
+}
+
+func TestDenylist_SyncAcrossReplicas(t *testing.T) {
+	shared := &sharedRevocationRepo{}
+	replicaA := auth.NewDenylist(shared, time.Hour)
+	replicaB := auth.NewDenylist(shared, time.Hour)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	require.NoError(t, replicaA.Revoke(context.Background(), "jti-1", 1, time.Now().Add(time.Hour)))
+	require.NoError(t, replicaA.RevokeAll(context.Background(), 2))
+	assert.False(t, replicaB.IsRevoked("jti-1", 1, issuedAt))
+
+	require.NoError(t, replicaB.Sync(context.Background()))
+	assert.True(t, replicaB.IsRevoked("jti-1", 1, issuedAt))
+	assert.True(t, replicaB.IsRevoked("other", 2, issuedAt))
+}
+
+func TestDenylist_ForgetsExpiredEntries(t *testing.T) {
+	d := auth.NewDenylist(&sharedRevocationRepo{}, time.Hour)
+	require.NoError(t, d.Revoke(context.Background(), "jti-1", 1, time.Now().Add(-time.Second)))
+	require.NoError(t, d.Sync(context.Background()))
+	assert.False(t, d.IsRevoked("jti-1", 1, time.Now().Add(-time.Minute)))
+}
+
+func TestJWTAuth_RejectsRevokedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	d := auth.NewDenylist(&sharedRevocationRepo{}, time.Hour)
+
+	r := gin.New()
+	r.GET("/protected", auth.JWTAuth(keys, d), fakeProtectedHandler)
+
+	call := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, call(token))
+
+	claims := &jwt.RegisteredClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID)
+
+	require.NoError(t, d.Revoke(context.Background(), claims.ID, 1, claims.ExpiresAt.Time))
+	assert.Equal(t, http.StatusUnauthorized, call(token))
+
+	other, err := keys.IssueJWT(2, "b@example.com", nil, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, call(other))
+	require.NoError(t, d.RevokeAll(context.Background(), 2))
+	assert.Equal(t, http.StatusUnauthorized, call(other))
+}
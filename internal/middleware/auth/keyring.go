@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// Key is a single asymmetric signing key. Public keys are published through the JWKS endpoint while the
+// private half never leaves the process.
+type Key struct {
+	Kid       string
+	Alg       string
+	private   crypto.Signer
+	retiredAt time.Time
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Alg == AlgRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Keyring holds the key used to sign new tokens plus every key that is still allowed to verify them.
+// After a rotation the previous signing key is kept for verification for the retention window so tokens
+// issued just before the rotation stay valid until they expire.
+type Keyring struct {
+	mu        sync.RWMutex
+	alg       string
+	retention time.Duration
+	signing   *Key
+	keys      map[string]*Key
+	rotate    func() error
+}
+
+// NewGeneratedKeyring returns a keyring that mints its own keys. Each rotation generates a fresh key.
+// Keys live only in memory, so every replica publishes its own set through JWKS.
+func NewGeneratedKeyring(alg string, retention time.Duration) (*Keyring, error) {
+	k, err := newKeyring(alg, retention)
+	if err != nil {
+		return nil, err
+	}
+	k.rotate = k.generate
+	return k, k.generate()
+}
+
+// NewKeyringFromDir loads PEM encoded private keys (PKCS#8 or PKCS#1) from dir. The file name without its
+// extension is used as the kid and the key whose name sorts last signs new tokens, so naming files by date
+// makes the newest key active. Rotation re-reads the directory.
+func NewKeyringFromDir(dir string, alg string, retention time.Duration) (*Keyring, error) {
+	k, err := newKeyring(alg, retention)
+	if err != nil {
+		return nil, err
+	}
+	k.rotate = func() error { return k.loadDir(dir) }
+	return k, k.loadDir(dir)
+}
+
+func newKeyring(alg string, retention time.Duration) (*Keyring, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return &Keyring{alg: alg, retention: retention, keys: map[string]*Key{}}, nil
+}
+
+// Rotate replaces the signing key and drops retired keys whose retention window has passed.
+func (k *Keyring) Rotate() error {
+	if err := k.rotate(); err != nil {
+		return err
+	}
+	k.prune(time.Now())
+	return nil
+}
+
+// StartRotation rotates the keyring every interval until ctx is cancelled.
+func (k *Keyring) StartRotation(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.Rotate(); err != nil {
+					logging.FromContext(ctx).Error("jwt key rotation failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Sign signs claims with the active key and stamps its kid in the token header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key := k.signing
+	k.mu.RUnlock()
+	if key == nil {
+		return "", errors.New("keyring has no signing key")
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header.
+func (k *Keyring) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	expired := ok && !key.retiredAt.IsZero() && time.Since(key.retiredAt) > k.retention
+	k.mu.RUnlock()
+	if !ok || expired {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.Alg {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return key.private.Public(), nil
+}
+
+// ValidMethods lists the algorithms accepted by the keyring, for use with jwt.WithValidMethods.
+func (k *Keyring) ValidMethods() []string {
+	return []string{k.alg}
+}
+
+// JWK is the public half of a Key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that currently verify tokens, sorted by kid.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{Kid: key.Kid, Use: "sig", Alg: key.Alg}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func (k *Keyring) generate() error {
+	var signer crypto.Signer
+	var err error
+	switch k.alg {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+	k.activate(&Key{Kid: uuid.NewString(), Alg: k.alg, private: signer})
+	return nil
+}
+
+func (k *Keyring) loadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	loaded := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		signer, err := readPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key := &Key{Kid: kid, Alg: k.alg, private: signer}
+		if err := checkKeyType(key); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		loaded = append(loaded, key)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	onDisk := make(map[string]bool, len(loaded))
+	for _, key := range loaded {
+		onDisk[key.Kid] = true
+		if _, ok := k.keys[key.Kid]; !ok {
+			k.keys[key.Kid] = key
+		}
+	}
+	// keys whose files were removed stop verifying once their retention window passes
+	for kid, key := range k.keys {
+		if !onDisk[kid] && key.retiredAt.IsZero() {
+			key.retiredAt = time.Now()
+		}
+	}
+	newest := k.keys[loaded[len(loaded)-1].Kid]
+	if k.signing != newest {
+		k.activateLocked(newest)
+	}
+	return nil
+}
+
+// activate makes key the signing key and retires the previous one.
+func (k *Keyring) activate(key *Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.activateLocked(key)
+}
+
+func (k *Keyring) activateLocked(key *Key) {
+	if k.signing != nil {
+		k.signing.retiredAt = time.Now()
+	}
+	key.retiredAt = time.Time{}
+	k.signing = key
+	k.keys[key.Kid] = key
+}
+
+func (k *Keyring) prune(now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for kid, key := range k.keys {
+		if !key.retiredAt.IsZero() && now.Sub(key.retiredAt) > k.retention {
+			delete(k.keys, kid)
+		}
+	}
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key cannot sign")
+	}
+	return signer, nil
+}
+
+func checkKeyType(key *Key) error {
+	switch key.private.(type) {
+	case *rsa.PrivateKey:
+		if key.Alg == AlgRS256 {
+			return nil
+		}
+	case ed25519.PrivateKey:
+		if key.Alg == AlgEdDSA {
+			return nil
+		}
+	}
+	return fmt.Errorf("key type %T does not match algorithm %s", key.private, key.Alg)
+}
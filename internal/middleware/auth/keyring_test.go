@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+)
+
+func verify(keys *auth.Keyring, token string) error {
+	_, err := jwt.Parse(token, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+	return err
+}
+
+func TestKeyring_SignAndVerify(t *testing.T) {
+	for _, alg := range []string{auth.AlgEdDSA, auth.AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			keys, err := auth.NewGeneratedKeyring(alg, time.Hour)
+			require.NoError(t, err)
+
+			token, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+			require.NoError(t, err)
+			assert.NoError(t, verify(keys, token))
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, alg, parsed.Method.Alg())
+			assert.Equal(t, keys.JWKS().Keys[0].Kid, parsed.Header["kid"])
+		})
+	}
+}
+
+func TestKeyring_UnsupportedAlg(t *testing.T) {
+	_, err := auth.NewGeneratedKeyring("HS256", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	before, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Rotate())
+	after, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+
+	// both the retired and the active key verify and are published
+	assert.NoError(t, verify(keys, before))
+	assert.NoError(t, verify(keys, after))
+	assert.Len(t, keys.JWKS().Keys, 2)
+}
+
+func TestKeyring_RotateDropsKeysAfterRetention(t *testing.T) {
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, 0)
+	require.NoError(t, err)
+	before, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Rotate())
+	time.Sleep(time.Millisecond)
+	require.NoError(t, keys.Rotate())
+
+	assert.ErrorIs(t, verify(keys, before), auth.ErrUnknownKey)
+	assert.Len(t, keys.JWKS().Keys, 1)
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	ed, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	jwk := ed.JWKS().Keys[0]
+	assert.Equal(t, "OKP", jwk.Kty)
+	assert.Equal(t, "Ed25519", jwk.Crv)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.NotEmpty(t, jwk.X)
+
+	rs, err := auth.NewGeneratedKeyring(auth.AlgRS256, time.Hour)
+	require.NoError(t, err)
+	jwk = rs.JWKS().Keys[0]
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.NotEmpty(t, jwk.N)
+}
+
+func writePEM(t *testing.T, dir, name string, key any) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+func TestKeyring_FromDir(t *testing.T) {
+	dir := t.TempDir()
+	_, older, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-01.pem", older)
+
+	keys, err := auth.NewKeyringFromDir(dir, auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	first, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+
+	// dropping in a newer key and rotating makes it the signing key
+	_, newer, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-02.pem", newer)
+	require.NoError(t, keys.Rotate())
+
+	second, err := keys.IssueJWT(1, "a@example.com", nil, time.Minute)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(second, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-02", parsed.Header["kid"])
+	assert.NoError(t, verify(keys, first))
+	assert.NoError(t, verify(keys, second))
+
+	// a key that does not match the configured algorithm is rejected
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-03.pem", rsaKey)
+	assert.Error(t, keys.Rotate())
+
+	_, err = auth.NewKeyringFromDir(t.TempDir(), auth.AlgEdDSA, time.Hour)
+	assert.Error(t, err)
+}
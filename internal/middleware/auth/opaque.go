@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random bearer secret (refresh tokens, password reset links, ...) together with
+// the hash that should be persisted. The raw token is only ever handed to the client.
+func NewOpaqueToken() (raw string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, HashOpaqueToken(raw), nil
+}
+
+// HashOpaqueToken returns the hex encoded SHA-256 of a raw opaque token.
+func HashOpaqueToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// Role names seeded by the RBAC migration. Every new user gets RoleUser.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleUser    = "user"
+)
+
+// Permissions checked by the service. Which roles hold them is configured in the role_permissions table.
+const (
+	PermUsersRead    = "users:read"
+	PermUsersList    = "users:list"
+	PermUsersUpdate  = "users:update"
+	PermUsersDelete  = "users:delete"
+	PermUsersRestore = "users:restore"
+	PermRolesManage  = "roles:manage"
+)
+
+const policyKey = "policy"
+
+// Policy maps roles to the permissions they grant. Tokens only carry role names, so changes to a role's
+// permissions apply to existing tokens as soon as the policy is reloaded.
+type Policy struct {
+	repo repo.RoleRepository
+
+	mu    sync.RWMutex
+	perms map[string][]string
+}
+
+func NewPolicy(repo repo.RoleRepository) *Policy {
+	return &Policy{repo: repo, perms: map[string][]string{}}
+}
+
+// NewStaticPolicy builds a Policy from a fixed role to permissions mapping. It cannot be reloaded.
+func NewStaticPolicy(perms map[string][]string) *Policy {
+	return &Policy{perms: perms}
+}
+
+// Load replaces the mapping with the current contents of the database.
+func (p *Policy) Load(ctx context.Context) error {
+	perms, err := p.repo.PermissionsByRole(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.perms = perms
+	p.mu.Unlock()
+	return nil
+}
+
+// Run reloads the policy every interval until ctx is cancelled.
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Load(ctx); err != nil {
+				logging.FromContext(ctx).Error("rbac policy reload failed", "error", err)
+			}
+		}
+	}
+}
+
+// Permissions returns every permission granted by any of roles.
+func (p *Policy) Permissions(roles []string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var perms []string
+	for _, role := range roles {
+		for _, perm := range p.perms[role] {
+			if !slices.Contains(perms, perm) {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return perms
+}
+
+// WithPolicy makes the policy available to RequirePermission and PermissionsFrom further down the chain.
+func WithPolicy(p *Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(policyKey, p)
+		ctx.Next()
+	}
+}
+
+// PermissionsFrom returns the permissions granted by the roles in the caller's verified token. It is empty
+// when JWTAuth or WithPolicy has not run.
+func PermissionsFrom(ctx *gin.Context) []string {
+	claims, ok := ClaimsFrom(ctx)
+	if !ok {
+		return nil
+	}
+	p, ok := ctx.Value(policyKey).(*Policy)
+	if !ok {
+		return nil
+	}
+	return p.Permissions(claims.Roles)
+}
+
+// RequirePermission rejects callers whose roles do not grant perm. It must run after JWTAuth.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !slices.Contains(PermissionsFrom(ctx), perm) {
+			apperr.Abort(ctx, ErrForbidden)
+			return
+		}
+		ctx.Next()
+	}
+}
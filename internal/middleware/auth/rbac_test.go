@@ -0,0 +1,93 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+)
+
+type fakeRoleRepo struct {
+	perms map[string][]string
+	err   error
+}
+
+func (f *fakeRoleRepo) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	return f.perms, f.err
+}
+
+func (f *fakeRoleRepo) Grant(ctx context.Context, userId int64, role string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeRoleRepo) Revoke(ctx context.Context, userId int64, role string) (bool, error) {
+	return false, nil
+}
+
+func TestPolicy_Load(t *testing.T) {
+	roles := &fakeRoleRepo{perms: map[string][]string{
+		auth.RoleAdmin:   {auth.PermUsersList, auth.PermUsersRead, auth.PermUsersDelete},
+		auth.RoleSupport: {auth.PermUsersList, auth.PermUsersRead},
+		auth.RoleUser:    nil,
+	}}
+	policy := auth.NewPolicy(roles)
+	assert.Empty(t, policy.Permissions([]string{auth.RoleAdmin}), "nothing is granted before the first load")
+
+	require.NoError(t, policy.Load(t.Context()))
+	assert.Empty(t, policy.Permissions([]string{auth.RoleUser}))
+	assert.Empty(t, policy.Permissions([]string{"unknown"}))
+	assert.ElementsMatch(t,
+		[]string{auth.PermUsersList, auth.PermUsersRead, auth.PermUsersDelete},
+		policy.Permissions([]string{auth.RoleSupport, auth.RoleAdmin}))
+
+	// a failed reload keeps the last good mapping
+	roles.err = errors.New("db is down")
+	assert.Error(t, policy.Load(t.Context()))
+	assert.Equal(t, []string{auth.PermUsersList, auth.PermUsersRead}, policy.Permissions([]string{auth.RoleSupport}))
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	policy := auth.NewStaticPolicy(map[string][]string{
+		auth.RoleAdmin: {auth.PermUsersDelete},
+		auth.RoleUser:  nil,
+	})
+
+	r := gin.New()
+	r.Use(auth.WithPolicy(policy))
+	r.DELETE("/protected", auth.JWTAuth(keys, nil), auth.RequirePermission(auth.PermUsersDelete), fakeProtectedHandler)
+
+	call := func(roles []string) int {
+		token, err := keys.IssueJWT(1, "a@example.com", roles, time.Minute)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusForbidden, call(nil))
+	assert.Equal(t, http.StatusForbidden, call([]string{auth.RoleUser}))
+	assert.Equal(t, http.StatusOK, call([]string{auth.RoleUser, auth.RoleAdmin}))
+
+	// without WithPolicy nothing is granted
+	bare := gin.New()
+	bare.DELETE("/protected", auth.JWTAuth(keys, nil), auth.RequirePermission(auth.PermUsersDelete), fakeProtectedHandler)
+	token, err := keys.IssueJWT(1, "a@example.com", []string{auth.RoleAdmin}, time.Minute)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	bare.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
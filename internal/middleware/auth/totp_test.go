@@ -0,0 +1,94 @@
+package auth_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+)
+
+// rfc6238Secret is the SHA1 seed from the RFC 6238 test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// the RFC lists 8-digit codes; a 6-digit code is their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step := auth.TOTPStep(time.Unix(tt.unix, 0))
+		assert.Equal(t, tt.want, auth.TOTPCode(rfc6238Secret, step), "time %d", tt.unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := auth.TOTPStep(now)
+
+	step, ok := auth.VerifyTOTP(rfc6238Secret, "081804", now)
+	assert.True(t, ok)
+	assert.Equal(t, current, step)
+
+	// one period of clock drift either way is tolerated, two are not
+	_, ok = auth.VerifyTOTP(rfc6238Secret, auth.TOTPCode(rfc6238Secret, current-1), now)
+	assert.True(t, ok)
+	_, ok = auth.VerifyTOTP(rfc6238Secret, auth.TOTPCode(rfc6238Secret, current+1), now)
+	assert.True(t, ok)
+	_, ok = auth.VerifyTOTP(rfc6238Secret, auth.TOTPCode(rfc6238Secret, current+2), now)
+	assert.False(t, ok)
+	_, ok = auth.VerifyTOTP(rfc6238Secret, "", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := auth.NewTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 20)
+
+	u, err := url.Parse(auth.TOTPURI("acme", "a@example.com", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/acme:a@example.com", u.Path)
+	assert.Equal(t, auth.EncodeTOTPSecret(secret), u.Query().Get("secret"))
+	assert.Equal(t, "acme", u.Query().Get("issuer"))
+}
+
+func TestSecretBox(t *testing.T) {
+	box, err := auth.NewGeneratedSecretBox()
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("totp seed"), []byte("user:1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "totp seed")
+	opened, err := box.Open(sealed, []byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "totp seed", string(opened))
+
+	// a different key, different additional data or a tampered ciphertext does not open
+	other, err := auth.NewGeneratedSecretBox()
+	require.NoError(t, err)
+	_, err = other.Open(sealed, []byte("user:1"))
+	assert.Error(t, err)
+	_, err = box.Open(sealed, []byte("user:2"))
+	assert.Error(t, err)
+	sealed[len(sealed)-1] ^= 0xff
+	_, err = box.Open(sealed, []byte("user:1"))
+	assert.Error(t, err)
+	_, err = box.Open([]byte("short"), nil)
+	assert.ErrorIs(t, err, auth.ErrMalformedCiphertext)
+
+	_, err = auth.NewSecretBox([]byte("too short"))
+	assert.Error(t, err)
+}
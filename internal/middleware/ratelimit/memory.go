@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process. Each replica limits on its own, so the effective limit of a
+// deployment is the per-replica limit times the number of replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+float64(now.Sub(b.updated))/float64(interval))
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(interval)), nil
+	}
+	b.tokens--
+	return 0, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, prefix string, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, b := range s.buckets {
+		if strings.HasPrefix(key, prefix) && b.updated.Before(before) {
+			delete(s.buckets, key)
+			n++
+		}
+	}
+	return n, nil
+}
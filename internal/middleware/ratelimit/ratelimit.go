@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+)
+
+// ErrTooManyRequests is what Middleware answers once a bucket is empty.
+var ErrTooManyRequests = apperr.RateLimited("rate_limited", "too many requests")
+
+// Store holds token buckets. MemoryStore keeps them in process; dal.NewRateLimitRepository keeps them in
+// Postgres so every replica draws from the same buckets.
+type Store interface {
+	Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error)
+	Prune(ctx context.Context, prefix string, before time.Time) (int64, error)
+}
+
+// Limit allows bursts of up to Burst requests and one more every Interval after that.
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// refillTime is how long an empty bucket takes to fill up again.
+func (l Limit) refillTime() time.Duration {
+	return time.Duration(l.Burst) * l.Interval
+}
+
+// Limiter is a token bucket rate limiter. Each key gets its own bucket; name keeps the keys of limiters
+// that share a store apart.
+type Limiter struct {
+	store Store
+	name  string
+	limit Limit
+}
+
+func New(store Store, name string, limit Limit) *Limiter {
+	return &Limiter{store: store, name: name, limit: limit}
+}
+
+// Allow takes a token from key's bucket. It returns zero when the request may proceed and otherwise how long
+// the caller should wait before retrying.
+func (l *Limiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	return l.store.Take(ctx, l.prefix()+key, l.limit.Burst, l.limit.Interval)
+}
+
+func (l *Limiter) prefix() string {
+	return l.name + ":"
+}
+
+// Run prunes this limiter's idle buckets every interval until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.store.Prune(ctx, l.prefix(), time.Now().Add(-l.limit.refillTime())); err != nil {
+				logging.FromContext(ctx).Error("rate limit prune failed", "limiter", l.name, "error", err)
+			}
+		}
+	}
+}
+
+// Middleware rejects requests with a 429 and a Retry-After header once the bucket keyed by keyFunc is empty.
+// If the store fails the request is let through, so an outage of the store does not take the route down.
+func (l *Limiter) Middleware(keyFunc func(*gin.Context) string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		wait, err := l.Allow(ctx, keyFunc(ctx))
+		if err != nil {
+			logging.FromContext(ctx).Error("rate limit check failed", "limiter", l.name, "error", err)
+			ctx.Next()
+			return
+		}
+		if wait > 0 {
+			apperr.Abort(ctx, ErrTooManyRequests.WithRetryAfter(wait))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// ByIP keys buckets on the client address. X-Forwarded-For only counts when the engine trusts the peer it
+// came from, see gin.Engine.SetTrustedProxies; otherwise any client could name a new address per request.
+func ByIP(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	// a fresh bucket allows a full burst
+	for i := 0; i < 3; i++ {
+		wait, err := store.Take(t.Context(), "k", 3, time.Second)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := store.Take(t.Context(), "k", 3, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	// other keys have their own bucket
+	wait, err = store.Take(t.Context(), "other", 3, time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// refused attempts do not push the refill back
+	now = now.Add(400 * time.Millisecond)
+	wait, _ = store.Take(t.Context(), "k", 3, time.Second)
+	assert.Equal(t, 600*time.Millisecond, wait)
+	now = now.Add(600 * time.Millisecond)
+	wait, _ = store.Take(t.Context(), "k", 3, time.Second)
+	assert.Zero(t, wait)
+
+	// the bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		wait, _ = store.Take(t.Context(), "k", 3, time.Second)
+		assert.Zero(t, wait)
+	}
+	wait, _ = store.Take(t.Context(), "k", 3, time.Second)
+	assert.Positive(t, wait)
+}
+
+func TestMemoryStore_Prune(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.Take(t.Context(), "a:1", 1, time.Second)
+	store.Take(t.Context(), "b:1", 1, time.Second)
+	now = now.Add(time.Minute)
+	store.Take(t.Context(), "a:2", 1, time.Second)
+
+	n, err := store.Prune(t.Context(), "a:", now.Add(-time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.NotContains(t, store.buckets, "a:1")
+	assert.Contains(t, store.buckets, "a:2")
+	assert.Contains(t, store.buckets, "b:1")
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryStore()
+	limiter := New(store, "test", Limit{Burst: 2, Interval: time.Minute})
+
+	r := gin.New()
+	r.GET("/", limiter.Middleware(ByIP), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	call := func(addr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call("192.0.2.1:1000").Code)
+	assert.Equal(t, http.StatusOK, call("192.0.2.1:1001").Code)
+	w := call("192.0.2.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, apperr.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+	assert.Equal(t, http.StatusOK, call("192.0.2.2:1000").Code)
+	assert.Contains(t, store.buckets, "test:192.0.2.1")
+}
+
+func TestByIP_TrustsOnlyConfiguredProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	call := func(r *gin.Engine, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	engine := func(proxies []string) *gin.Engine {
+		limiter := New(NewMemoryStore(), "test", Limit{Burst: 1, Interval: time.Minute})
+		r := gin.New()
+		require.NoError(t, r.SetTrustedProxies(proxies))
+		r.GET("/", limiter.Middleware(ByIP), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+		return r
+	}
+
+	// — without trusted proxies a spoofed X-Forwarded-For does not get a fresh bucket
+	r := engine(nil)
+	assert.Equal(t, http.StatusOK, call(r, "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, call(r, "198.51.100.2"))
+
+	// — behind a trusted proxy each forwarded client has its own bucket
+	r = engine([]string{"10.0.0.0/8"})
+	assert.Equal(t, http.StatusOK, call(r, "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, call(r, "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, call(r, "198.51.100.2"))
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// UserMFA is a user's TOTP enrollment. The secret is stored encrypted and MFA is only enforced once the
+// enrollment has been confirmed with a valid code.
+type UserMFA struct {
+	UserId           int64      `db:"user_id"`
+	SecretCiphertext []byte     `db:"secret_ciphertext"`
+	ConfirmedAt      *time.Time `db:"confirmed_at"`
+	// LastUsedStep is the most recent TOTP time step accepted, so a code cannot be replayed.
+	LastUsedStep *int64    `db:"last_used_step"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFALoginInput exchanges the token returned by a password login for real tokens. Code is either a TOTP
+// code or one of the user's recovery codes.
+type MFALoginInput struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// LoginResponse is either a token pair or, for accounts with MFA enabled, a short-lived token to present
+// together with a second factor.
+type LoginResponse struct {
+	*TokenPair
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
@@ -0,0 +1,6 @@
+package model
+
+// POST /users/:object_id/roles
+type GrantRoleInput struct {
+	Role string `json:"role" validate:"required"`
+}
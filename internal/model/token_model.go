@@ -0,0 +1,87 @@
+package model
+
+import (
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+type RefreshToken struct {
+	Id        int64      `db:"id"`
+	UserId    int64      `db:"user_id"`
+	FamilyId  string     `db:"family_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	RotatedAt *time.Time `db:"rotated_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// POST /auth/refresh
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TokenRevocation revokes a single access token when Jti is set, or every token issued to UserId at or
+// before RevokedBefore.
+type TokenRevocation struct {
+	Id            int64      `db:"id"`
+	Jti           *string    `db:"jti"`
+	UserId        int64      `db:"user_id"`
+	RevokedBefore *time.Time `db:"revoked_before"`
+	ExpiresAt     time.Time  `db:"expires_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// POST /users/logout
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordResetToken struct {
+	Id        int64      `db:"id"`
+	UserId    int64      `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// POST /users/password/forgot
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email_address"`
+}
+
+func (i *ForgotPasswordInput) Normalize() {
+	i.Email = validation.NormalizeEmail(i.Email)
+}
+
+// POST /users/password/reset
+type ResetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// EmailVerificationToken confirms that the user controls Email, either their signup address or a pending
+// change.
+type EmailVerificationToken struct {
+	Id        int64      `db:"id"`
+	UserId    int64      `db:"user_id"`
+	Email     string     `db:"email"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// GET /users/verify-email
+type VerifyEmailParams struct {
+	Token string `form:"token" validate:"required"`
+}
@@ -2,18 +2,31 @@ package model
 
 import (
 	"time"
+
+	"github.com/thornhall/simple-go-service/internal/validation"
 )
 
 type User struct {
-	Id           int64     `db:"id"`
-	ObjectId     string    `db:"object_id"`
-	FirstName    string    `db:"first_name"`
-	LastName     string    `db:"last_name"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
-	IsDeleted    bool      `db:"is_deleted"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash"`
+	Id              int64      `db:"id"`
+	ObjectId        string     `db:"object_id"`
+	FirstName       string     `db:"first_name"`
+	LastName        *string    `db:"last_name"`
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+	IsDeleted       bool       `db:"is_deleted"`
+	DeletedAt       *time.Time `db:"deleted_at"`
+	Email           string     `db:"email"`
+	PasswordHash    string     `db:"password_hash"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	// PendingEmail holds a requested email change until the new address is confirmed.
+	PendingEmail *string `db:"pending_email"`
+	// FailedLoginAttempts counts wrong passwords since the last successful login.
+	FailedLoginAttempts int        `db:"failed_login_attempts"`
+	LockedUntil         *time.Time `db:"locked_until"`
+	// Roles are the names of the roles granted to the user, sorted.
+	Roles []string `db:"roles"`
+	// Version starts at 1 and increases with every change to the user that clients can see.
+	Version int64 `db:"version"`
 }
 
 type UserCreateResponse struct {
@@ -26,34 +39,120 @@ type UserCreateResponse struct {
 }
 
 type UserResponse struct {
-	ObjectId  string `json:"object_id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
+	ObjectId      string     `json:"object_id"`
+	FirstName     string     `json:"first_name"`
+	LastName      *string    `json:"last_name"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	PendingEmail  *string    `json:"pending_email,omitempty"`
+	Roles         []string   `json:"roles,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	// Version is served as the ETag header rather than in the body.
+	Version int64 `json:"-"`
 }
 
 type CreateUserResponse struct {
 	*UserResponse
-	JWT string `json:"jwt"`
+	*TokenPair
 }
 
 // POST /users/login
+// Password is only required, not checked for strength, so accounts created under older rules can still log
+// in.
 type LoginUserInput struct {
-	Email    string `json:"email" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" validate:"required,email_address"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+func (i *LoginUserInput) Normalize() {
+	i.Email = validation.NormalizeEmail(i.Email)
 }
 
 // POST /users
 type CreateUserInput struct {
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=8,max=64"`
+	FirstName string `json:"first_name" validate:"required,person_name"`
+	LastName  string `json:"last_name" validate:"optional_name"`
+	Email     string `json:"email" validate:"required,email_address"`
+	Password  string `json:"password" validate:"required,password"`
+}
+
+func (i *CreateUserInput) Normalize() {
+	i.FirstName = validation.NormalizeName(i.FirstName)
+	i.LastName = validation.NormalizeName(i.LastName)
+	i.Email = validation.NormalizeEmail(i.Email)
 }
 
-// PUT /users
+// PUT /users/:object_id
+// It replaces the whole profile: an omitted, null or empty last name clears it. Email is the address the
+// user wants, so their current one cancels a pending change.
 type UpdateUserInput struct {
-	FirstName *string `json:"first_name,omitempty"`
-	LastName  *string `json:"last_name,omitempty"`
-	Email     *string `json:"email,omitempty"`
+	FirstName string  `json:"first_name" validate:"required,person_name"`
+	LastName  *string `json:"last_name" validate:"omitnil,optional_name"`
+	Email     string  `json:"email" validate:"required,email_address"`
+}
+
+func (i *UpdateUserInput) Normalize() {
+	i.FirstName = validation.NormalizeName(i.FirstName)
+	if i.LastName != nil {
+		if name := validation.NormalizeName(*i.LastName); name != "" {
+			i.LastName = &name
+		} else {
+			i.LastName = nil
+		}
+	}
+	i.Email = validation.NormalizeEmail(i.Email)
+}
+
+// PATCH /users/:object_id as application/merge-patch+json
+// Only the fields present change, and a null last name clears it. It documents the body: the handler
+// applies the patch to the user rather than binding it.
+type UserMergePatch struct {
+	FirstName *string `json:"first_name,omitempty" validate:"omitnil,person_name"`
+	LastName  *string `json:"last_name,omitempty" validate:"omitnil,optional_name"`
+	Email     *string `json:"email,omitempty" validate:"omitnil,email_address"`
+}
+
+// UserPatchFields are the fields of a user PATCH /users/:object_id may change, named as in UpdateUserInput.
+var UserPatchFields = []string{"first_name", "last_name", "email"}
+
+// GET /users
+type ListUsersParams struct {
+	Limit         int        `form:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor        string     `form:"cursor"`
+	EmailPrefix   string     `form:"email_prefix"`
+	Name          string     `form:"name"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Deleted selects live users ("false", the default), soft-deleted users ("true") or both ("any").
+	Deleted string `form:"deleted" validate:"omitempty,oneof=true false any"`
+	// Sort is a field name, optionally prefixed with "-" for descending order.
+	Sort string `form:"sort" validate:"omitempty,oneof=created_at -created_at updated_at -updated_at email -email first_name -first_name last_name -last_name"`
+}
+
+type ListUsersResponse struct {
+	Users      []*UserResponse `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// UserListQuery is a page request against the users table, ordered by SortField and then id.
+type UserListQuery struct {
+	EmailPrefix   string
+	Name          string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Deleted filters on the soft-delete flag; nil returns both.
+	Deleted    *bool
+	SortField  string
+	Descending bool
+	// After resumes the listing after the row with this sort value and id.
+	After *UserCursor
+	Limit int
+}
+
+// UserCursor is the position of the last row of a page.
+type UserCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
 }
@@ -0,0 +1,44 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:embed swagger.html
+var swaggerPage string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerPage))
+
+// Handler serves doc as JSON. The document is encoded once, up front.
+func Handler(doc *Document) (gin.HandlerFunc, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json", body)
+	}, nil
+}
+
+// UI serves Swagger UI pointed at specURL. It must be mounted on a wildcard route named filepath, e.g.
+// /docs/*filepath; its own page is served at the wildcard's root and the UI's assets next to it.
+func UI(specURL string) gin.HandlerFunc {
+	assets := http.FS(swaggerFiles.FS)
+	return func(ctx *gin.Context) {
+		file := strings.TrimPrefix(ctx.Param("filepath"), "/")
+		if file == "" || file == "index.html" {
+			ctx.Header("Content-Type", "text/html; charset=utf-8")
+			ctx.Status(http.StatusOK)
+			_ = swaggerTemplate.Execute(ctx.Writer, specURL)
+			return
+		}
+		ctx.FileFromFS(file, assets)
+	}
+}
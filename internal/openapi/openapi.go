@@ -0,0 +1,236 @@
+// Package openapi builds the service's OpenAPI 3.1 document from the routes registered on a gin engine and
+// the model types their handlers bind and return, and serves it together with Swagger UI. Each registered
+// route must be described by a Route and each Route must be registered, so the document cannot drift from
+// the router.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+)
+
+// Version is the OpenAPI version documents are written in.
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps a lowercase HTTP method to its operation.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Response is either a response or, when Ref is set, a reference to one in Components.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	Responses       map[string]Response       `json:"responses"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Route describes the operation served at Method and Path, in gin's syntax.
+type Route struct {
+	Method      string
+	Path        string
+	OperationId string
+	Summary     string
+	Description string
+	Tags        []string
+	// Auth marks routes behind the JWT middleware. Permission names the one they additionally require.
+	Auth       bool
+	Permission string
+	// Query is the struct the handler binds the query string into, and Body the one it binds the request
+	// body into. OptionalBody documents a body that may be omitted.
+	Query        any
+	Body         any
+	OptionalBody bool
+	// Bodies documents a body the handler takes in several media types, each with a schema of its own,
+	// for routes that do not take application/json.
+	Bodies map[string]any
+	// Headers names the optional request headers the handler reads, such as If-Match.
+	Headers []string
+	// Status is the success status. Response is the value served with it, nil for an empty response.
+	Status   int
+	Response any
+	// ContentType is the media type of Response, application/json unless set.
+	ContentType string
+}
+
+const (
+	bearerScheme    = "bearerAuth"
+	problemResponse = "Problem"
+)
+
+// Build describes the routes registered on an engine. It fails, naming each one, when a registered route
+// has no Route or a Route is not registered.
+func Build(info Info, registered gin.RoutesInfo, routes []Route) (*Document, error) {
+	described := make(map[string]Route, len(routes))
+	for _, r := range routes {
+		described[r.Method+" "+r.Path] = r
+	}
+	var drift []error
+	seen := make(map[string]bool, len(registered))
+	for _, r := range registered {
+		key := r.Method + " " + r.Path
+		seen[key] = true
+		if _, ok := described[key]; !ok {
+			drift = append(drift, fmt.Errorf("%s is registered but not documented", key))
+		}
+	}
+	for _, r := range routes {
+		if key := r.Method + " " + r.Path; !seen[key] {
+			drift = append(drift, fmt.Errorf("%s is documented but not registered", key))
+		}
+	}
+	if len(drift) > 0 {
+		sort.Slice(drift, func(i, j int) bool { return drift[i].Error() < drift[j].Error() })
+		return nil, errors.Join(drift...)
+	}
+
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.schemas,
+			Responses: map[string]Response{
+				problemResponse: {
+					Description: "The request failed. Code says why.",
+					Content:     map[string]MediaType{apperr.ContentType: {Schema: g.schema(reflect.TypeOf(apperr.Problem{}))}},
+				},
+			},
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+	for _, r := range routes {
+		path := openAPIPath(r.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = g.operation(r)
+	}
+	return doc, nil
+}
+
+func (g *generator) operation(r Route) *Operation {
+	op := &Operation{
+		OperationId: r.OperationId,
+		Summary:     r.Summary,
+		Description: r.Description,
+		Tags:        r.Tags,
+		Responses:   map[string]Response{"default": {Ref: "#/components/responses/" + problemResponse}},
+	}
+	if r.Auth {
+		op.Security = []map[string][]string{{bearerScheme: {}}}
+	}
+	if r.Permission != "" {
+		op.Description = strings.TrimSpace(op.Description + "\n\nRequires the " + r.Permission + " permission.")
+	}
+	for _, name := range pathParams(r.Path) {
+		op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	if r.Query != nil {
+		op.Parameters = append(op.Parameters, g.queryParams(reflect.TypeOf(r.Query))...)
+	}
+	for _, name := range r.Headers {
+		op.Parameters = append(op.Parameters, Parameter{Name: name, In: "header", Schema: &Schema{Type: "string"}})
+	}
+	if r.Body != nil || r.Bodies != nil {
+		op.RequestBody = &RequestBody{Required: !r.OptionalBody, Content: map[string]MediaType{}}
+		if r.Body != nil {
+			op.RequestBody.Content["application/json"] = MediaType{Schema: g.schema(reflect.TypeOf(r.Body))}
+		}
+		for mediaType, body := range r.Bodies {
+			op.RequestBody.Content[mediaType] = MediaType{Schema: g.schema(reflect.TypeOf(body))}
+		}
+	}
+	resp := Response{Description: http.StatusText(r.Status)}
+	if r.Response != nil {
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		resp.Content = map[string]MediaType{contentType: {Schema: g.schema(reflect.TypeOf(r.Response))}}
+	}
+	op.Responses[strconv.Itoa(r.Status)] = resp
+	return op
+}
+
+// openAPIPath rewrites gin's :name and *name parameters as {name}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			names = append(names, s[1:])
+		}
+	}
+	return names
+}
@@ -0,0 +1,158 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/openapi"
+)
+
+type widgetInput struct {
+	Name  string  `json:"name" validate:"required,min=2,max=40"`
+	Color *string `json:"color,omitempty" validate:"omitnil,oneof=red blue"`
+	Owner string  `json:"owner" validate:"required,email_address"`
+}
+
+type Audit struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Widget struct {
+	*Audit
+	Id     string            `json:"id"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Parts  []Widget          `json:"parts"`
+	secret string
+}
+
+type widgetQuery struct {
+	Limit int    `form:"limit" validate:"omitempty,min=1,max=100"`
+	Sort  string `form:"sort"`
+}
+
+var widgetRoutes = []openapi.Route{
+	{Method: "POST", Path: "/widgets", OperationId: "createWidget", Body: widgetInput{}, Status: http.StatusCreated, Response: Widget{}},
+	{Method: "GET", Path: "/widgets", OperationId: "listWidgets", Auth: true, Permission: "widgets:list", Query: widgetQuery{}, Status: http.StatusOK, Response: []Widget{}},
+	{Method: "DELETE", Path: "/widgets/:id", OperationId: "deleteWidget", Auth: true, Headers: []string{"If-Match"}, Status: http.StatusNoContent},
+	{Method: "PATCH", Path: "/widgets/:id", OperationId: "patchWidget", Auth: true,
+		Bodies: map[string]any{"application/merge-patch+json": map[string]any{}, "application/json-patch+json": []widgetInput{}},
+		Status: http.StatusOK, Response: Widget{}},
+}
+
+func engine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	noop := func(*gin.Context) {}
+	r.POST("/widgets", noop)
+	r.GET("/widgets", noop)
+	r.DELETE("/widgets/:id", noop)
+	r.PATCH("/widgets/:id", noop)
+	return r
+}
+
+func build(t *testing.T) map[string]any {
+	t.Helper()
+	doc, err := openapi.Build(openapi.Info{Title: "widgets", Version: "1"}, engine().Routes(), widgetRoutes)
+	require.NoError(t, err)
+	body, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(body, &out))
+	return out
+}
+
+func TestBuild_DescribesRoutes(t *testing.T) {
+	doc := build(t)
+	assert.Equal(t, "3.1.0", doc["openapi"])
+
+	paths := doc["paths"].(map[string]any)
+	require.Contains(t, paths, "/widgets/{id}", "gin parameters are rewritten")
+	del := paths["/widgets/{id}"].(map[string]any)["delete"].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"bearerAuth": []any{}}}, del["security"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "If-Match", "in": "header", "schema": map[string]any{"type": "string"}},
+	}, del["parameters"])
+	assert.Contains(t, del["responses"], "204")
+	assert.Contains(t, del["responses"], "default")
+
+	list := paths["/widgets"].(map[string]any)["get"].(map[string]any)
+	assert.Contains(t, list["description"], "widgets:list")
+	assert.Equal(t, []any{
+		map[string]any{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "format": "int32", "minimum": 1.0, "maximum": 100.0}},
+		map[string]any{"name": "sort", "in": "query", "schema": map[string]any{"type": "string"}},
+	}, list["parameters"])
+}
+
+func TestBuild_SchemasFollowTags(t *testing.T) {
+	doc := build(t)
+	create := doc["paths"].(map[string]any)["/widgets"].(map[string]any)["post"].(map[string]any)
+	body := create["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+	assert.Equal(t, map[string]any{"$ref": "#/components/schemas/widgetInput"}, body)
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string", "minLength": 2.0, "maxLength": 40.0},
+			"color": map[string]any{"type": "string", "enum": []any{"red", "blue"}},
+			"owner": map[string]any{"type": "string", "format": "email", "maxLength": 254.0},
+		},
+		"required": []any{"name", "owner"},
+	}, schemas["widgetInput"])
+
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+			"id":         map[string]any{"type": "string"},
+			"labels":     map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"parts":      map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Widget"}},
+		},
+	}, schemas["Widget"], "embedded structs are flattened and unexported fields skipped")
+	assert.Contains(t, schemas, "Problem")
+
+	patch := doc["paths"].(map[string]any)["/widgets/{id}"].(map[string]any)["patch"].(map[string]any)
+	assert.Equal(t, map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/merge-patch+json": map[string]any{"schema": map[string]any{"type": "object", "additionalProperties": map[string]any{}}},
+			"application/json-patch+json":  map[string]any{"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/widgetInput"}}},
+		},
+	}, patch["requestBody"], "each media type has its own schema")
+}
+
+func TestBuild_ReportsDrift(t *testing.T) {
+	r := engine()
+	r.PUT("/widgets/:id", func(*gin.Context) {})
+	routes := append(widgetRoutes[:2:2], openapi.Route{Method: "GET", Path: "/gadgets", Status: http.StatusOK})
+
+	_, err := openapi.Build(openapi.Info{}, r.Routes(), routes)
+	require.Error(t, err)
+	assert.Equal(t, "DELETE /widgets/:id is registered but not documented\n"+
+		"GET /gadgets is documented but not registered\n"+
+		"PATCH /widgets/:id is registered but not documented\n"+
+		"PUT /widgets/:id is registered but not documented", err.Error())
+}
+
+func TestUI(t *testing.T) {
+	r := engine()
+	r.GET("/docs/*filepath", openapi.UI("/openapi.json"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "javascript")
+}
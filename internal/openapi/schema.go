@@ -0,0 +1,187 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema the generator emits.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// generator turns Go types into schemas. Named structs are added to schemas once and referenced.
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]*Schema{}}
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// claim the name first so a type that refers to itself terminates
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.object(t)
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	default:
+		// interfaces can hold anything
+		return &Schema{}
+	}
+}
+
+// object describes a struct the way encoding/json writes it: by json name, with embedded structs
+// flattened into their parent.
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, s)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop, required := g.field(f)
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// queryParams describes the `form` fields of a query struct.
+func (g *generator) queryParams(t reflect.Type) []Parameter {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		schema, required := g.field(f)
+		params = append(params, Parameter{Name: name, In: "query", Required: required, Schema: schema})
+	}
+	return params
+}
+
+// field describes f, narrowed by the rules in its `validate` tag, and reports whether it is required.
+func (g *generator) field(f reflect.StructField) (*Schema, bool) {
+	s := g.schema(f.Type)
+	required := false
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			bound(s, name, param)
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		default:
+			if narrow, ok := ruleSchemas[name]; ok {
+				narrow(s)
+			}
+		}
+	}
+	return s, required
+}
+
+// bound applies a min, max or len rule: a length for strings and arrays, a value for numbers.
+func bound(s *Schema, rule, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	if s.Type == "integer" || s.Type == "number" {
+		if rule != "max" {
+			s.Minimum = &n
+		}
+		if rule != "min" {
+			s.Maximum = &n
+		}
+		return
+	}
+	if s.Type != "string" {
+		return
+	}
+	length := int(n)
+	if rule != "max" {
+		s.MinLength = &length
+	}
+	if rule != "min" {
+		s.MaxLength = &length
+	}
+}
+
+// ruleSchemas documents the rules registered by package validation.
+var ruleSchemas = map[string]func(*Schema){
+	"email_address": func(s *Schema) { s.Format, s.MaxLength = "email", intPtr(254) },
+	"person_name":   func(s *Schema) { s.MinLength, s.MaxLength = intPtr(1), intPtr(100) },
+	"optional_name": func(s *Schema) { s.MaxLength = intPtr(100) },
+	"password":      func(s *Schema) { s.Format, s.MinLength, s.MaxLength = "password", intPtr(8), intPtr(64) },
+}
+
+func intPtr(n int) *int { return &n }
@@ -0,0 +1,161 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Operation is one operation of a JSON patch as sent. A JSON patch is a list of them.
+type Operation struct {
+	// Op is one of add, remove, replace, move, copy and test.
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// From is the field move and copy read.
+	From string `json:"from,omitempty"`
+	// Value is what add and replace write and test compares with.
+	Value any `json:"value,omitempty"`
+}
+
+// jsonPatch is an RFC 6902 JSON patch: a list of operations applied in order, all or nothing.
+type jsonPatch []operation
+
+// operation is an Operation whose pointers have been resolved to the fields they name.
+type operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value any
+}
+
+func parseJSONPatch(body []byte, fields []string) (Patch, error) {
+	var raw []json.RawMessage
+	if err := decode(body, &raw); err != nil {
+		return nil, err
+	}
+	ops := make(jsonPatch, 0, len(raw))
+	var names []string
+	for i, r := range raw {
+		op, err := parseOperation(r)
+		if err != nil {
+			return nil, ErrInvalid.Wrap(fmt.Errorf("operation %d: %w", i, err))
+		}
+		// test only reads, but a field the patch could not change is no business of the client's either
+		names = append(names, op.Path)
+		if op.Op == "move" || op.Op == "copy" {
+			names = append(names, op.From)
+		}
+		ops = append(ops, op)
+	}
+	if err := notAllowed(dedupe(names), fields); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// parseOperation checks that raw is a complete Operation and resolves its pointers to field names.
+func parseOperation(raw json.RawMessage) (operation, error) {
+	var sent Operation
+	// the members tell a missing value from a null one, which sent cannot
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sent); err != nil {
+		return operation{}, err
+	}
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return operation{}, err
+	}
+	op := operation{Op: sent.Op, Value: sent.Value}
+	var needsFrom, needsValue bool
+	switch sent.Op {
+	case "add", "replace", "test":
+		needsValue = true
+	case "move", "copy":
+		needsFrom = true
+	case "remove":
+	default:
+		return op, fmt.Errorf("unknown op %q", sent.Op)
+	}
+	var err error
+	if op.Path, err = field(sent.Path); err != nil {
+		return op, err
+	}
+	if needsFrom {
+		if _, ok := members["from"]; !ok {
+			return op, fmt.Errorf("%s needs a from", sent.Op)
+		}
+		if op.From, err = field(sent.From); err != nil {
+			return op, err
+		}
+	}
+	if _, ok := members["value"]; needsValue && !ok {
+		return op, fmt.Errorf("%s needs a value", sent.Op)
+	}
+	return op, nil
+}
+
+// field returns the member a JSON pointer (RFC 6901) of exactly one reference token names.
+func field(pointer string) (string, error) {
+	token, ok := strings.CutPrefix(pointer, "/")
+	if !ok {
+		return "", fmt.Errorf("pointer %q must name a field", pointer)
+	}
+	if strings.Contains(token, "/") {
+		return "", fmt.Errorf("pointer %q must name a top-level field", pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token), nil
+}
+
+func (p jsonPatch) Apply(doc Document) (Document, error) {
+	out := clone(doc).(Document)
+	for i, op := range p {
+		if err := op.apply(out); err != nil {
+			return nil, ErrConflict.Wrap(fmt.Errorf("operation %d: %w", i, err))
+		}
+	}
+	return out, nil
+}
+
+func (op operation) apply(doc Document) error {
+	switch op.Op {
+	case "add":
+		doc[op.Path] = clone(op.Value)
+	case "remove":
+		if _, ok := doc[op.Path]; !ok {
+			return fmt.Errorf("no %s to remove", op.Path)
+		}
+		delete(doc, op.Path)
+	case "replace":
+		if _, ok := doc[op.Path]; !ok {
+			return fmt.Errorf("no %s to replace", op.Path)
+		}
+		doc[op.Path] = clone(op.Value)
+	case "move", "copy":
+		value, ok := doc[op.From]
+		if !ok {
+			return fmt.Errorf("no %s to %s", op.From, op.Op)
+		}
+		if op.Op == "move" {
+			delete(doc, op.From)
+		}
+		doc[op.Path] = clone(value)
+	case "test":
+		if value, ok := doc[op.Path]; !ok || !reflect.DeepEqual(value, op.Value) {
+			return fmt.Errorf("%s does not match", op.Path)
+		}
+	}
+	return nil
+}
+
+// dedupe returns names without repeats, in the order they first appear.
+func dedupe(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
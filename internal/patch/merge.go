@@ -0,0 +1,50 @@
+package patch
+
+import (
+	"maps"
+	"slices"
+)
+
+// mergePatch is an RFC 7396 merge patch: an object whose members replace those of the target, where null
+// removes a member and a nested object is merged recursively.
+type mergePatch map[string]any
+
+func parseMergePatch(body []byte, fields []string) (Patch, error) {
+	var v any
+	if err := decode(body, &v); err != nil {
+		return nil, err
+	}
+	// RFC 7396 lets a patch that is not an object replace the whole target, which no resource allows
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	names := slices.Sorted(maps.Keys(obj))
+	if err := notAllowed(names, fields); err != nil {
+		return nil, err
+	}
+	return mergePatch(obj), nil
+}
+
+func (p mergePatch) Apply(doc Document) (Document, error) {
+	return Document(merge(clone(map[string]any(doc)).(map[string]any), p)), nil
+}
+
+// merge applies patch to target in place and returns it.
+func merge(target, patch map[string]any) map[string]any {
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, name)
+		case map[string]any:
+			nested, ok := target[name].(map[string]any)
+			if !ok {
+				nested = map[string]any{}
+			}
+			target[name] = merge(nested, value)
+		default:
+			target[name] = clone(value)
+		}
+	}
+	return target
+}
@@ -0,0 +1,122 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) documents to a resource's
+// JSON representation. A patch may only touch the fields the resource allows to change, and only top-level
+// ones: resources here are flat, so a pointer with more than one reference token is rejected.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"slices"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+// Media types of the patch formats Parse understands. Endpoints advertise them in Accept-Patch.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedType = apperr.UnsupportedMediaType("unsupported_patch_type", "send a merge patch or a JSON patch")
+	ErrInvalid         = apperr.Validation("invalid_patch", "request body is not a valid patch")
+	// ErrConflict means a well-formed patch cannot be applied to the resource as it is now, e.g. a test
+	// operation failed or an operation names a field the resource does not have.
+	ErrConflict = apperr.Conflict("patch_conflict", "patch cannot be applied to the current resource")
+)
+
+// Document is a resource's JSON representation, as json.Unmarshal decodes an object into an any.
+type Document map[string]any
+
+// Decode stores the document in dst, which must be a pointer. A value of the wrong JSON type is reported
+// against its field like any other validation failure.
+func (d Document) Decode(dst any) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, dst)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return validation.TypeError(typeErr)
+	}
+	return err
+}
+
+// Patch is a parsed patch document.
+type Patch interface {
+	// Apply returns the patched copy of doc, leaving doc itself unchanged. A patch that fails part way
+	// changes nothing.
+	Apply(doc Document) (Document, error)
+}
+
+// Parse reads body as a patch of contentType that may only change fields. Unknown content types fail with
+// ErrUnsupportedType, malformed patches with ErrInvalid, and patches of any other field with
+// validation.ErrInvalid naming each of them.
+func Parse(contentType string, body []byte, fields ...string) (Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedType.Wrap(err)
+	}
+	switch mediaType {
+	case MergePatchType:
+		return parseMergePatch(body, fields)
+	case JSONPatchType:
+		return parseJSONPatch(body, fields)
+	default:
+		return nil, ErrUnsupportedType
+	}
+}
+
+// decode unmarshals body into dst, refusing trailing data after the JSON value.
+func decode(body []byte, dst any) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if err := dec.Decode(dst); err != nil {
+		return ErrInvalid.Wrap(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return ErrInvalid.Wrap(errors.New("unexpected data after the patch"))
+	}
+	return nil
+}
+
+// notAllowed reports the fields a patch may not change, or nil if there are none.
+func notAllowed(names []string, fields []string) error {
+	var problems []apperr.FieldError
+	for _, name := range names {
+		if !slices.Contains(fields, name) {
+			problems = append(problems, apperr.FieldError{Field: name, Code: "not_allowed", Message: "cannot be changed"})
+		}
+	}
+	if problems == nil {
+		return nil
+	}
+	return validation.ErrInvalid.WithFields(problems...)
+}
+
+// clone deep copies a value decoded from JSON, so patched documents never share maps or slices with the
+// document they came from.
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = clone(e)
+		}
+		return c
+	case Document:
+		return Document(clone(map[string]any(v)).(map[string]any))
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = clone(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
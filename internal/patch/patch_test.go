@@ -0,0 +1,138 @@
+package patch_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/patch"
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+var fields = []string{"first_name", "last_name", "email"}
+
+func original() patch.Document {
+	return patch.Document{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com"}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want patch.Document
+	}{
+		{name: "replaces members", body: `{"first_name":"Grace"}`,
+			want: patch.Document{"first_name": "Grace", "last_name": "Lovelace", "email": "ada@example.com"}},
+		{name: "null removes a member", body: `{"last_name":null}`,
+			want: patch.Document{"first_name": "Ada", "email": "ada@example.com"}},
+		{name: "objects merge recursively", body: `{"last_name":{"a":1,"b":null}}`,
+			want: patch.Document{"first_name": "Ada", "last_name": map[string]any{"a": 1.0}, "email": "ada@example.com"}},
+		{name: "empty patch", body: `{}`, want: original()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := patch.Parse(patch.MergePatchType, []byte(tt.body), fields...)
+			require.NoError(t, err)
+			doc := original()
+			got, err := p.Apply(doc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, original(), doc, "the original is left unchanged")
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want patch.Document
+		// conflict means the patch parses but cannot be applied
+		conflict bool
+	}{
+		{name: "replace", body: `[{"op":"replace","path":"/first_name","value":"Grace"}]`,
+			want: patch.Document{"first_name": "Grace", "last_name": "Lovelace", "email": "ada@example.com"}},
+		{name: "remove", body: `[{"op":"remove","path":"/last_name"}]`,
+			want: patch.Document{"first_name": "Ada", "email": "ada@example.com"}},
+		{name: "add null", body: `[{"op":"add","path":"/last_name","value":null}]`,
+			want: patch.Document{"first_name": "Ada", "last_name": nil, "email": "ada@example.com"}},
+		{name: "copy then move", body: `[{"op":"copy","from":"/first_name","path":"/email"},{"op":"move","from":"/last_name","path":"/first_name"}]`,
+			want: patch.Document{"first_name": "Lovelace", "email": "Ada"}},
+		{name: "passing test", body: `[{"op":"test","path":"/first_name","value":"Ada"},{"op":"remove","path":"/last_name"}]`,
+			want: patch.Document{"first_name": "Ada", "email": "ada@example.com"}},
+		{name: "failing test", body: `[{"op":"remove","path":"/last_name"},{"op":"test","path":"/first_name","value":"Grace"}]`, conflict: true},
+		{name: "replace a missing member", body: `[{"op":"remove","path":"/last_name"},{"op":"replace","path":"/last_name","value":"X"}]`, conflict: true},
+		{name: "move a missing member", body: `[{"op":"remove","path":"/last_name"},{"op":"move","from":"/last_name","path":"/email"}]`, conflict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := patch.Parse(patch.JSONPatchType, []byte(tt.body), fields...)
+			require.NoError(t, err)
+			doc := original()
+			got, err := p.Apply(doc)
+			if tt.conflict {
+				assert.ErrorIs(t, err, patch.ErrConflict)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.Equal(t, original(), doc, "the original is left unchanged, even by a patch that fails part way")
+		})
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        error
+	}{
+		{name: "plain JSON", contentType: "application/json", body: `{}`, want: patch.ErrUnsupportedType},
+		{name: "no content type", contentType: "", body: `{}`, want: patch.ErrUnsupportedType},
+		{name: "merge patch that is not an object", contentType: patch.MergePatchType, body: `["first_name"]`, want: patch.ErrInvalid},
+		{name: "malformed JSON", contentType: patch.MergePatchType, body: `{"first_name":`, want: patch.ErrInvalid},
+		{name: "trailing data", contentType: patch.MergePatchType, body: `{} {}`, want: patch.ErrInvalid},
+		{name: "JSON patch that is not a list", contentType: patch.JSONPatchType, body: `{"op":"remove","path":"/last_name"}`, want: patch.ErrInvalid},
+		{name: "unknown op", contentType: patch.JSONPatchType, body: `[{"op":"swap","path":"/last_name"}]`, want: patch.ErrInvalid},
+		{name: "missing value", contentType: patch.JSONPatchType, body: `[{"op":"add","path":"/last_name"}]`, want: patch.ErrInvalid},
+		{name: "missing from", contentType: patch.JSONPatchType, body: `[{"op":"move","path":"/last_name"}]`, want: patch.ErrInvalid},
+		{name: "whole document", contentType: patch.JSONPatchType, body: `[{"op":"replace","path":"","value":{}}]`, want: patch.ErrInvalid},
+		{name: "nested pointer", contentType: patch.JSONPatchType, body: `[{"op":"remove","path":"/roles/0"}]`, want: patch.ErrInvalid},
+		{name: "merge patch of another field", contentType: patch.MergePatchType, body: `{"password":"x"}`, want: validation.ErrInvalid},
+		{name: "JSON patch of another field", contentType: patch.JSONPatchType, body: `[{"op":"copy","from":"/password","path":"/email"}]`, want: validation.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := patch.Parse(tt.contentType, []byte(tt.body), fields...)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestParse_NamesFieldsNotAllowed(t *testing.T) {
+	_, err := patch.Parse(patch.MergePatchType, []byte(`{"roles":[],"email":"a@example.com","id":1}`), fields...)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "id", Code: "not_allowed", Message: "cannot be changed"},
+		{Field: "roles", Code: "not_allowed", Message: "cannot be changed"},
+	}, apperr.From(err).Fields)
+
+	// pointers are unescaped before they are checked
+	_, err = patch.Parse(patch.JSONPatchType+"; charset=utf-8", []byte(`[{"op":"remove","path":"/a~1b~0"}]`), fields...)
+	assert.Equal(t, []apperr.FieldError{{Field: "a/b~", Code: "not_allowed", Message: "cannot be changed"}}, apperr.From(err).Fields)
+}
+
+func TestDocument_Decode(t *testing.T) {
+	var dst struct {
+		FirstName string  `json:"first_name"`
+		LastName  *string `json:"last_name"`
+	}
+	require.NoError(t, patch.Document{"first_name": "Ada", "last_name": nil}.Decode(&dst))
+	assert.Equal(t, "Ada", dst.FirstName)
+	assert.Nil(t, dst.LastName)
+
+	err := patch.Document{"first_name": true}.Decode(&dst)
+	assert.Equal(t, []apperr.FieldError{{Field: "first_name", Code: "type", Message: "must be a string"}}, apperr.From(err).Fields)
+}
@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, t *model.EmailVerificationToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error)
+	// MarkUsed consumes an unused token. It reports false if the token was already used.
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+}
@@ -0,0 +1,17 @@
+package repo
+
+import "github.com/thornhall/simple-go-service/internal/apperr"
+
+// Errors repositories return, possibly wrapping the driver error, so services can tell a missing row or a
+// violated constraint from an outage. Services usually replace them with an error of their own before they
+// reach a client.
+var (
+	// ErrNotFound means no row matched.
+	ErrNotFound = apperr.NotFound("not_found", "record not found")
+	// ErrConflict means a write violated a unique or foreign key constraint.
+	ErrConflict = apperr.Conflict("conflict", "record conflicts with existing data")
+	// ErrStale means a write was refused because the row changed since the version it was based on was read.
+	ErrStale = apperr.Conflict("stale", "record was changed by another request")
+	// ErrInvalid means the database rejected a value, e.g. a malformed uuid or a failed check constraint.
+	ErrInvalid = apperr.Validation("invalid_input", "invalid input")
+)
@@ -0,0 +1,22 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+type MFARepository interface {
+	// Upsert stores a new enrollment for the user, replacing any unconfirmed one.
+	Upsert(ctx context.Context, m *model.UserMFA) error
+	// FindByUserId returns nil and no error when the user has never enrolled.
+	FindByUserId(ctx context.Context, userId int64) (*model.UserMFA, error)
+	Confirm(ctx context.Context, userId int64) error
+	// UseStep records that a TOTP time step was accepted. It reports false if this or a later step was
+	// already used.
+	UseStep(ctx context.Context, userId int64, step int64) (bool, error)
+	// ReplaceRecoveryCodes discards the user's recovery codes and stores the given hashes instead.
+	ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error
+	// UseRecoveryCode consumes an unused recovery code. It reports false if no such code is left.
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error)
+}
@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, t *model.PasswordResetToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error)
+	// MarkUsed consumes an unused token. It reports false if the token was already used.
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+}
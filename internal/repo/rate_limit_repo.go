@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+type RateLimitRepository interface {
+	// Take removes a token from the bucket named key, which holds up to burst tokens and regains one every
+	// interval. It returns zero when a token was taken and otherwise how long until one will be available.
+	Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error)
+	// Prune deletes buckets whose key starts with prefix and that were untouched since before. Callers pass a
+	// time far enough back that those buckets have refilled completely, so pruning never changes a decision.
+	Prune(ctx context.Context, prefix string, before time.Time) (int64, error)
+}
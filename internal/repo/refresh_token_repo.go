@@ -0,0 +1,16 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, t *model.RefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	// MarkRotated flags a live token as used. It reports false if the token was already rotated or revoked.
+	MarkRotated(ctx context.Context, id int64) (bool, error)
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeAllForUser(ctx context.Context, userId int64) error
+}
@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+type RevocationRepository interface {
+	Create(ctx context.Context, r *model.TokenRevocation) error
+	// ListSince returns revocations created at or after since, oldest first.
+	ListSince(ctx context.Context, since time.Time) ([]*model.TokenRevocation, error)
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"context"
+)
+
+type RoleRepository interface {
+	// PermissionsByRole returns every role with the permissions it grants, including roles that grant none.
+	PermissionsByRole(ctx context.Context) (map[string][]string, error)
+	// Grant gives the user a role. It reports false if no role has that name; granting a role the user
+	// already holds is not an error.
+	Grant(ctx context.Context, userId int64, role string) (bool, error)
+	// Revoke takes a role away from the user. It reports false if the user did not hold it.
+	//
+	// Grant and Revoke advance the user's version when they change its roles, since roles are part of the
+	// user clients see.
+	Revoke(ctx context.Context, userId int64, role string) (bool, error)
+}
@@ -0,0 +1,9 @@
+package repo
+
+import "context"
+
+// Transactor runs fn in a transaction. Repositories called with the context fn receives join it, so fn's
+// writes commit or roll back together. fn may run more than once when the transaction has to be retried.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
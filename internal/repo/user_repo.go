@@ -2,14 +2,36 @@ package repo
 
 import (
 	"context"
+	"time"
+
 	"github.com/thornhall/simple-go-service/internal/model"
 )
 
+// UserRepository stores users. Soft-deleted users are invisible to every method except List, Restore and Purge.
 type UserRepository interface {
 	FindByEmail(ctx context.Context, email string) (*model.User, error)
 	FindById(ctx context.Context, userId int64) (*model.User, error)
 	FindByObjectId(ctx context.Context, objectID string) (*model.User, error)
+	// List returns a page of users, including soft-deleted ones when q asks for them.
+	List(ctx context.Context, q model.UserListQuery) ([]*model.User, error)
 	Create(ctx context.Context, u *model.User) error
+	// Update writes u's profile if the user is still at u.Version, and advances u.Version. It fails with
+	// ErrStale when the user was changed since u was read.
 	Update(ctx context.Context, u *model.User) error
+	UpdatePassword(ctx context.Context, userId int64, passwordHash string) error
+	// ConfirmEmail marks email as verified and makes it the login address if it was the pending one. It
+	// reports false if email is neither the user's current nor pending address.
+	ConfirmEmail(ctx context.Context, userId int64, email string) (bool, error)
+	// RecordLoginFailure counts a wrong password against the user and returns the failures since the last reset.
+	RecordLoginFailure(ctx context.Context, userId int64) (int, error)
+	// LockUntil refuses logins to the user until the given time.
+	LockUntil(ctx context.Context, userId int64, until time.Time) error
+	// ResetLoginFailures clears the failure count and any lock.
+	ResetLoginFailures(ctx context.Context, userId int64) error
+	// Delete soft-deletes the user.
 	Delete(ctx context.Context, objectID string) error
+	// Restore undoes a soft delete and returns the restored user.
+	Restore(ctx context.Context, objectID string) (*model.User, error)
+	// Purge permanently removes users soft-deleted before deletedBefore and returns how many were removed.
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
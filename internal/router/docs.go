@@ -0,0 +1,141 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thornhall/simple-go-service/internal/health"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/openapi"
+	"github.com/thornhall/simple-go-service/internal/patch"
+)
+
+// SpecPath and DocsPath are where RegisterDocsRoutes serves the OpenAPI document and Swagger UI.
+const (
+	SpecPath = "/openapi.json"
+	DocsPath = "/docs"
+)
+
+var apiInfo = openapi.Info{
+	Title:       "simple-go-service",
+	Version:     "1.0.0",
+	Description: "User accounts, authentication and authorization. Errors are RFC 7807 problem details.",
+}
+
+// routes describes every route the Register functions mount. RegisterDocsRoutes refuses to document an
+// engine whose routes differ from it.
+var routes = []openapi.Route{
+	// users
+	{Method: "POST", Path: "/users/login", OperationId: "login", Tags: []string{"users"},
+		Summary:     "Log in with email and password",
+		Description: "Accounts with MFA enabled get an mfa_token to exchange at /users/login/mfa instead of a token pair.",
+		Body:        model.LoginUserInput{}, Status: http.StatusOK, Response: model.LoginResponse{}},
+	{Method: "POST", Path: "/users", OperationId: "createUser", Tags: []string{"users"},
+		Summary: "Sign up",
+		Body:    model.CreateUserInput{}, Status: http.StatusCreated, Response: model.CreateUserResponse{}},
+	{Method: "GET", Path: "/users", OperationId: "listUsers", Tags: []string{"users"}, Auth: true, Permission: auth.PermUsersList,
+		Summary: "List users a page at a time",
+		Query:   model.ListUsersParams{}, Status: http.StatusOK, Response: model.ListUsersResponse{}},
+	{Method: "GET", Path: "/users/:object_id", OperationId: "getUser", Tags: []string{"users"}, Auth: true,
+		Summary:     "Get a user",
+		Description: "The ETag header carries the user's version. If-None-Match naming it is answered with 304.",
+		Headers:     []string{"If-None-Match"}, Status: http.StatusOK, Response: model.UserResponse{}},
+	{Method: "PUT", Path: "/users/:object_id", OperationId: "updateUser", Tags: []string{"users"}, Auth: true,
+		Summary: "Replace a user's profile",
+		Description: "Every field is replaced: a missing or null last_name clears it. " +
+			"A new email only replaces the current one once it has been verified.\n\n" +
+			"If-Match with the ETag from a GET makes the update fail with 412 if the user has changed since. " +
+			"The server may be configured to require it, answering 428 without it.",
+		Headers: []string{"If-Match"}, Body: model.UpdateUserInput{}, Status: http.StatusOK, Response: model.UserResponse{}},
+	{Method: "PATCH", Path: "/users/:object_id", OperationId: "patchUser", Tags: []string{"users"}, Auth: true,
+		Summary: "Change part of a user's profile",
+		Description: "Takes a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902) of first_name, last_name and email, " +
+			"where email is the pending address if there is one. Any other content type is answered with 415 and Accept-Patch. " +
+			"A JSON patch whose test fails, or that names a missing field, is answered with 409.\n\n" +
+			"If-Match is honored as it is by updateUser.",
+		Headers: []string{"If-Match"},
+		Bodies:  map[string]any{patch.MergePatchType: model.UserMergePatch{}, patch.JSONPatchType: []patch.Operation{}},
+		Status:  http.StatusOK, Response: model.UserResponse{}},
+	{Method: "DELETE", Path: "/users/:object_id", OperationId: "deleteUser", Tags: []string{"users"}, Auth: true,
+		Summary:     "Soft-delete a user",
+		Description: "If-Match is honored as it is by updateUser.",
+		Headers:     []string{"If-Match"}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/users/logout", OperationId: "logout", Tags: []string{"users"}, Auth: true,
+		Summary: "Revoke the caller's access token and, if given, its refresh token",
+		Body:    model.LogoutInput{}, OptionalBody: true, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/users/:object_id/sessions/revoke-all", OperationId: "revokeSessions", Tags: []string{"users"}, Auth: true,
+		Summary: "Revoke every token issued to a user",
+		Status:  http.StatusNoContent},
+	{Method: "POST", Path: "/users/:object_id/restore", OperationId: "restoreUser", Tags: []string{"users"}, Auth: true, Permission: auth.PermUsersRestore,
+		Summary: "Undo a soft delete",
+		Status:  http.StatusOK, Response: model.UserResponse{}},
+
+	// auth
+	{Method: "POST", Path: "/auth/refresh", OperationId: "refreshTokens", Tags: []string{"auth"},
+		Summary: "Exchange a refresh token for a new token pair",
+		Body:    model.RefreshTokenInput{}, Status: http.StatusOK, Response: model.TokenPair{}},
+	{Method: "GET", Path: "/.well-known/jwks.json", OperationId: "getJWKS", Tags: []string{"auth"},
+		Summary: "Public keys that verify access tokens",
+		Status:  http.StatusOK, Response: auth.JWKS{}},
+
+	// password recovery and email verification
+	{Method: "POST", Path: "/users/password/forgot", OperationId: "forgotPassword", Tags: []string{"password"},
+		Summary:     "Email a password reset link",
+		Description: "Always accepted, so callers cannot tell whether the email belongs to an account.",
+		Body:        model.ForgotPasswordInput{}, Status: http.StatusAccepted},
+	{Method: "POST", Path: "/users/password/reset", OperationId: "resetPassword", Tags: []string{"password"},
+		Summary: "Set a new password with a reset token",
+		Body:    model.ResetPasswordInput{}, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/users/verify-email", OperationId: "verifyEmail", Tags: []string{"users"},
+		Summary: "Confirm an email address with the emailed token",
+		Query:   model.VerifyEmailParams{}, Status: http.StatusOK, Response: map[string]string{}},
+
+	// mfa
+	{Method: "POST", Path: "/users/login/mfa", OperationId: "loginMFA", Tags: []string{"mfa"},
+		Summary: "Finish a login with a TOTP or recovery code",
+		Body:    model.MFALoginInput{}, Status: http.StatusOK, Response: model.TokenPair{}},
+	{Method: "POST", Path: "/users/:object_id/mfa/enroll", OperationId: "enrollMFA", Tags: []string{"mfa"}, Auth: true,
+		Summary: "Start TOTP enrollment",
+		Status:  http.StatusOK, Response: model.MFAEnrollmentResponse{}},
+	{Method: "POST", Path: "/users/:object_id/mfa/confirm", OperationId: "confirmMFA", Tags: []string{"mfa"}, Auth: true,
+		Summary: "Enable MFA with a first TOTP code",
+		Body:    model.MFACodeInput{}, Status: http.StatusOK, Response: model.RecoveryCodesResponse{}},
+
+	// roles
+	{Method: "POST", Path: "/users/:object_id/roles", OperationId: "grantRole", Tags: []string{"roles"}, Auth: true, Permission: auth.PermRolesManage,
+		Summary: "Grant a role",
+		Body:    model.GrantRoleInput{}, Status: http.StatusOK, Response: model.UserResponse{}},
+	{Method: "DELETE", Path: "/users/:object_id/roles/:role", OperationId: "revokeRole", Tags: []string{"roles"}, Auth: true, Permission: auth.PermRolesManage,
+		Summary: "Revoke a role",
+		Status:  http.StatusOK, Response: model.UserResponse{}},
+
+	// operations
+	{Method: "GET", Path: "/healthz", OperationId: "live", Tags: []string{"operations"},
+		Summary: "Liveness probe",
+		Status:  http.StatusOK, Response: map[string]string{}},
+	{Method: "GET", Path: "/readyz", OperationId: "ready", Tags: []string{"operations"},
+		Summary:     "Readiness probe",
+		Description: "Answers 503 with the same body when a dependency check fails.",
+		Status:      http.StatusOK, Response: health.Report{}},
+	{Method: "GET", Path: "/metrics", OperationId: "metrics", Tags: []string{"operations"},
+		Summary: "Prometheus metrics",
+		Status:  http.StatusOK, Response: "", ContentType: "text/plain"},
+}
+
+// RegisterDocsRoutes mounts the OpenAPI document for the routes already registered on router, and Swagger
+// UI to browse it. Register it last. It fails when the registered routes differ from routes.
+func RegisterDocsRoutes(router *gin.Engine) error {
+	doc, err := openapi.Build(apiInfo, router.Routes(), routes)
+	if err != nil {
+		return err
+	}
+	spec, err := openapi.Handler(doc)
+	if err != nil {
+		return err
+	}
+	router.GET(SpecPath, spec)
+	router.GET(DocsPath+"/*filepath", openapi.UI(SpecPath))
+	return nil
+}
@@ -2,18 +2,94 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thornhall/simple-go-service/internal/handler"
+	"github.com/thornhall/simple-go-service/internal/health"
+	"github.com/thornhall/simple-go-service/internal/metrics"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/service"
 )
 
-func RegisterUserRoutes(router *gin.Engine, svc *service.UserService) {
+// RegisterUserRoutes mounts the /users endpoints. Login and signup are public; every route that reads or
+// changes an existing user runs behind authMiddleware. loginMiddleware, typically a rate limiter, runs
+// before the login handler.
+func RegisterUserRoutes(router *gin.Engine, svc *service.UserService, authMiddleware gin.HandlerFunc, loginMiddleware ...gin.HandlerFunc) {
 	h := handler.NewUserHandler(svc)
 	users := router.Group("/users")
 	{
-		users.GET("/:object_id", h.Get)
-		users.POST("/login", h.Login)
+		users.POST("/login", append(loginMiddleware, h.Login)...)
 		users.POST("", h.Create)
-		users.PUT("/:object_id", h.Update)
-		users.DELETE("/:object_id", h.Delete)
 	}
+	protected := users.Group("", authMiddleware)
+	{
+		protected.GET("", auth.RequirePermission(auth.PermUsersList), h.List)
+		protected.GET("/:object_id", h.Get)
+		protected.PUT("/:object_id", h.Update)
+		protected.PATCH("/:object_id", h.Patch)
+		protected.DELETE("/:object_id", h.Delete)
+		protected.POST("/logout", h.Logout)
+		protected.POST("/:object_id/sessions/revoke-all", h.RevokeSessions)
+		protected.POST("/:object_id/restore", auth.RequirePermission(auth.PermUsersRestore), h.Restore)
+	}
+}
+
+// RegisterAuthRoutes mounts the public /auth endpoints used to renew access tokens and the JWKS document
+// used by other services to verify them.
+func RegisterAuthRoutes(router *gin.Engine, tokens *service.TokenService, keys *auth.Keyring) {
+	h := handler.NewAuthHandler(tokens, keys)
+	authGroup := router.Group("/auth")
+	{
+		authGroup.POST("/refresh", h.Refresh)
+	}
+	router.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+// RegisterPasswordRoutes mounts the public password recovery endpoints.
+func RegisterPasswordRoutes(router *gin.Engine, svc *service.PasswordService) {
+	h := handler.NewPasswordHandler(svc)
+	password := router.Group("/users/password")
+	{
+		password.POST("/forgot", h.Forgot)
+		password.POST("/reset", h.Reset)
+	}
+}
+
+// RegisterVerificationRoutes mounts the public endpoint that emailed verification links point at.
+func RegisterVerificationRoutes(router *gin.Engine, svc *service.VerificationService) {
+	h := handler.NewVerificationHandler(svc)
+	router.GET("/users/verify-email", h.VerifyEmail)
+}
+
+// RegisterMFARoutes mounts TOTP enrollment, which requires authentication, and the public second login
+// step, which runs behind loginMiddleware.
+func RegisterMFARoutes(router *gin.Engine, svc *service.MFAService, authMiddleware gin.HandlerFunc, loginMiddleware ...gin.HandlerFunc) {
+	h := handler.NewMFAHandler(svc)
+	router.POST("/users/login/mfa", append(loginMiddleware, h.Login)...)
+	protected := router.Group("/users/:object_id/mfa", authMiddleware)
+	{
+		protected.POST("/enroll", h.Enroll)
+		protected.POST("/confirm", h.Confirm)
+	}
+}
+
+// RegisterRoleRoutes mounts the endpoints that grant and revoke roles. They require roles:manage.
+func RegisterRoleRoutes(router *gin.Engine, svc *service.RoleService, authMiddleware gin.HandlerFunc) {
+	h := handler.NewRoleHandler(svc)
+	roles := router.Group("/users/:object_id/roles", authMiddleware, auth.RequirePermission(auth.PermRolesManage))
+	{
+		roles.POST("", h.Grant)
+		roles.DELETE("/:role", h.Revoke)
+	}
+}
+
+// RegisterHealthRoutes mounts the public liveness and readiness probes.
+func RegisterHealthRoutes(router *gin.Engine, checks *health.Checker) {
+	h := handler.NewHealthHandler(checks)
+	router.GET("/healthz", h.Live)
+	router.GET("/readyz", h.Ready)
+}
+
+// RegisterMetricsRoutes mounts the Prometheus scrape endpoint for reg.
+func RegisterMetricsRoutes(router *gin.Engine, reg *prometheus.Registry) {
+	router.GET("/metrics", metrics.Handler(reg))
 }
@@ -1,33 +1,76 @@
 package router_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/thornhall/simple-go-service/internal/dal"
+	"github.com/thornhall/simple-go-service/internal/health"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/metrics"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/router"
 	"github.com/thornhall/simple-go-service/internal/service"
 )
 
+// registerAll mounts every API route the way the server does, minus the docs.
+func registerAll(t *testing.T, r *gin.Engine) {
+	t.Helper()
+	var noopDB dal.Conn
+	repo := dal.NewUserRepository(noopDB)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	require.NoError(t, err)
+	tokens := service.NewTokenService(repo, dal.NewRefreshTokenRepository(noopDB), keys, nil)
+	verifier := service.NewVerificationService(repo, dal.NewEmailVerificationRepository(noopDB), mail.NewLogSender(), "http://localhost/verify")
+	box, err := auth.NewGeneratedSecretBox()
+	require.NoError(t, err)
+	mfa := service.NewMFAService(repo, dal.NewMFARepository(noopDB), tokens, box)
+	svc := service.NewUserService(repo, tokens, verifier, mfa)
+	router.RegisterUserRoutes(r, svc, auth.JWTAuth(keys, nil))
+	router.RegisterAuthRoutes(r, tokens, keys)
+	router.RegisterPasswordRoutes(r, service.NewPasswordService(repo, dal.NewPasswordResetRepository(noopDB), tokens, mail.NewLogSender(), "http://localhost/reset"))
+	router.RegisterVerificationRoutes(r, verifier)
+	router.RegisterMFARoutes(r, mfa, auth.JWTAuth(keys, nil))
+	router.RegisterRoleRoutes(r, service.NewRoleService(repo, dal.NewRoleRepository(noopDB), tokens), auth.JWTAuth(keys, nil))
+	router.RegisterHealthRoutes(r, health.NewChecker(time.Second))
+	router.RegisterMetricsRoutes(r, metrics.NewRegistry(nil))
+}
+
 func TestRegisterUserRoutes_RegistersAllEndpoints(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-
-	var noopDB dal.Conn
-	repo := dal.NewUserRepository(noopDB)
-	svc := service.NewUserService(repo)
-	router.RegisterUserRoutes(r, svc)
+	registerAll(t, r)
 
 	routes := r.Routes()
 	expected := []struct {
 		method, path string
 	}{
+		{"GET", "/users"},
 		{"GET", "/users/:object_id"},
+		{"POST", "/users/login"},
 		{"POST", "/users"},
 		{"PUT", "/users/:object_id"},
+		{"PATCH", "/users/:object_id"},
 		{"DELETE", "/users/:object_id"},
+		{"POST", "/users/logout"},
+		{"POST", "/users/:object_id/sessions/revoke-all"},
+		{"POST", "/users/:object_id/restore"},
+		{"POST", "/users/:object_id/roles"},
+		{"DELETE", "/users/:object_id/roles/:role"},
+		{"POST", "/users/password/forgot"},
+		{"POST", "/users/password/reset"},
+		{"POST", "/auth/refresh"},
+		{"GET", "/.well-known/jwks.json"},
 	}
 
 	for _, exp := range expected {
@@ -41,3 +84,99 @@ func TestRegisterUserRoutes_RegistersAllEndpoints(t *testing.T) {
 		assert.Truef(t, found, "%s %s not registered", exp.method, exp.path)
 	}
 }
+
+func TestRegisterUserRoutes_ProtectedRoutesRequireAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	var noopDB dal.Conn
+	repo := dal.NewUserRepository(noopDB)
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	assert.NoError(t, err)
+	svc := service.NewUserService(repo, service.NewTokenService(repo, dal.NewRefreshTokenRepository(noopDB), keys, nil), nil, nil)
+	router.RegisterUserRoutes(r, svc, auth.JWTAuth(keys, nil))
+
+	protected := []struct {
+		method, path string
+	}{
+		{"GET", "/users/some-object-id"},
+		{"PUT", "/users/some-object-id"},
+		{"PATCH", "/users/some-object-id"},
+		{"DELETE", "/users/some-object-id"},
+		{"POST", "/users/logout"},
+		{"POST", "/users/some-object-id/sessions/revoke-all"},
+	}
+
+	for _, p := range protected {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(p.method, p.path, nil)
+		r.ServeHTTP(w, req)
+		assert.Equalf(t, http.StatusUnauthorized, w.Code, "%s %s should require auth", p.method, p.path)
+	}
+}
+
+func TestRegisterHealthRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	checks := health.NewChecker(time.Second)
+	var failing atomic.Bool
+	checks.Register("dep", func(ctx context.Context) (any, error) {
+		if failing.Load() {
+			return nil, errors.New("unreachable")
+		}
+		return "fine", nil
+	})
+	router.RegisterHealthRoutes(r, checks)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{"dep":{"status":"ok","detail":"fine"}}}`, w.Body.String())
+
+	failing.Store(true)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"fail","checks":{"dep":{"status":"fail"}}}`, w.Body.String())
+
+	// liveness ignores dependencies
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestRegisterDocsRoutes_SpecMatchesRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAll(t, r)
+	require.NoError(t, router.RegisterDocsRoutes(r), "every registered route must be described in docs.go, and nothing else")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", router.SpecPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.1.0", spec.OpenAPI)
+	assert.Contains(t, spec.Paths["/users/{object_id}"], "put")
+	assert.Contains(t, spec.Paths["/users"], "post")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", router.DocsPath+"/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), router.SpecPath)
+}
+
+func TestRegisterDocsRoutes_RejectsUndocumentedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerAll(t, r)
+	r.GET("/users/:object_id/avatar", func(*gin.Context) {})
+
+	err := router.RegisterDocsRoutes(r)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "GET /users/:object_id/avatar is registered but not documented")
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"slices"
+)
+
+// Caller is the authenticated user a request acts for, with the permissions their roles grant.
+type Caller struct {
+	Id          int64
+	Permissions []string
+}
+
+// Can reports whether the caller's roles grant perm.
+func (c Caller) Can(perm string) bool {
+	return slices.Contains(c.Permissions, perm)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/middleware/ratelimit"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+func TestLockoutPolicy_LockFor(t *testing.T) {
+	p := LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute}
+	assert.Zero(t, p.lockFor(2))
+	assert.Equal(t, time.Minute, p.lockFor(3))
+	assert.Equal(t, 2*time.Minute, p.lockFor(4))
+	assert.Equal(t, 4*time.Minute, p.lockFor(5))
+	assert.Equal(t, 5*time.Minute, p.lockFor(6))
+	assert.Equal(t, 5*time.Minute, p.lockFor(100))
+	assert.Zero(t, LockoutPolicy{}.lockFor(100))
+}
+
+func TestUserService_Login_Lockout(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("right_password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{Id: 1, Email: "jane@doe.com", PasswordHash: string(hash)}
+	resets := 0
+	repo := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			cp := *user
+			return &cp, nil
+		},
+		RecordLoginFailureFunc: func(id int64) (int, error) {
+			user.FailedLoginAttempts++
+			return user.FailedLoginAttempts, nil
+		},
+		LockUntilFunc: func(id int64, until time.Time) error {
+			user.LockedUntil = &until
+			return nil
+		},
+		ResetLoginFailuresFunc: func(id int64) error {
+			resets++
+			user.FailedLoginAttempts, user.LockedUntil = 0, nil
+			return nil
+		},
+	}
+	svc := newTestUserService(repo)
+	svc.Lockout = LockoutPolicy{Threshold: 2, Base: time.Minute, Max: time.Hour}
+	login := func(password string) error {
+		_, err := svc.Login(t.Context(), model.LoginUserInput{Email: user.Email, Password: password})
+		return err
+	}
+
+	// a success with no failures on record does not touch the counter
+	require.NoError(t, login("right_password"))
+	assert.Zero(t, resets)
+
+	assert.Equal(t, ErrInvalidAuth, login("wrong"))
+	assert.Nil(t, user.LockedUntil)
+	assert.Equal(t, ErrInvalidAuth, login("wrong"))
+	require.NotNil(t, user.LockedUntil)
+
+	// while locked even the right password is refused, and the refusal is not counted
+	err = login("right_password")
+	var retry *apperr.Error
+	require.True(t, errors.As(err, &retry))
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	assert.InDelta(t, time.Minute, retry.RetryAfter, float64(time.Second))
+	assert.Equal(t, 2, user.FailedLoginAttempts)
+
+	// the next failure after the lock runs out locks for twice as long
+	expired := time.Now().Add(-time.Second)
+	user.LockedUntil = &expired
+	assert.Equal(t, ErrInvalidAuth, login("wrong"))
+	assert.InDelta(t, float64(2*time.Minute), float64(time.Until(*user.LockedUntil)), float64(time.Second))
+
+	// a successful login clears the record
+	user.LockedUntil = &expired
+	require.NoError(t, login("right_password"))
+	assert.Equal(t, 1, resets)
+	assert.Zero(t, user.FailedLoginAttempts)
+}
+
+func TestUserService_Login_Throttled(t *testing.T) {
+	found := 0
+	repo := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			found++
+			return nil, repo.ErrNotFound
+		},
+	}
+	svc := newTestUserService(repo)
+	svc.LoginLimiter = ratelimit.New(ratelimit.NewMemoryStore(), "login", ratelimit.Limit{Burst: 2, Interval: time.Minute})
+
+	// unknown accounts are throttled too, and the limit ignores case
+	for _, email := range []string{"nobody@doe.com", "NOBODY@doe.com"} {
+		_, err := svc.Login(t.Context(), model.LoginUserInput{Email: email, Password: "guess"})
+		assert.Equal(t, ErrInvalidAuth, err)
+	}
+	_, err := svc.Login(t.Context(), model.LoginUserInput{Email: "Nobody@doe.com", Password: "guess"})
+	var retry *apperr.Error
+	require.True(t, errors.As(err, &retry))
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Positive(t, retry.RetryAfter)
+	assert.Equal(t, 2, found, "throttled attempts never reach the database")
+
+	_, err = svc.Login(t.Context(), model.LoginUserInput{Email: "somebody@doe.com", Password: "guess"})
+	assert.Equal(t, ErrInvalidAuth, err)
+}
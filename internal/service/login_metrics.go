@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/thornhall/simple-go-service/internal/metrics"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+// Result labels of the login metric. A password login that continues to an MFA step counts as
+// mfa_required, and its second step then counts as success or mfa_failed, so each login is a success once.
+const (
+	LoginSuccess            = "success"
+	LoginMFARequired        = "mfa_required"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginMFAFailed          = "mfa_failed"
+	LoginThrottled          = "throttled"
+	LoginLocked             = "locked"
+	LoginUnverified         = "unverified"
+	LoginError              = "error"
+)
+
+func observeLogin(resp *model.LoginResponse, err error) {
+	result := LoginSuccess
+	switch {
+	case err == nil && resp.MFARequired:
+		result = LoginMFARequired
+	case err == nil:
+	case errors.Is(err, ErrInvalidAuth):
+		result = LoginInvalidCredentials
+	case errors.Is(err, ErrTooManyAttempts):
+		result = LoginThrottled
+	case errors.Is(err, ErrAccountLocked):
+		result = LoginLocked
+	case errors.Is(err, ErrEmailNotVerified):
+		result = LoginUnverified
+	default:
+		result = LoginError
+	}
+	metrics.Logins.WithLabelValues(result).Inc()
+}
+
+func observeMFALogin(err error) {
+	result := LoginSuccess
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrInvalidMFAToken):
+		result = LoginMFAFailed
+	default:
+		result = LoginError
+	}
+	metrics.Logins.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thornhall/simple-go-service/internal/metrics"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+func TestObserveLogin_Results(t *testing.T) {
+	tests := []struct {
+		resp   *model.LoginResponse
+		err    error
+		result string
+	}{
+		{&model.LoginResponse{}, nil, LoginSuccess},
+		{&model.LoginResponse{MFARequired: true}, nil, LoginMFARequired},
+		{nil, ErrInvalidAuth, LoginInvalidCredentials},
+		{nil, ErrTooManyAttempts.WithRetryAfter(time.Second), LoginThrottled},
+		{nil, ErrAccountLocked.WithRetryAfter(time.Second), LoginLocked},
+		{nil, ErrEmailNotVerified, LoginUnverified},
+		{nil, errors.New("db down"), LoginError},
+	}
+	for _, tt := range tests {
+		counter := metrics.Logins.WithLabelValues(tt.result)
+		before := testutil.ToFloat64(counter)
+		observeLogin(tt.resp, tt.err)
+		assert.Equalf(t, before+1, testutil.ToFloat64(counter), "result %s", tt.result)
+	}
+}
+
+func TestUserService_Login_CountsLockouts(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("right_password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	failures := 0
+	repo := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			return &model.User{Id: 1, Email: email, PasswordHash: string(hash)}, nil
+		},
+		RecordLoginFailureFunc: func(id int64) (int, error) {
+			failures++
+			return failures, nil
+		},
+		LockUntilFunc: func(id int64, until time.Time) error { return nil },
+	}
+	svc := newTestUserService(repo)
+	svc.Lockout = LockoutPolicy{Threshold: 2, Base: time.Minute, Max: time.Hour}
+	before := testutil.ToFloat64(metrics.Lockouts)
+
+	for range 2 {
+		_, err := svc.Login(t.Context(), model.LoginUserInput{Email: "jane@doe.com", Password: "wrong"})
+		assert.Equal(t, ErrInvalidAuth, err)
+	}
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.Lockouts))
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var ErrMFAAlreadyEnabled = apperr.Conflict("mfa_already_enabled", "mfa is already enabled")
+var ErrMFANotEnrolled = apperr.Conflict("mfa_not_enrolled", "no pending mfa enrollment")
+var ErrInvalidMFACode = apperr.Validation("invalid_mfa_code", "invalid mfa code")
+var ErrInvalidMFAToken = apperr.Unauthorized("invalid_mfa_token", "invalid or expired mfa token")
+
+const (
+	// MFAIssuer is the account issuer shown in authenticator apps.
+	MFAIssuer = "simple-go-service"
+	// MFAPendingTTL is how long a user has to present their second factor after the password step.
+	MFAPendingTTL     = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFAService manages TOTP enrollment and the second step of login. TOTP secrets are encrypted with box
+// before they reach the database; recovery codes are only stored hashed.
+type MFAService struct {
+	users  repo.UserRepository
+	mfa    repo.MFARepository
+	tokens *TokenService
+	box    *auth.SecretBox
+
+	// Lockout locks accounts after repeated wrong codes at login. Wrong codes count against the same record
+	// as wrong passwords, so alternating between the two steps buys no extra guesses.
+	Lockout LockoutPolicy
+}
+
+func NewMFAService(users repo.UserRepository, mfa repo.MFARepository, tokens *TokenService, box *auth.SecretBox) *MFAService {
+	return &MFAService{users: users, mfa: mfa, tokens: tokens, box: box, Lockout: DefaultLockoutPolicy}
+}
+
+// Enroll generates a new TOTP secret for the user. MFA is not enforced until Confirm is called with a code
+// from it; enrolling again before that replaces the secret.
+func (s *MFAService) Enroll(ctx context.Context, callerId int64, objectId string) (*model.MFAEnrollmentResponse, error) {
+	u, err := findOwned(ctx, s.users, Caller{Id: callerId}, objectId, "")
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.mfa.FindByUserId(ctx, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.box.Seal(secret, secretAAD(u.Id))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.Upsert(ctx, &model.UserMFA{UserId: u.Id, SecretCiphertext: sealed}); err != nil {
+		return nil, err
+	}
+	return &model.MFAEnrollmentResponse{
+		Secret:     auth.EncodeTOTPSecret(secret),
+		OtpauthURI: auth.TOTPURI(MFAIssuer, u.Email, secret),
+	}, nil
+}
+
+// Confirm turns on MFA once the user proves their authenticator produces valid codes, and returns a fresh
+// set of recovery codes. The codes are shown only this once.
+func (s *MFAService) Confirm(ctx context.Context, callerId int64, objectId string, code string) ([]string, error) {
+	u, err := findOwned(ctx, s.users, Caller{Id: callerId}, objectId, "")
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.mfa.FindByUserId(ctx, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if m.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err := s.verifyTOTP(ctx, m, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, u.Id, hashes); err != nil {
+		return nil, err
+	}
+	if err := s.mfa.Confirm(ctx, u.Id); errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrMFANotEnrolled
+	} else if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Enabled reports whether the user has confirmed an MFA enrollment.
+func (s *MFAService) Enabled(ctx context.Context, userId int64) (bool, error) {
+	m, err := s.mfa.FindByUserId(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return m != nil && m.ConfirmedAt != nil, nil
+}
+
+// Login completes a login that was paused for MFA. The pending token is single use once a valid code has
+// been presented with it. Wrong codes count towards the account's lockout, and a locked account fails with
+// ErrAccountLocked whatever the code.
+func (s *MFAService) Login(ctx context.Context, input model.MFALoginInput) (*model.TokenPair, error) {
+	pair, err := s.login(ctx, input)
+	observeMFALogin(err)
+	return pair, err
+}
+
+func (s *MFAService) login(ctx context.Context, input model.MFALoginInput) (*model.TokenPair, error) {
+	claims, userId, err := s.tokens.VerifyMFAPending(input.MFAToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	m, err := s.mfa.FindByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.ConfirmedAt == nil {
+		return nil, ErrInvalidMFAToken
+	}
+	u, err := s.users.FindById(ctx, userId)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidMFAToken
+	} else if err != nil {
+		return nil, err
+	}
+	if err := lockedErr(u); err != nil {
+		return nil, err
+	}
+
+	if isTOTPCode(input.Code) {
+		err = s.verifyTOTP(ctx, m, input.Code)
+	} else {
+		err = s.useRecoveryCode(ctx, userId, input.Code)
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		s.Lockout.recordFailure(ctx, s.users, userId)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.tokens.ConsumeMFAPending(ctx, claims, userId); err != nil {
+		return nil, err
+	}
+	if u.FailedLoginAttempts > 0 || u.LockedUntil != nil {
+		if err := s.users.ResetLoginFailures(ctx, u.Id); err != nil {
+			logging.FromContext(ctx).Error("unable to reset login failures", "target_user_id", u.Id, "error", err)
+		}
+	}
+	return s.tokens.Issue(ctx, u)
+}
+
+// verifyTOTP checks code against the enrollment's secret and burns its time step so it cannot be replayed.
+func (s *MFAService) verifyTOTP(ctx context.Context, m *model.UserMFA, code string) error {
+	secret, err := s.box.Open(m.SecretCiphertext, secretAAD(m.UserId))
+	if err != nil {
+		return err
+	}
+	step, ok := auth.VerifyTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.mfa.UseStep(ctx, m.UserId, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *MFAService) useRecoveryCode(ctx context.Context, userId int64, code string) error {
+	used, err := s.mfa.UseRecoveryCode(ctx, userId, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// secretAAD binds a sealed TOTP secret to its user, so a ciphertext copied to another user's row does not open.
+func secretAAD(userId int64) []byte {
+	return []byte("user:" + strconv.FormatInt(userId, 10))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+// newRecoveryCodes returns codes formatted for display, e.g. "k3v9q-x2mfa", and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(b)[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed back the way users copy them.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return auth.HashOpaqueToken(normalized)
+}
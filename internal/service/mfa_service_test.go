@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/base32"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var testSecrets = mustGenerateSecretBox()
+
+func mustGenerateSecretBox() *auth.SecretBox {
+	box, err := auth.NewGeneratedSecretBox()
+	if err != nil {
+		panic(err)
+	}
+	return box
+}
+
+type fakeMFARepo struct {
+	mu       sync.Mutex
+	byUser   map[int64]*model.UserMFA
+	recovery map[int64]map[string]bool
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{byUser: map[int64]*model.UserMFA{}, recovery: map[int64]map[string]bool{}}
+}
+
+func (f *fakeMFARepo) Upsert(ctx context.Context, m *model.UserMFA) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.byUser[m.UserId]; ok && existing.ConfirmedAt != nil {
+		return repo.ErrNotFound
+	}
+	cp := *m
+	f.byUser[m.UserId] = &cp
+	return nil
+}
+
+func (f *fakeMFARepo) FindByUserId(ctx context.Context, userId int64) (*model.UserMFA, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.byUser[userId]
+	if !ok {
+		return nil, nil
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (f *fakeMFARepo) Confirm(ctx context.Context, userId int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	f.byUser[userId].ConfirmedAt = &now
+	return nil
+}
+
+func (f *fakeMFARepo) UseStep(ctx context.Context, userId int64, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := f.byUser[userId]
+	if m.LastUsedStep != nil && *m.LastUsedStep >= step {
+		return false, nil
+	}
+	m.LastUsedStep = &step
+	return true, nil
+}
+
+func (f *fakeMFARepo) ReplaceRecoveryCodes(ctx context.Context, userId int64, hashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recovery[userId] = map[string]bool{}
+	for _, h := range hashes {
+		f.recovery[userId][h] = false
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(ctx context.Context, userId int64, hash string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	used, ok := f.recovery[userId][hash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recovery[userId][hash] = true
+	return true, nil
+}
+
+func TestMFAService_EnrollConfirmAndLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret_pw"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	user := &model.User{Id: 3, ObjectId: "mfa-user", Email: "m@x.com", PasswordHash: string(hash)}
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(string) (*model.User, error) { return user, nil },
+		FindByIdFunc:       func(int64) (*model.User, error) { return user, nil },
+		FindByEmailFunc:    func(string) (*model.User, error) { return user, nil },
+	}
+	mfaRepo := newFakeMFARepo()
+	tokens := NewTokenService(users, newFakeTokenRepo(), testKeys, newTestDenylist())
+	mfa := NewMFAService(users, mfaRepo, tokens, testSecrets)
+	svc := NewUserService(users, tokens, nil, mfa)
+	login := model.LoginUserInput{Email: "m@x.com", Password: "secret_pw"}
+
+	// — another caller cannot enroll this user
+	_, err = mfa.Enroll(t.Context(), 4, "mfa-user")
+	assert.Equal(t, ErrForbidden, err)
+	_, err = mfa.Confirm(t.Context(), 3, "mfa-user", "123456")
+	assert.Equal(t, ErrMFANotEnrolled, err)
+
+	enrollment, err := mfa.Enroll(t.Context(), 3, "mfa-user")
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.OtpauthURI, "otpauth://totp/")
+	assert.Contains(t, enrollment.OtpauthURI, "secret="+enrollment.Secret)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	stored, _ := mfaRepo.FindByUserId(t.Context(), 3)
+	assert.NotContains(t, string(stored.SecretCiphertext), string(secret), "secret must be encrypted at rest")
+
+	// — unconfirmed enrollment does not change login
+	resp, err := svc.Login(t.Context(), login)
+	require.NoError(t, err)
+	assert.False(t, resp.MFARequired)
+
+	_, err = mfa.Confirm(t.Context(), 3, "mfa-user", "000000")
+	assert.Equal(t, ErrInvalidMFACode, err)
+	step := auth.TOTPStep(time.Now())
+	codes, err := mfa.Confirm(t.Context(), 3, "mfa-user", auth.TOTPCode(secret, step))
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	_, err = mfa.Enroll(t.Context(), 3, "mfa-user")
+	assert.Equal(t, ErrMFAAlreadyEnabled, err)
+
+	// — password alone now only yields an mfa token, which is not an access token
+	resp, err = svc.Login(t.Context(), login)
+	require.NoError(t, err)
+	require.True(t, resp.MFARequired)
+	assert.Nil(t, resp.TokenPair)
+	require.NotEmpty(t, resp.MFAToken)
+
+	// — the code used for confirmation cannot be replayed
+	_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: auth.TOTPCode(secret, step)})
+	assert.Equal(t, ErrInvalidMFACode, err)
+	_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: "bogus", Code: auth.TOTPCode(secret, step+1)})
+	assert.Equal(t, ErrInvalidMFAToken, err)
+
+	pair, err := mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: auth.TOTPCode(secret, step+1)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+
+	// — the mfa token is single use
+	_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: codes[0]})
+	assert.Equal(t, ErrInvalidMFAToken, err)
+
+	// — recovery codes work once, regardless of case and dashes
+	resp, err = svc.Login(t.Context(), login)
+	require.NoError(t, err)
+	pair, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: "  " + codes[0][:5] + " " + codes[0][6:]})
+	require.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+
+	resp, err = svc.Login(t.Context(), login)
+	require.NoError(t, err)
+	_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: codes[0]})
+	assert.Equal(t, ErrInvalidMFACode, err)
+}
+
+func TestMFAService_Login_WrongCodesLockTheAccount(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret_pw"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{Id: 5, ObjectId: "mfa-brute", Email: "b@x.com", PasswordHash: string(hash)}
+	current := func() (*model.User, error) {
+		cp := *user
+		return &cp, nil
+	}
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(string) (*model.User, error) { return current() },
+		FindByIdFunc:       func(int64) (*model.User, error) { return current() },
+		FindByEmailFunc:    func(string) (*model.User, error) { return current() },
+		RecordLoginFailureFunc: func(int64) (int, error) {
+			user.FailedLoginAttempts++
+			return user.FailedLoginAttempts, nil
+		},
+		LockUntilFunc: func(_ int64, until time.Time) error {
+			user.LockedUntil = &until
+			return nil
+		},
+		ResetLoginFailuresFunc: func(int64) error {
+			user.FailedLoginAttempts, user.LockedUntil = 0, nil
+			return nil
+		},
+	}
+	tokens := NewTokenService(users, newFakeTokenRepo(), testKeys, newTestDenylist())
+	mfa := NewMFAService(users, newFakeMFARepo(), tokens, testSecrets)
+	mfa.Lockout = LockoutPolicy{Threshold: 3, Base: time.Minute, Max: time.Hour}
+	svc := NewUserService(users, tokens, nil, mfa)
+	svc.Lockout = mfa.Lockout
+
+	enrollment, err := mfa.Enroll(t.Context(), 5, "mfa-brute")
+	require.NoError(t, err)
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	step := auth.TOTPStep(time.Now())
+	_, err = mfa.Confirm(t.Context(), 5, "mfa-brute", auth.TOTPCode(secret, step))
+	require.NoError(t, err)
+	resp, err := svc.Login(t.Context(), model.LoginUserInput{Email: user.Email, Password: "secret_pw"})
+	require.NoError(t, err)
+	require.True(t, resp.MFARequired)
+
+	// — wrong TOTP and recovery codes both count, and the third locks the account
+	for _, code := range []string{"000000", "aaaaa-aaaaa", "111111"} {
+		_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: code})
+		assert.Equal(t, ErrInvalidMFACode, err)
+	}
+	assert.Equal(t, 3, user.FailedLoginAttempts)
+	require.NotNil(t, user.LockedUntil)
+
+	// — while locked even the right code is refused, without burning it
+	_, err = mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: auth.TOTPCode(secret, step+1)})
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	assert.Equal(t, 3, user.FailedLoginAttempts)
+
+	// — once the lock runs out the pending token still works, and success clears the record
+	expired := time.Now().Add(-time.Second)
+	user.LockedUntil = &expired
+	pair, err := mfa.Login(t.Context(), model.MFALoginInput{MFAToken: resp.MFAToken, Code: auth.TOTPCode(secret, step+1)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.Zero(t, user.FailedLoginAttempts)
+	assert.Nil(t, user.LockedUntil)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var ErrInvalidResetToken = apperr.Validation("invalid_reset_token", "invalid or expired password reset token")
+
+const PasswordResetTTL = time.Hour
+
+// PasswordService runs the forgot/reset password flow. Reset links carry a random single-use token of
+// which only the hash is stored.
+type PasswordService struct {
+	users    repo.UserRepository
+	resets   repo.PasswordResetRepository
+	tokens   *TokenService
+	mailer   mail.Sender
+	resetURL string
+	ttl      time.Duration
+
+	// PasswordCost is the bcrypt cost of new password hashes. It defaults to bcrypt.DefaultCost.
+	PasswordCost int
+}
+
+// NewPasswordService builds the service. resetURL is the page the emailed link points at; the token is
+// appended as the "token" query parameter.
+func NewPasswordService(users repo.UserRepository, resets repo.PasswordResetRepository, tokens *TokenService, mailer mail.Sender, resetURL string) *PasswordService {
+	return &PasswordService{
+		users:    users,
+		resets:   resets,
+		tokens:   tokens,
+		mailer:   mailer,
+		resetURL: resetURL,
+		ttl:      PasswordResetTTL,
+
+		PasswordCost: bcrypt.DefaultCost,
+	}
+}
+
+// Forgot emails a reset link to the account with this email. Unknown addresses are ignored so the endpoint
+// cannot be used to discover which emails are registered.
+func (s *PasswordService) Forgot(ctx context.Context, email string) error {
+	u, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	t := &model.PasswordResetToken{
+		UserId:    u.Id,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := s.resets.Create(ctx, t); err != nil {
+		return err
+	}
+	link, err := withToken(s.resetURL, raw)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not ask for this you can ignore this email.", s.ttl, link),
+	})
+}
+
+// Reset consumes a reset token, replaces the user's password and signs them out everywhere.
+func (s *PasswordService) Reset(ctx context.Context, rawToken string, password string) error {
+	t, err := s.resets.FindByHash(ctx, auth.HashOpaqueToken(rawToken))
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+	if t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	used, err := s.resets.MarkUsed(ctx, t.Id)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := hashPassword(ctx, password, s.PasswordCost)
+	if err != nil {
+		return err
+	}
+	if err := s.users.UpdatePassword(ctx, t.UserId, string(hashed)); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeAll(ctx, t.UserId); err != nil {
+		logging.FromContext(ctx).Error("password reset could not revoke sessions", "target_user_id", t.UserId, "error", err)
+		return err
+	}
+	return nil
+}
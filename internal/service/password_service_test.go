@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type fakeResetRepo struct {
+	mu     sync.Mutex
+	byHash map[string]*model.PasswordResetToken
+}
+
+func newFakeResetRepo() *fakeResetRepo {
+	return &fakeResetRepo{byHash: map[string]*model.PasswordResetToken{}}
+}
+
+func (f *fakeResetRepo) Create(ctx context.Context, t *model.PasswordResetToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.Id = int64(len(f.byHash) + 1)
+	cp := *t
+	f.byHash[t.TokenHash] = &cp
+	return nil
+}
+
+func (f *fakeResetRepo) FindByHash(ctx context.Context, hash string) (*model.PasswordResetToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.byHash[hash]
+	if !ok {
+		return nil, repo.ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (f *fakeResetRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.byHash {
+		if t.Id == id && t.UsedAt == nil {
+			now := time.Now()
+			t.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// resetTokenFrom pulls the token query parameter out of the link in the last email sent.
+func resetTokenFrom(t *testing.T, sender *mail.FileSender) string {
+	messages, err := sender.Messages()
+	require.NoError(t, err)
+	require.NotEmpty(t, messages)
+	for _, field := range strings.Fields(messages[len(messages)-1].Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatal("no reset link in email")
+	return ""
+}
+
+func TestPasswordService_ForgotAndReset(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com", PasswordHash: "old"}
+	var newHash string
+	users := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			if email == user.Email {
+				return user, nil
+			}
+			return nil, repo.ErrNotFound
+		},
+		UpdatePasswordFunc: func(id int64, hash string) error {
+			assert.Equal(t, user.Id, id)
+			newHash = hash
+			return nil
+		},
+	}
+	sender, err := mail.NewFileSender(t.TempDir())
+	require.NoError(t, err)
+	denylist := newTestDenylist()
+	tokens := NewTokenService(users, newFakeTokenRepo(), testKeys, denylist)
+	svc := NewPasswordService(users, newFakeResetRepo(), tokens, sender, "https://app.example.com/reset")
+
+	// — unknown email sends nothing and does not error
+	require.NoError(t, svc.Forgot(t.Context(), "nobody@doe.com"))
+	messages, err := sender.Messages()
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	require.NoError(t, svc.Forgot(t.Context(), user.Email))
+	messages, err = sender.Messages()
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, user.Email, messages[0].To)
+	assert.Contains(t, messages[0].Body, "https://app.example.com/reset?token=")
+	token := resetTokenFrom(t, sender)
+
+	// — bad token
+	assert.Equal(t, ErrInvalidResetToken, svc.Reset(t.Context(), "bogus", "new_password"))
+
+	// — good token replaces the hash and revokes sessions
+	require.NoError(t, svc.Reset(t.Context(), token, "new_password"))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(newHash), []byte("new_password")))
+	assert.True(t, denylist.IsRevoked("", user.Id, time.Now().Add(-time.Minute)))
+
+	// — the token is single use
+	assert.Equal(t, ErrInvalidResetToken, svc.Reset(t.Context(), token, "another_password"))
+}
+
+func TestPasswordService_Reset_Expired(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	users := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) { return user, nil },
+		UpdatePasswordFunc: func(id int64, hash string) error {
+			t.Fatal("password must not change")
+			return nil
+		},
+	}
+	sender, err := mail.NewFileSender(t.TempDir())
+	require.NoError(t, err)
+	tokens := NewTokenService(users, newFakeTokenRepo(), testKeys, newTestDenylist())
+	svc := NewPasswordService(users, newFakeResetRepo(), tokens, sender, "https://app.example.com/reset")
+	svc.ttl = -time.Minute
+
+	require.NoError(t, svc.Forgot(t.Context(), user.Email))
+	assert.Equal(t, ErrInvalidResetToken, svc.Reset(t.Context(), resetTokenFrom(t, sender), "new_password"))
+}
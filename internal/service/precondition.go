@@ -0,0 +1,43 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/model"
+)
+
+var ErrVersionMismatch = apperr.PreconditionFailed("version_mismatch", "user was changed since it was read")
+var ErrPreconditionRequired = apperr.PreconditionRequired("precondition_required", "send If-Match with the user's ETag")
+
+// Precondition is what a write expects of the user's current version, taken from the request's If-Match
+// header. The zero value is a request without one.
+type Precondition struct {
+	present  bool
+	any      bool
+	versions []int64
+}
+
+// IfMatchAny holds for any version of a user that exists, like If-Match: *.
+func IfMatchAny() Precondition {
+	return Precondition{present: true, any: true}
+}
+
+// IfMatch holds when the user is at one of versions. Without versions it never holds, which is what an
+// If-Match header naming no tag this service issued means.
+func IfMatch(versions ...int64) Precondition {
+	return Precondition{present: true, versions: versions}
+}
+
+// check fails with ErrVersionMismatch when u is not at a version p accepts, or with ErrPreconditionRequired
+// when p is absent and required.
+func (p Precondition) check(u *model.User, required bool) error {
+	switch {
+	case !p.present && required:
+		return ErrPreconditionRequired
+	case !p.present, p.any, slices.Contains(p.versions, u.Version):
+		return nil
+	default:
+		return ErrVersionMismatch
+	}
+}
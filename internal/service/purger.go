@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+// DefaultPurgeRetention is how long a soft-deleted user can still be restored before it is purged.
+const DefaultPurgeRetention = 30 * 24 * time.Hour
+
+// UserPurger permanently removes users that have been soft-deleted for longer than the retention window.
+type UserPurger struct {
+	repo      repo.UserRepository
+	retention time.Duration
+}
+
+func NewUserPurger(repo repo.UserRepository, retention time.Duration) *UserPurger {
+	return &UserPurger{repo: repo, retention: retention}
+}
+
+// Purge removes every user deleted more than the retention window ago and returns how many were removed.
+func (p *UserPurger) Purge(ctx context.Context) (int64, error) {
+	return p.repo.Purge(ctx, time.Now().Add(-p.retention))
+}
+
+// Run purges every interval until ctx is cancelled.
+func (p *UserPurger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := p.Purge(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Error("user purge failed", "error", err)
+			} else if n > 0 {
+				logging.FromContext(ctx).Info("purged deleted users", "count", n)
+			}
+		}
+	}
+}
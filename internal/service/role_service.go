@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var ErrUnknownRole = apperr.Validation("unknown_role", "unknown role")
+
+type RoleService struct {
+	users  repo.UserRepository
+	roles  repo.RoleRepository
+	tokens *TokenService
+}
+
+func NewRoleService(users repo.UserRepository, roles repo.RoleRepository, tokens *TokenService) *RoleService {
+	return &RoleService{users: users, roles: roles, tokens: tokens}
+}
+
+// Grant gives the user identified by objectId a role. The caller must hold roles:manage. The role shows up
+// in the user's access tokens from their next login or refresh.
+func (s *RoleService) Grant(ctx context.Context, caller Caller, objectId, role string) (*model.UserResponse, error) {
+	u, err := s.find(ctx, caller, objectId)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.roles.Grant(ctx, u.Id, role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUnknownRole
+	}
+	return s.reload(ctx, u.Id)
+}
+
+// Revoke takes a role away from the user identified by objectId. The caller must hold roles:manage. The
+// user's access tokens are revoked so the role stops applying immediately; refreshing yields new claims.
+func (s *RoleService) Revoke(ctx context.Context, caller Caller, objectId, role string) (*model.UserResponse, error) {
+	u, err := s.find(ctx, caller, objectId)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.roles.Revoke(ctx, u.Id, role)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := s.tokens.RevokeAccessTokens(ctx, u.Id); err != nil {
+			return nil, err
+		}
+	}
+	return s.reload(ctx, u.Id)
+}
+
+func (s *RoleService) find(ctx context.Context, caller Caller, objectId string) (*model.User, error) {
+	if !caller.Can(auth.PermRolesManage) {
+		return nil, ErrForbidden
+	}
+	u, err := s.users.FindByObjectId(ctx, objectId)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return u, nil
+}
+
+func (s *RoleService) reload(ctx context.Context, userId int64) (*model.UserResponse, error) {
+	u, err := s.users.FindById(ctx, userId)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return ToUserResponse(u), nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type fakeRoleRepo struct {
+	known  []string
+	grants map[int64][]string
+}
+
+func (f *fakeRoleRepo) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	return nil, nil
+}
+
+func (f *fakeRoleRepo) Grant(ctx context.Context, userId int64, role string) (bool, error) {
+	if !slices.Contains(f.known, role) {
+		return false, nil
+	}
+	if !slices.Contains(f.grants[userId], role) {
+		f.grants[userId] = append(f.grants[userId], role)
+	}
+	return true, nil
+}
+
+func (f *fakeRoleRepo) Revoke(ctx context.Context, userId int64, role string) (bool, error) {
+	i := slices.Index(f.grants[userId], role)
+	if i < 0 {
+		return false, nil
+	}
+	f.grants[userId] = slices.Delete(f.grants[userId], i, i+1)
+	return true, nil
+}
+
+func TestRoleService_GrantAndRevoke(t *testing.T) {
+	roles := &fakeRoleRepo{
+		known:  []string{auth.RoleAdmin, auth.RoleSupport, auth.RoleUser},
+		grants: map[int64][]string{5: {auth.RoleUser}},
+	}
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(id string) (*model.User, error) {
+			if id != "target" {
+				return nil, repo.ErrNotFound
+			}
+			return &model.User{Id: 5, ObjectId: id}, nil
+		},
+		FindByIdFunc: func(id int64) (*model.User, error) {
+			return &model.User{Id: id, ObjectId: "target", Roles: slices.Clone(roles.grants[id])}, nil
+		},
+	}
+	denylist := newTestDenylist()
+	svc := NewRoleService(users, roles, NewTokenService(users, newFakeTokenRepo(), testKeys, denylist))
+	manager := Caller{Id: 1, Permissions: []string{auth.PermRolesManage}}
+
+	// — callers without roles:manage are turned away
+	_, err := svc.Grant(t.Context(), Caller{Id: 5, Permissions: []string{auth.PermUsersUpdate}}, "target", auth.RoleAdmin)
+	assert.Equal(t, ErrForbidden, err)
+	assert.Equal(t, []string{auth.RoleUser}, roles.grants[5])
+
+	_, err = svc.Grant(t.Context(), manager, "missing", auth.RoleSupport)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = svc.Grant(t.Context(), manager, "target", "wizard")
+	assert.Equal(t, ErrUnknownRole, err)
+
+	resp, err := svc.Grant(t.Context(), manager, "target", auth.RoleSupport)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.RoleUser, auth.RoleSupport}, resp.Roles)
+	assert.False(t, denylist.IsRevoked("", 5, time.Now().Add(-time.Minute)), "granting leaves tokens alone")
+
+	// — revoking a role kills access tokens carrying it
+	resp, err = svc.Revoke(t.Context(), manager, "target", auth.RoleSupport)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.RoleUser}, resp.Roles)
+	assert.True(t, denylist.IsRevoked("", 5, time.Now().Add(-time.Minute)))
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var ErrInvalidRefreshToken = apperr.Unauthorized("invalid_refresh_token", "invalid refresh token")
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenService issues access/refresh token pairs. Refresh tokens are single use: every refresh rotates the
+// token within its family, and presenting a rotated-out token revokes the whole family.
+type TokenService struct {
+	users    repo.UserRepository
+	tokens   repo.RefreshTokenRepository
+	keys     *auth.Keyring
+	denylist *auth.Denylist
+	// AccessTTL and RefreshTTL are how long issued tokens live. They default to AccessTokenTTL and
+	// RefreshTokenTTL.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func NewTokenService(users repo.UserRepository, tokens repo.RefreshTokenRepository, keys *auth.Keyring, denylist *auth.Denylist) *TokenService {
+	return &TokenService{
+		users:      users,
+		tokens:     tokens,
+		keys:       keys,
+		denylist:   denylist,
+		AccessTTL:  AccessTokenTTL,
+		RefreshTTL: RefreshTokenTTL,
+	}
+}
+
+// Issue starts a new refresh token family for the user and returns the first pair.
+func (s *TokenService) Issue(ctx context.Context, u *model.User) (*model.TokenPair, error) {
+	return s.issue(ctx, u, uuid.NewString())
+}
+
+// Refresh exchanges a live refresh token for a new pair and retires the presented token.
+func (s *TokenService) Refresh(ctx context.Context, rawToken string) (*model.TokenPair, error) {
+	t, err := s.tokens.FindByHash(ctx, auth.HashOpaqueToken(rawToken))
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+	if t.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if t.RotatedAt != nil {
+		return nil, s.revokeReused(ctx, t)
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	rotated, err := s.tokens.MarkRotated(ctx, t.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request rotated or revoked this token between our read and write.
+		return nil, s.revokeReused(ctx, t)
+	}
+
+	u, err := s.users.FindById(ctx, t.UserId)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, u, t.FamilyId)
+}
+
+// Logout revokes the presented access token and, when given, the refresh token family it was issued with.
+// A refresh token belonging to another user is ignored.
+func (s *TokenService) Logout(ctx context.Context, userId int64, jti string, expiresAt time.Time, rawRefreshToken string) error {
+	if err := s.denylist.Revoke(ctx, jti, userId, expiresAt); err != nil {
+		return err
+	}
+	if rawRefreshToken == "" {
+		return nil
+	}
+	t, err := s.tokens.FindByHash(ctx, auth.HashOpaqueToken(rawRefreshToken))
+	if err != nil || t.UserId != userId {
+		return nil
+	}
+	return s.tokens.RevokeFamily(ctx, t.FamilyId)
+}
+
+// RevokeAll invalidates every access and refresh token issued to the user so far.
+func (s *TokenService) RevokeAll(ctx context.Context, userId int64) error {
+	if err := s.denylist.RevokeAll(ctx, userId); err != nil {
+		return err
+	}
+	return s.tokens.RevokeAllForUser(ctx, userId)
+}
+
+// RevokeAccessTokens invalidates the user's outstanding access tokens but keeps their refresh tokens, so
+// clients pick up a fresh set of claims on their next refresh.
+func (s *TokenService) RevokeAccessTokens(ctx context.Context, userId int64) error {
+	return s.denylist.RevokeAll(ctx, userId)
+}
+
+// IssueMFAPending returns a token proving the user passed the password step of login.
+func (s *TokenService) IssueMFAPending(ctx context.Context, u *model.User) (string, error) {
+	if err := s.waitForCutoff(ctx, u.Id); err != nil {
+		return "", err
+	}
+	return s.keys.IssueMFAPendingJWT(u.Id, MFAPendingTTL)
+}
+
+// VerifyMFAPending checks a token from IssueMFAPending and returns its claims and user id.
+func (s *TokenService) VerifyMFAPending(raw string) (*jwt.RegisteredClaims, int64, error) {
+	claims, err := s.keys.ParseMFAPendingJWT(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	if claims.IssuedAt == nil || s.denylist.IsRevoked(claims.ID, userId, claims.IssuedAt.Time) {
+		return nil, 0, jwt.ErrTokenInvalidId
+	}
+	return claims, userId, nil
+}
+
+// ConsumeMFAPending denylists a verified mfa token so it cannot be exchanged again.
+func (s *TokenService) ConsumeMFAPending(ctx context.Context, claims *jwt.RegisteredClaims, userId int64) error {
+	return s.denylist.Revoke(ctx, claims.ID, userId, claims.ExpiresAt.Time)
+}
+
+// revokeReused handles a refresh token that was presented after it had already been used. The token has
+// most likely leaked, so every token in its family is revoked.
+func (s *TokenService) revokeReused(ctx context.Context, t *model.RefreshToken) error {
+	logging.FromContext(ctx).Warn("refresh token reuse detected, revoking family", "target_user_id", t.UserId, "family_id", t.FamilyId)
+	if err := s.tokens.RevokeFamily(ctx, t.FamilyId); err != nil {
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+func (s *TokenService) issue(ctx context.Context, u *model.User, familyId string) (*model.TokenPair, error) {
+	if err := s.waitForCutoff(ctx, u.Id); err != nil {
+		return nil, err
+	}
+	accessToken, err := s.keys.IssueJWT(u.Id, u.Email, u.Roles, s.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	t := &model.RefreshToken{
+		UserId:    u.Id,
+		FamilyId:  familyId,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.RefreshTTL),
+	}
+	if err := s.tokens.Create(ctx, t); err != nil {
+		return nil, err
+	}
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: raw,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.AccessTTL.Seconds()),
+	}, nil
+}
+
+// waitForCutoff holds up issuing a token to the user until it would no longer fall under a revoke-all made
+// earlier in the same second. It only waits after a revoke-all this replica knows of.
+func (s *TokenService) waitForCutoff(ctx context.Context, userId int64) error {
+	wait := time.Until(s.denylist.NotBefore(userId))
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
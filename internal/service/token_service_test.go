@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var testKeys = mustGenerateKeyring()
+
+func mustGenerateKeyring() *auth.Keyring {
+	keys, err := auth.NewGeneratedKeyring(auth.AlgEdDSA, time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+type fakeRevocationRepo struct {
+	mu          sync.Mutex
+	revocations []*model.TokenRevocation
+}
+
+func (f *fakeRevocationRepo) Create(ctx context.Context, r *model.TokenRevocation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.Id = int64(len(f.revocations) + 1)
+	r.CreatedAt = time.Now()
+	f.revocations = append(f.revocations, r)
+	return nil
+}
+
+func (f *fakeRevocationRepo) ListSince(ctx context.Context, since time.Time) ([]*model.TokenRevocation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*model.TokenRevocation
+	for _, r := range f.revocations {
+		if !r.CreatedAt.Before(since) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRevocationRepo) DeleteExpired(ctx context.Context, now time.Time) error { return nil }
+
+func newTestDenylist() *auth.Denylist {
+	return auth.NewDenylist(&fakeRevocationRepo{}, AccessTokenTTL)
+}
+
+type fakeTokenRepo struct {
+	mu     sync.Mutex
+	nextId int64
+	byHash map[string]*model.RefreshToken
+}
+
+func newFakeTokenRepo() *fakeTokenRepo {
+	return &fakeTokenRepo{byHash: map[string]*model.RefreshToken{}}
+}
+
+func (f *fakeTokenRepo) Create(ctx context.Context, t *model.RefreshToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	t.Id = f.nextId
+	t.CreatedAt = time.Now()
+	cp := *t
+	f.byHash[t.TokenHash] = &cp
+	return nil
+}
+
+func (f *fakeTokenRepo) FindByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.byHash[hash]
+	if !ok {
+		return nil, repo.ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (f *fakeTokenRepo) MarkRotated(ctx context.Context, id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.byHash {
+		if t.Id == id && t.RotatedAt == nil && t.RevokedAt == nil {
+			now := time.Now()
+			t.RotatedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeTokenRepo) RevokeAllForUser(ctx context.Context, userId int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, t := range f.byHash {
+		if t.UserId == userId && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokenRepo) RevokeFamily(ctx context.Context, familyId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, t := range f.byHash {
+		if t.FamilyId == familyId && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func TestTokenService_Refresh(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	users := &fakeRepo{
+		FindByIdFunc: func(id int64) (*model.User, error) {
+			assert.Equal(t, user.Id, id)
+			return user, nil
+		},
+	}
+	tokens := newFakeTokenRepo()
+	svc := NewTokenService(users, tokens, testKeys, newTestDenylist())
+
+	first, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+
+	// — a live token rotates
+	second, err := svc.Refresh(t.Context(), first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEmpty(t, second.AccessToken)
+
+	old, err := tokens.FindByHash(t.Context(), auth.HashOpaqueToken(first.RefreshToken))
+	require.NoError(t, err)
+	current, err := tokens.FindByHash(t.Context(), auth.HashOpaqueToken(second.RefreshToken))
+	require.NoError(t, err)
+	assert.NotNil(t, old.RotatedAt)
+	assert.Equal(t, old.FamilyId, current.FamilyId)
+
+	// — unknown token
+	_, err = svc.Refresh(t.Context(), "not-a-token")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	// — replaying a rotated-out token revokes the whole family
+	_, err = svc.Refresh(t.Context(), first.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	_, err = svc.Refresh(t.Context(), second.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	// — other families are unaffected
+	other, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+	_, err = svc.Refresh(t.Context(), other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenService_Refresh_Expired(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	tokens := newFakeTokenRepo()
+	svc := NewTokenService(&fakeRepo{}, tokens, testKeys, newTestDenylist())
+	svc.RefreshTTL = -time.Minute
+
+	pair, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+
+	_, err = svc.Refresh(t.Context(), pair.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+}
+
+func TestTokenService_Logout(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	tokens := newFakeTokenRepo()
+	denylist := newTestDenylist()
+	svc := NewTokenService(&fakeRepo{}, tokens, testKeys, denylist)
+
+	mine, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+	theirs, err := svc.Issue(t.Context(), &model.User{Id: 2, Email: "john@doe.com"})
+	require.NoError(t, err)
+
+	issuedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, svc.Logout(t.Context(), user.Id, "jti-1", time.Now().Add(time.Minute), mine.RefreshToken))
+	assert.True(t, denylist.IsRevoked("jti-1", user.Id, issuedAt))
+	assert.False(t, denylist.IsRevoked("jti-2", user.Id, issuedAt))
+
+	stored, err := tokens.FindByHash(t.Context(), auth.HashOpaqueToken(mine.RefreshToken))
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	// — someone else's refresh token is left alone
+	require.NoError(t, svc.Logout(t.Context(), user.Id, "jti-3", time.Now().Add(time.Minute), theirs.RefreshToken))
+	stored, err = tokens.FindByHash(t.Context(), auth.HashOpaqueToken(theirs.RefreshToken))
+	require.NoError(t, err)
+	assert.Nil(t, stored.RevokedAt)
+}
+
+func TestTokenService_RevokeAll(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	tokens := newFakeTokenRepo()
+	denylist := newTestDenylist()
+	svc := NewTokenService(&fakeRepo{}, tokens, testKeys, denylist)
+
+	pair, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeAll(t.Context(), user.Id))
+	assert.True(t, denylist.IsRevoked("any", user.Id, time.Now().Add(-time.Minute)))
+	assert.False(t, denylist.IsRevoked("any", 2, time.Now().Add(-time.Minute)))
+
+	_, err = svc.Refresh(t.Context(), pair.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+}
+
+func TestTokenService_IssueAfterRevokeAll(t *testing.T) {
+	user := &model.User{Id: 1, Email: "jane@doe.com"}
+	denylist := newTestDenylist()
+	svc := NewTokenService(&fakeRepo{}, newFakeTokenRepo(), testKeys, denylist)
+
+	// — a token issued in the same second as a revoke-all, but after it, is not revoked by it
+	require.NoError(t, svc.RevokeAccessTokens(t.Context(), user.Id))
+	pair, err := svc.Issue(t.Context(), user)
+	require.NoError(t, err)
+	claims := &auth.Claims{}
+	_, _, err = jwt.NewParser().ParseUnverified(pair.AccessToken, claims)
+	require.NoError(t, err)
+	assert.False(t, denylist.IsRevoked(claims.ID, user.Id, claims.IssuedAt.Time))
+}
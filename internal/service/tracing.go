@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const instrumentation = "github.com/thornhall/simple-go-service/internal/service"
+
+// tracer looks the tracer up on every use rather than once, so it follows the current global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// endSpan marks the span failed when *err is set and ends it. It is meant to be deferred with a pointer to
+// the method's named error result.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// hashPassword runs bcrypt in its own span, since at production cost it usually dominates the request.
+func hashPassword(ctx context.Context, password string, cost int) ([]byte, error) {
+	_, span := tracer().Start(ctx, "bcrypt.GenerateFromPassword", trace.WithAttributes(attribute.Int("bcrypt.cost", cost)))
+	defer span.End()
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
+// comparePassword runs the bcrypt comparison in its own span. A mismatch is an expected outcome, so it does
+// not mark the span failed.
+func comparePassword(ctx context.Context, hash, password string) error {
+	_, span := tracer().Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestUserService_Create_TracesBcrypt(t *testing.T) {
+	recorder := recordSpans(t)
+	svc := newTestUserService(&fakeRepo{CreateFunc: func(u *model.User) error { return nil }})
+
+	_, _, err := svc.Create(t.Context(), model.CreateUserInput{Email: "foo@bar.com", Password: "secret"})
+	require.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	create, ok := spans["UserService.Create"]
+	require.True(t, ok)
+	hash, ok := spans["bcrypt.GenerateFromPassword"]
+	require.True(t, ok)
+	assert.Equal(t, create.SpanContext().SpanID(), hash.Parent().SpanID())
+}
+
+func TestUserService_Get_MarksSpanFailed(t *testing.T) {
+	recorder := recordSpans(t)
+	svc := newTestUserService(&fakeRepo{
+		FindByObjectIdFunc: func(id string) (*model.User, error) { return nil, repo.ErrNotFound },
+	})
+
+	_, err := svc.Get(t.Context(), Caller{Id: 1}, "missing")
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "UserService.Get", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+var ErrInvalidCursor = apperr.Validation("invalid_cursor", "invalid cursor")
+
+const (
+	defaultListLimit = 20
+	defaultListSort  = "created_at"
+)
+
+// List returns a page of users for admin tooling; the caller must hold users:list. Pages are keyset
+// paginated on the sort field and id, so rows inserted or deleted between requests do not shift later pages.
+func (s *UserService) List(ctx context.Context, caller Caller, params model.ListUsersParams) (_ *model.ListUsersResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.List")
+	defer endSpan(span, &err)
+	if !caller.Can(auth.PermUsersList) {
+		return nil, ErrForbidden
+	}
+
+	sort := params.Sort
+	if sort == "" {
+		sort = defaultListSort
+	}
+	limit := params.Limit
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	q := model.UserListQuery{
+		// stored emails are normalized, so a prefix only matches once it is too
+		EmailPrefix:   validation.NormalizeEmail(params.EmailPrefix),
+		Name:          params.Name,
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		SortField:     strings.TrimPrefix(sort, "-"),
+		Descending:    strings.HasPrefix(sort, "-"),
+		// one extra row tells us whether there is a next page
+		Limit: limit + 1,
+	}
+	switch params.Deleted {
+	case "", "false":
+		q.Deleted = new(bool)
+	case "true":
+		deleted := true
+		q.Deleted = &deleted
+	}
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor, sort)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		q.After = c
+	}
+
+	users, err := s.repo.List(ctx, q)
+	if errors.Is(err, repo.ErrInvalid) && q.After != nil {
+		// the database refused a cursor value that passed decodeCursor, e.g. a year it cannot store
+		return nil, ErrInvalidCursor
+	} else if err != nil {
+		return nil, err
+	}
+	resp := &model.ListUsersResponse{Users: make([]*model.UserResponse, 0, len(users))}
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[len(users)-1]
+		resp.NextCursor = encodeCursor(&model.UserCursor{Sort: sort, Value: sortValue(last, q.SortField), Id: last.Id})
+	}
+	for _, u := range users {
+		resp.Users = append(resp.Users, ToUserResponse(u))
+	}
+	return resp, nil
+}
+
+// sortValue renders the value of the field u was sorted on, in a form Postgres casts back losslessly.
+func sortValue(u *model.User, field string) string {
+	switch field {
+	case "updated_at":
+		return u.UpdatedAt.Format(time.RFC3339Nano)
+	case "email":
+		return u.Email
+	case "first_name":
+		return u.FirstName
+	case "last_name":
+		// users without a last name sort as COALESCE(last_name, '')
+		if u.LastName == nil {
+			return ""
+		}
+		return *u.LastName
+	default:
+		return u.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func encodeCursor(c *model.UserCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor reads a cursor made by encodeCursor for a page sorted by sort. Cursors come back from
+// clients, so the value is checked against the sort field's type rather than trusted.
+func decodeCursor(raw, sort string) (*model.UserCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	c := &model.UserCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if c.Sort != sort {
+		return nil, fmt.Errorf("cursor is for sort %q, not %q", c.Sort, sort)
+	}
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at", "updated_at":
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+func TestUserService_List(t *testing.T) {
+	base := time.Date(2025, 6, 1, 12, 0, 0, 123456000, time.UTC)
+	var rows []*model.User
+	for i := int64(1); i <= 5; i++ {
+		rows = append(rows, &model.User{Id: i, ObjectId: "u", Email: "e", CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	var got model.UserListQuery
+	users := &fakeRepo{
+		ListFunc: func(q model.UserListQuery) ([]*model.User, error) {
+			got = q
+			start := 0
+			if q.After != nil {
+				start = int(q.After.Id)
+			}
+			end := min(start+q.Limit, len(rows))
+			return rows[start:end], nil
+		},
+	}
+	svc := newTestUserService(users)
+	admin := Caller{Id: 1, Permissions: []string{auth.PermUsersList}}
+
+	// — only callers holding users:list may list
+	_, err := svc.List(t.Context(), Caller{Id: 2}, model.ListUsersParams{})
+	assert.Equal(t, ErrForbidden, err)
+
+	// — defaults: live users only, oldest first
+	page, err := svc.List(t.Context(), admin, model.ListUsersParams{Limit: 2, EmailPrefix: " Ada"})
+	require.NoError(t, err)
+	assert.Equal(t, "created_at", got.SortField)
+	assert.False(t, got.Descending)
+	require.NotNil(t, got.Deleted)
+	assert.False(t, *got.Deleted)
+	assert.Equal(t, "ada", got.EmailPrefix, "prefixes are normalized like the emails they match")
+	assert.Equal(t, 3, got.Limit, "one extra row is fetched to detect the next page")
+	assert.Len(t, page.Users, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, err = svc.List(t.Context(), admin, model.ListUsersParams{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.NotNil(t, got.After)
+	assert.Equal(t, int64(2), got.After.Id)
+	assert.Equal(t, base.Add(2*time.Minute).Format(time.RFC3339Nano), got.After.Value)
+	assert.Len(t, page.Users, 2)
+
+	page, err = svc.List(t.Context(), admin, model.ListUsersParams{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, page.Users, 1)
+	assert.Empty(t, page.NextCursor)
+
+	// — sort direction and deleted filter
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{Sort: "-email", Deleted: "any"})
+	require.NoError(t, err)
+	assert.Equal(t, "email", got.SortField)
+	assert.True(t, got.Descending)
+	assert.Nil(t, got.Deleted)
+	assert.Equal(t, defaultListLimit+1, got.Limit)
+
+	// — cursors are opaque and tied to their sort order
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{Cursor: "not-a-cursor"})
+	assert.Equal(t, ErrInvalidCursor, err)
+	emailCursor := encodeCursor(&model.UserCursor{Sort: "email", Value: "a", Id: 1})
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{Cursor: emailCursor})
+	assert.Equal(t, ErrInvalidCursor, err)
+	// — a tampered value never reaches the database as a timestamp
+	tampered := encodeCursor(&model.UserCursor{Sort: "created_at", Value: "yesterday", Id: 1})
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{Cursor: tampered})
+	assert.Equal(t, ErrInvalidCursor, err)
+	// — nor is a value the database refuses reported as an outage
+	users.ListFunc = func(model.UserListQuery) ([]*model.User, error) { return nil, repo.ErrInvalid }
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{Cursor: encodeCursor(&model.UserCursor{Sort: "created_at", Value: "0000-01-01T00:00:00Z", Id: 1})})
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	users.ListFunc = func(model.UserListQuery) ([]*model.User, error) { return nil, errors.New("db down") }
+	_, err = svc.List(t.Context(), admin, model.ListUsersParams{})
+	assert.EqualError(t, err, "db down")
+}
@@ -3,107 +3,356 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
-	"log"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/logging"
 	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/middleware/ratelimit"
 	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/patch"
 	"github.com/thornhall/simple-go-service/internal/repo"
+	"github.com/thornhall/simple-go-service/internal/validation"
 )
 
-var ErrNotFound = errors.New("user not found")
-var ErrInvalidAuth = errors.New("invalid email or password")
+var ErrNotFound = apperr.NotFound("user_not_found", "user not found")
+var ErrInvalidAuth = apperr.Unauthorized("invalid_credentials", "invalid email or password")
+var ErrForbidden = apperr.Forbidden("forbidden", "caller may not access this user")
 
 type UserService struct {
-	repo repo.UserRepository
+	repo     repo.UserRepository
+	tokens   *TokenService
+	verifier *VerificationService
+	mfa      *MFAService
+
+	// RequireVerifiedEmail rejects logins from accounts that have not confirmed their email address.
+	RequireVerifiedEmail bool
+	// LoginLimiter throttles login attempts per email address. Nil disables it.
+	LoginLimiter *ratelimit.Limiter
+	// Lockout locks accounts after repeated wrong passwords. MFAService keeps its own copy for second factors.
+	Lockout LockoutPolicy
+	// PasswordCost is the bcrypt cost of new password hashes. It defaults to bcrypt.DefaultCost.
+	PasswordCost int
+	// Tx runs the reads and writes of Update and Delete in one transaction, so a concurrent change cannot
+	// slip in between them. Nil runs them without one.
+	Tx repo.Transactor
+	// RequireIfMatch refuses updates and deletes that do not say which version of the user they expect.
+	RequireIfMatch bool
+}
+
+func NewUserService(repo repo.UserRepository, tokens *TokenService, verifier *VerificationService, mfa *MFAService) *UserService {
+	return &UserService{repo: repo, tokens: tokens, verifier: verifier, mfa: mfa, Lockout: DefaultLockoutPolicy, PasswordCost: bcrypt.DefaultCost}
 }
 
-func NewUserService(repo repo.UserRepository) *UserService {
-	return &UserService{repo: repo}
+// Login checks the password. Accounts with MFA enabled get a short-lived mfa token instead of a token pair,
+// to be exchanged through MFAService.Login together with a second factor. Throttled attempts and locked
+// accounts fail with ErrTooManyAttempts or ErrAccountLocked.
+func (s *UserService) Login(ctx context.Context, input model.LoginUserInput) (_ *model.LoginResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Login")
+	defer endSpan(span, &err)
+	resp, err := s.login(ctx, input)
+	observeLogin(resp, err)
+	return resp, err
 }
 
-func (s *UserService) Login(ctx context.Context, input model.LoginUserInput) (string, error) {
+func (s *UserService) login(ctx context.Context, input model.LoginUserInput) (*model.LoginResponse, error) {
+	if err := s.throttle(ctx, input.Email); err != nil {
+		return nil, err
+	}
 	user, err := s.repo.FindByEmail(ctx, input.Email)
-	if err != nil {
-		return "", ErrInvalidAuth
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, ErrInvalidAuth
+	} else if err != nil {
+		return nil, err
+	}
+	if err := lockedErr(user); err != nil {
+		return nil, err
 	}
 	passwordHash := user.PasswordHash
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(input.Password))
+	err = comparePassword(ctx, passwordHash, input.Password)
+	if err != nil {
+		s.recordFailure(ctx, user)
+		return nil, ErrInvalidAuth
+	}
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := s.repo.ResetLoginFailures(ctx, user.Id); err != nil {
+			logging.FromContext(ctx).Error("unable to reset login failures", "target_user_id", user.Id, "error", err)
+		}
+	}
+	if s.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	mfaEnabled, err := s.mfa.Enabled(ctx, user.Id)
 	if err != nil {
-		return "", ErrInvalidAuth
+		return nil, err
 	}
-	jwt, err := auth.IssueJWT(user.Id, user.Email)
+	if mfaEnabled {
+		pending, err := s.tokens.IssueMFAPending(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResponse{MFARequired: true, MFAToken: pending}, nil
+	}
+	tokens, err := s.tokens.Issue(ctx, user)
 	if err != nil {
-		log.Println(fmt.Errorf("error generating jwt %w", err))
-		return "", errors.New("unable to generate jwt")
+		logging.FromContext(ctx).Error("unable to generate tokens", "target_user_id", user.Id, "error", err)
+		return nil, errors.New("unable to generate tokens")
 	}
-	return jwt, nil
+	return &model.LoginResponse{TokenPair: tokens}, nil
 }
 
-func (s *UserService) Get(ctx context.Context, objectId string) (*model.UserResponse, error) {
-	u, err := s.repo.FindByObjectId(ctx, objectId)
+// Get returns the user identified by objectId. The caller must own the record or hold users:read.
+func (s *UserService) Get(ctx context.Context, caller Caller, objectId string) (_ *model.UserResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Get", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	u, err := s.findOwned(ctx, caller, objectId, auth.PermUsersRead)
 	if err != nil {
-		return nil, ErrNotFound
+		return nil, err
 	}
 	return ToUserResponse(u), nil
 }
 
-func (s *UserService) Create(ctx context.Context, input model.CreateUserInput) (*model.UserResponse, string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+func (s *UserService) Create(ctx context.Context, input model.CreateUserInput) (_ *model.UserResponse, _ *model.TokenPair, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Create")
+	defer endSpan(span, &err)
+	hashed, err := hashPassword(ctx, input.Password, s.PasswordCost)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	u := &model.User{
 		FirstName:    input.FirstName,
-		LastName:     input.LastName,
 		Email:        input.Email,
 		PasswordHash: string(hashed),
+		Roles:        []string{auth.RoleUser},
+	}
+	if input.LastName != "" {
+		u.LastName = &input.LastName
 	}
 
 	err = s.repo.Create(ctx, u)
+	if errors.Is(err, repo.ErrConflict) {
+		return nil, nil, ErrEmailTaken
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if err := s.verifier.Send(ctx, u, u.Email); err != nil {
+		logging.FromContext(ctx).Error("unable to send verification email", "target_user_id", u.Id, "error", err)
+	}
+	tokens, err := s.tokens.Issue(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ToUserResponse(u), tokens, nil
+}
+
+// Update replaces the user's profile with input. A new email is only staged as pending until the user
+// confirms it through the link mailed to that address; the current email stays the login address until
+// then. The caller must own the record or hold users:update. It fails with ErrVersionMismatch when pre does
+// not hold, or when another write changes the user first.
+func (s *UserService) Update(ctx context.Context, caller Caller, objectId string, pre Precondition, input model.UpdateUserInput) (_ *model.UserResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Update", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	return s.replace(ctx, caller, objectId, pre, func(*model.User) (model.UpdateUserInput, error) {
+		return input, nil
+	})
+}
+
+// Patch applies p to the user's profile and saves it like Update. The patch sees the profile as the
+// fields of model.UpdateUserInput, so its email is the pending address when there is one. A patch that
+// cannot be applied fails with patch.ErrConflict, and one leaving the profile invalid with
+// validation.ErrInvalid.
+func (s *UserService) Patch(ctx context.Context, caller Caller, objectId string, pre Precondition, p patch.Patch) (_ *model.UserResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Patch", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	return s.replace(ctx, caller, objectId, pre, func(u *model.User) (model.UpdateUserInput, error) {
+		var input model.UpdateUserInput
+		doc, err := p.Apply(profile(u))
+		if err == nil {
+			err = doc.Decode(&input)
+		}
+		if err == nil {
+			err = validation.Struct(&input)
+		}
+		return input, err
+	})
+}
+
+// profile is the document a patch of u applies to.
+func profile(u *model.User) patch.Document {
+	email := u.Email
+	if u.PendingEmail != nil {
+		email = *u.PendingEmail
+	}
+	doc := patch.Document{"first_name": u.FirstName, "last_name": nil, "email": email}
+	if u.LastName != nil {
+		doc["last_name"] = *u.LastName
+	}
+	return doc
+}
+
+// replace saves the profile build makes from the current user, in a transaction with the read, and mails
+// a verification link to a newly staged email once it commits.
+func (s *UserService) replace(ctx context.Context, caller Caller, objectId string, pre Precondition, build func(u *model.User) (model.UpdateUserInput, error)) (*model.UserResponse, error) {
+	var u *model.User
+	var staged string
+	err := s.inTx(ctx, func(ctx context.Context) (err error) {
+		u, staged, err = s.update(ctx, caller, objectId, pre, build)
+		return err
+	})
 	if err != nil {
+		return nil, err
+	}
+	// mail goes out once the change is committed, never from a transaction that may be retried
+	if staged != "" {
+		if err := s.verifier.Send(ctx, u, staged); err != nil {
+			logging.FromContext(ctx).Error("unable to send verification email", "target_user_id", u.Id, "error", err)
+		}
+	}
+	return ToUserResponse(u), nil
+}
+
+// update saves the profile build makes from the user and returns the user along with the email address
+// staged for verification, if any.
+func (s *UserService) update(ctx context.Context, caller Caller, objectId string, pre Precondition, build func(u *model.User) (model.UpdateUserInput, error)) (*model.User, string, error) {
+	u, err := s.findOwned(ctx, caller, objectId, auth.PermUsersUpdate)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := pre.check(u, s.RequireIfMatch); err != nil {
 		return nil, "", err
 	}
-	signedJwt, err := auth.IssueJWT(u.Id, u.Email)
+	input, err := build(u)
 	if err != nil {
 		return nil, "", err
 	}
-	return ToUserResponse(u), signedJwt, nil
+
+	u.FirstName = input.FirstName
+	u.LastName = input.LastName
+	var staged string
+	if input.Email == u.Email {
+		u.PendingEmail = nil
+	} else if u.PendingEmail == nil || *u.PendingEmail != input.Email {
+		if _, err := s.repo.FindByEmail(ctx, input.Email); err == nil {
+			return nil, "", ErrEmailTaken
+		} else if !errors.Is(err, repo.ErrNotFound) {
+			return nil, "", err
+		}
+		staged = input.Email
+		u.PendingEmail = &staged
+	}
+
+	if err := s.repo.Update(ctx, u); errors.Is(err, repo.ErrStale) {
+		return nil, "", ErrVersionMismatch
+	} else if err != nil {
+		return nil, "", notFound(err)
+	}
+	return u, staged, nil
+}
+
+func (s *UserService) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.Tx == nil {
+		return fn(ctx)
+	}
+	return s.Tx.InTx(ctx, fn)
 }
 
-func (s *UserService) Update(ctx context.Context, objectId string, input model.UpdateUserInput) (*model.UserResponse, error) {
-	u, err := s.repo.FindByObjectId(ctx, objectId)
+// Delete soft-deletes the user and signs them out everywhere. The row is purged after the retention window.
+// The caller must own the record or hold users:delete. It fails with ErrVersionMismatch when pre does not
+// hold.
+func (s *UserService) Delete(ctx context.Context, caller Caller, objectId string, pre Precondition) (err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Delete", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	var u *model.User
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		u, err = s.findOwned(ctx, caller, objectId, auth.PermUsersDelete)
+		if err != nil {
+			return err
+		}
+		if err := pre.check(u, s.RequireIfMatch); err != nil {
+			return err
+		}
+		return notFound(s.repo.Delete(ctx, objectId))
+	})
 	if err != nil {
-		return nil, ErrNotFound
+		return err
 	}
+	return s.tokens.RevokeAll(ctx, u.Id)
+}
 
-	if input.FirstName != nil {
-		u.FirstName = *input.FirstName
+// Restore undoes a soft delete. The caller must hold users:restore.
+func (s *UserService) Restore(ctx context.Context, caller Caller, objectId string) (_ *model.UserResponse, err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Restore", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	if !caller.Can(auth.PermUsersRestore) {
+		return nil, ErrForbidden
 	}
-	if input.LastName != nil {
-		u.LastName = *input.LastName
+	u, err := s.repo.Restore(ctx, objectId)
+	if err != nil {
+		return nil, notFound(err)
 	}
-	if input.Email != nil {
-		u.Email = *input.Email
+	return ToUserResponse(u), nil
+}
+
+// Logout revokes the caller's current access token and the refresh token family it names, if any.
+func (s *UserService) Logout(ctx context.Context, callerId int64, jti string, expiresAt time.Time, refreshToken string) (err error) {
+	ctx, span := tracer().Start(ctx, "UserService.Logout")
+	defer endSpan(span, &err)
+	return s.tokens.Logout(ctx, callerId, jti, expiresAt, refreshToken)
+}
+
+// RevokeSessions signs the user out everywhere by revoking all of their outstanding tokens.
+// The caller must own the record or hold users:update.
+func (s *UserService) RevokeSessions(ctx context.Context, caller Caller, objectId string) (err error) {
+	ctx, span := tracer().Start(ctx, "UserService.RevokeSessions", trace.WithAttributes(attribute.String("user.object_id", objectId)))
+	defer endSpan(span, &err)
+	u, err := s.findOwned(ctx, caller, objectId, auth.PermUsersUpdate)
+	if err != nil {
+		return err
 	}
+	return s.tokens.RevokeAll(ctx, u.Id)
+}
 
-	if err := s.repo.Update(ctx, u); err != nil {
-		return nil, err
+func (s *UserService) findOwned(ctx context.Context, caller Caller, objectId, perm string) (*model.User, error) {
+	return findOwned(ctx, s.repo, caller, objectId, perm)
+}
+
+// findOwned loads the user identified by objectId and checks that it belongs to the caller, or that the
+// caller holds perm, which grants access to any user. An empty perm only admits the owner.
+func findOwned(ctx context.Context, users repo.UserRepository, caller Caller, objectId, perm string) (*model.User, error) {
+	u, err := users.FindByObjectId(ctx, objectId)
+	if err != nil {
+		return nil, notFound(err)
 	}
-	return ToUserResponse(u), nil
+	if u.Id != caller.Id && (perm == "" || !caller.Can(perm)) {
+		return nil, ErrForbidden
+	}
+	return u, nil
 }
 
-func (s *UserService) Delete(ctx context.Context, objectId string) error {
-	return s.repo.Delete(ctx, objectId)
+// notFound replaces a repository error saying the user does not exist with ErrNotFound. A malformed object
+// id names no user either. Any other error is returned unchanged.
+func notFound(err error) error {
+	if errors.Is(err, repo.ErrNotFound) || errors.Is(err, repo.ErrInvalid) {
+		return ErrNotFound
+	}
+	return err
 }
 
 func ToUserResponse(u *model.User) *model.UserResponse {
 	return &model.UserResponse{
-		ObjectId:  u.ObjectId,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Email:     u.Email,
+		ObjectId:      u.ObjectId,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		PendingEmail:  u.PendingEmail,
+		Roles:         u.Roles,
+		CreatedAt:     u.CreatedAt,
+		DeletedAt:     u.DeletedAt,
+		Version:       u.Version,
 	}
 }
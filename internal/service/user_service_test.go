@@ -3,8 +3,7 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
-	"os"
+	"net/http"
 	"strconv"
 	"testing"
 	"time"
@@ -15,7 +14,13 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
 	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/patch"
+	"github.com/thornhall/simple-go-service/internal/repo"
+	"github.com/thornhall/simple-go-service/internal/validation"
 )
 
 type fakeRepo struct {
@@ -24,7 +29,16 @@ type fakeRepo struct {
 	FindByObjectIdFunc func(id string) (*model.User, error)
 	CreateFunc         func(u *model.User) error
 	UpdateFunc         func(u *model.User) error
+	UpdatePasswordFunc func(id int64, hash string) error
+	ConfirmEmailFunc   func(id int64, email string) (bool, error)
 	DeleteFunc         func(id string) error
+	ListFunc           func(q model.UserListQuery) ([]*model.User, error)
+	RestoreFunc        func(id string) (*model.User, error)
+	PurgeFunc          func(before time.Time) (int64, error)
+	// the login failure hooks are optional; left nil they do nothing
+	RecordLoginFailureFunc func(id int64) (int, error)
+	LockUntilFunc          func(id int64, until time.Time) error
+	ResetLoginFailuresFunc func(id int64) error
 }
 
 func (f *fakeRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
@@ -39,44 +53,107 @@ func (f *fakeRepo) FindByObjectId(ctx context.Context, id string) (*model.User,
 }
 func (f *fakeRepo) Create(ctx context.Context, u *model.User) error { return f.CreateFunc(u) }
 func (f *fakeRepo) Update(ctx context.Context, u *model.User) error { return f.UpdateFunc(u) }
-func (f *fakeRepo) Delete(ctx context.Context, id string) error     { return f.DeleteFunc(id) }
+func (f *fakeRepo) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	return f.UpdatePasswordFunc(id, hash)
+}
+func (f *fakeRepo) ConfirmEmail(ctx context.Context, id int64, email string) (bool, error) {
+	return f.ConfirmEmailFunc(id, email)
+}
+func (f *fakeRepo) Delete(ctx context.Context, id string) error { return f.DeleteFunc(id) }
+func (f *fakeRepo) List(ctx context.Context, q model.UserListQuery) ([]*model.User, error) {
+	return f.ListFunc(q)
+}
+func (f *fakeRepo) Restore(ctx context.Context, id string) (*model.User, error) {
+	return f.RestoreFunc(id)
+}
+func (f *fakeRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return f.PurgeFunc(before)
+}
+func (f *fakeRepo) RecordLoginFailure(ctx context.Context, id int64) (int, error) {
+	if f.RecordLoginFailureFunc == nil {
+		return 1, nil
+	}
+	return f.RecordLoginFailureFunc(id)
+}
+func (f *fakeRepo) LockUntil(ctx context.Context, id int64, until time.Time) error {
+	if f.LockUntilFunc == nil {
+		return nil
+	}
+	return f.LockUntilFunc(id, until)
+}
+func (f *fakeRepo) ResetLoginFailures(ctx context.Context, id int64) error {
+	if f.ResetLoginFailuresFunc == nil {
+		return nil
+	}
+	return f.ResetLoginFailuresFunc(id)
+}
+
+// newTestUserService wires repo into a UserService backed by in-memory token stores.
+func newTestUserService(repo *fakeRepo) *UserService {
+	tokens := NewTokenService(repo, newFakeTokenRepo(), testKeys, newTestDenylist())
+	verifier := NewVerificationService(repo, newFakeVerificationRepo(), mail.NewLogSender(), "http://localhost/verify")
+	return NewUserService(repo, tokens, verifier, NewMFAService(repo, newFakeMFARepo(), tokens, testSecrets))
+}
 
 func TestUserService_Get(t *testing.T) {
 	createdAt := time.Now().Add(-time.Hour)
 	updatedAt := time.Now()
+	lastName := "Doe"
 
 	// — success case
 	want := &model.User{
+		Id:        7,
 		ObjectId:  "abc123",
 		FirstName: "Jane",
-		LastName:  "Doe",
+		LastName:  &lastName,
 		Email:     "jane@doe.com",
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
 	}
-	repo := &fakeRepo{
+	users := &fakeRepo{
 		FindByObjectIdFunc: func(id string) (*model.User, error) {
 			assert.Equal(t, "abc123", id)
 			return want, nil
 		},
 	}
-	svc := NewUserService(repo)
-	got, err := svc.Get(t.Context(), "abc123")
+	svc := newTestUserService(users)
+	got, err := svc.Get(t.Context(), Caller{Id: 7}, "abc123")
 	require.NoError(t, err)
 	assert.Equal(t, want.ObjectId, got.ObjectId)
 	assert.Equal(t, want.FirstName, got.FirstName)
 	assert.Equal(t, want.LastName, got.LastName)
 	assert.Equal(t, want.Email, got.Email)
 
-	// — repo error → ErrNotFound
+	// — another caller → ErrForbidden, unless their roles grant users:read
+	_, err = svc.Get(t.Context(), Caller{Id: 8}, "abc123")
+	assert.Equal(t, ErrForbidden, err)
+	_, err = svc.Get(t.Context(), Caller{Id: 8, Permissions: []string{auth.PermUsersList}}, "abc123")
+	assert.Equal(t, ErrForbidden, err)
+	got, err = svc.Get(t.Context(), Caller{Id: 8, Permissions: []string{auth.PermUsersRead}}, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, want.ObjectId, got.ObjectId)
+
+	// — no such user, or an object id that cannot name one → ErrNotFound
+	for _, notFound := range []error{repo.ErrNotFound, repo.ErrInvalid} {
+		repoNF := &fakeRepo{
+			FindByObjectIdFunc: func(_ string) (*model.User, error) {
+				return nil, notFound
+			},
+		}
+		svc = newTestUserService(repoNF)
+		_, err = svc.Get(t.Context(), Caller{Id: 7}, "doesnt-matter")
+		assert.Equal(t, ErrNotFound, err)
+	}
+
+	// — any other repo error is passed on rather than reported as not found
 	repoErr := &fakeRepo{
 		FindByObjectIdFunc: func(_ string) (*model.User, error) {
 			return nil, errors.New("db is down")
 		},
 	}
-	svc = NewUserService(repoErr)
-	_, err = svc.Get(t.Context(), "doesnt-matter")
-	assert.Equal(t, ErrNotFound, err)
+	svc = newTestUserService(repoErr)
+	_, err = svc.Get(t.Context(), Caller{Id: 7}, "doesnt-matter")
+	assert.EqualError(t, err, "db is down")
 }
 
 func TestUserService_Login_ReturnsValidJWT(t *testing.T) {
@@ -89,7 +166,6 @@ func TestUserService_Login_ReturnsValidJWT(t *testing.T) {
 		Id:           1,
 		ObjectId:     "abc123",
 		FirstName:    "Jane",
-		LastName:     "Doe",
 		Email:        "jane@doe.com",
 		CreatedAt:    createdAt,
 		UpdatedAt:    updatedAt,
@@ -102,20 +178,21 @@ func TestUserService_Login_ReturnsValidJWT(t *testing.T) {
 		},
 	}
 
-	svc := NewUserService(repo)
-	rawToken, err := svc.Login(context.Background(), model.LoginUserInput{
+	svc := newTestUserService(repo)
+	tokens, err := svc.Login(context.Background(), model.LoginUserInput{
 		Email:    "jane@doe.com",
 		Password: "test",
 	})
 	require.NoError(t, err)
-	require.NotEmpty(t, rawToken)
+	require.NotNil(t, tokens.TokenPair)
+	assert.False(t, tokens.MFARequired)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int64(AccessTokenTTL.Seconds()), tokens.ExpiresIn)
+	rawToken := tokens.AccessToken
 
-	parsed, err := jwt.ParseWithClaims(rawToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	parsed, err := jwt.ParseWithClaims(rawToken, &jwt.RegisteredClaims{}, testKeys.Keyfunc)
 	require.NoError(t, err, "token should parse without error")
 	require.NotNil(t, parsed)
 	require.True(t, parsed.Valid, "token should be valid")
@@ -126,6 +203,30 @@ func TestUserService_Login_ReturnsValidJWT(t *testing.T) {
 	assert.Equal(t, strconv.FormatInt(want.Id, 10), claims.Subject, "`sub` should match the user's ID`")
 	assert.False(t, claims.ExpiresAt.Time.Before(time.Now()), "expiration should be in the future")
 	assert.False(t, claims.IssuedAt.Time.After(time.Now()), "issued-at should not be in the future")
+	assert.False(t, claims.ExpiresAt.Time.After(time.Now().Add(AccessTokenTTL)), "access token should be short-lived")
+
+	// — wrong password → ErrInvalidAuth
+	_, err = svc.Login(context.Background(), model.LoginUserInput{
+		Email:    "jane@doe.com",
+		Password: "wrong",
+	})
+	assert.Equal(t, ErrInvalidAuth, err)
+
+	// — unverified email is rejected only when verification is required
+	svc.RequireVerifiedEmail = true
+	_, err = svc.Login(context.Background(), model.LoginUserInput{
+		Email:    "jane@doe.com",
+		Password: "test",
+	})
+	assert.Equal(t, ErrEmailNotVerified, err)
+
+	verifiedAt := time.Now()
+	want.EmailVerifiedAt = &verifiedAt
+	_, err = svc.Login(context.Background(), model.LoginUserInput{
+		Email:    "jane@doe.com",
+		Password: "test",
+	})
+	assert.NoError(t, err)
 }
 
 func TestUserService_Create(t *testing.T) {
@@ -137,39 +238,76 @@ func TestUserService_Create(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewUserService(repo)
+	svc := newTestUserService(repo)
 	in := model.CreateUserInput{
 		FirstName: "Foo",
 		LastName:  "Bar",
 		Email:     "foo@bar.com",
 	}
-	resp, jwtSecret, err := svc.Create(t.Context(), in)
+	resp, tokens, err := svc.Create(t.Context(), in)
 	require.NoError(t, err)
 	assert.NotNil(t, captured)
 	assert.Equal(t, in.FirstName, captured.FirstName)
-	assert.Equal(t, in.LastName, captured.LastName)
+	require.NotNil(t, captured.LastName)
+	assert.Equal(t, in.LastName, *captured.LastName)
 	assert.Equal(t, in.Email, captured.Email)
-	assert.NotNil(t, jwtSecret)
+	assert.Equal(t, []string{auth.RoleUser}, captured.Roles)
+	assert.Equal(t, []string{auth.RoleUser}, resp.Roles)
+	require.NotNil(t, tokens)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	claims := &auth.Claims{}
+	_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, testKeys.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.RoleUser}, claims.Roles)
 
 	_, parseErr := uuid.Parse(resp.ObjectId)
 	assert.NoError(t, parseErr)
 }
 
+func TestUserService_Create_DuplicateEmail(t *testing.T) {
+	var captured *model.User
+	svc := newTestUserService(&fakeRepo{
+		CreateFunc: func(u *model.User) error {
+			captured = u
+			return repo.ErrConflict.Wrap(errors.New("duplicate key value violates unique constraint"))
+		},
+	})
+	_, _, err := svc.Create(t.Context(), model.CreateUserInput{FirstName: "Foo", Email: "taken@bar.com", Password: "pw"})
+	assert.Nil(t, captured.LastName, "an empty last name is stored as none")
+	assert.Equal(t, ErrEmailTaken, err)
+	assert.Equal(t, http.StatusConflict, apperr.KindOf(err).Status())
+}
+
+func TestUserService_Login_RepoFailureIsNotInvalidAuth(t *testing.T) {
+	svc := newTestUserService(&fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			return nil, errors.New("db is down")
+		},
+	})
+	_, err := svc.Login(t.Context(), model.LoginUserInput{Email: "jane@doe.com", Password: "pw"})
+	assert.EqualError(t, err, "db is down")
+	assert.Equal(t, apperr.KindInternal, apperr.KindOf(err))
+}
+
 func TestUserService_Update(t *testing.T) {
 	// — not found
 	repoNF := &fakeRepo{
 		FindByObjectIdFunc: func(_ string) (*model.User, error) {
-			return nil, errors.New("oops")
+			return nil, repo.ErrNotFound
 		},
 	}
-	svc := NewUserService(repoNF)
-	_, err := svc.Update(t.Context(), "id", model.UpdateUserInput{})
+	svc := newTestUserService(repoNF)
+	_, err := svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{})
 	assert.Equal(t, ErrNotFound, err)
 
+	lastName := "Name"
 	existing := &model.User{
+		Id:        1,
 		ObjectId:  "id",
 		FirstName: "Orig",
-		LastName:  "Name",
+		LastName:  &lastName,
 		Email:     "orig@x.com",
 	}
 	var updated *model.User
@@ -177,47 +315,318 @@ func TestUserService_Update(t *testing.T) {
 		FindByObjectIdFunc: func(_ string) (*model.User, error) {
 			return existing, nil
 		},
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			if email == "taken@x.com" {
+				return &model.User{Id: 9, Email: email}, nil
+			}
+			return nil, repo.ErrNotFound
+		},
 		UpdateFunc: func(u *model.User) error {
 			updated = u
 			return nil
 		},
 	}
-	svc = NewUserService(repo)
-	newFirst := "NewFirst"
-	newEmail := "new@x.com"
-	resp, err := svc.Update(t.Context(), "id", model.UpdateUserInput{
-		FirstName: &newFirst,
-		Email:     &newEmail,
+	svc = newTestUserService(repo)
+
+	// — another caller → ErrForbidden, nothing written
+	_, err = svc.Update(t.Context(), Caller{Id: 2}, "id", Precondition{}, model.UpdateUserInput{FirstName: "NewFirst", Email: "orig@x.com"})
+	assert.Equal(t, ErrForbidden, err)
+	assert.Nil(t, updated)
+
+	resp, err := svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{
+		FirstName: "NewFirst",
+		LastName:  &lastName,
+		Email:     "new@x.com",
 	})
 	require.NoError(t, err)
 	assert.Equal(t, "id", resp.ObjectId)
 	assert.Equal(t, "NewFirst", resp.FirstName)
-	assert.Equal(t, "Name", resp.LastName)
-	assert.Equal(t, "new@x.com", resp.Email)
-	assert.Len(t, []string{updated.FirstName, updated.Email}, 2)
+	assert.Equal(t, &lastName, resp.LastName)
+	// — the new email is staged until it is confirmed
+	assert.Equal(t, "orig@x.com", resp.Email)
+	require.NotNil(t, resp.PendingEmail)
+	assert.Equal(t, "new@x.com", *resp.PendingEmail)
+	assert.Equal(t, "orig@x.com", updated.Email)
+
+	// — an address owned by someone else → ErrEmailTaken
+	_, err = svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{FirstName: "NewFirst", Email: "taken@x.com"})
+	assert.Equal(t, ErrEmailTaken, err)
+
+	// — PUT replaces the whole profile: leaving out the last name clears it, and asking for the current
+	// address again cancels the pending change
+	resp, err = svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{FirstName: "NewFirst", Email: "orig@x.com"})
+	require.NoError(t, err)
+	assert.Nil(t, resp.LastName)
+	assert.Nil(t, resp.PendingEmail)
+}
+
+func TestUserService_Patch(t *testing.T) {
+	var stored *model.User
+	writes := 0
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(_ string) (*model.User, error) {
+			lastName, pending := "Name", "new@x.com"
+			return &model.User{Id: 1, ObjectId: "id", FirstName: "Orig", LastName: &lastName, Email: "orig@x.com", PendingEmail: &pending}, nil
+		},
+		UpdateFunc: func(u *model.User) error {
+			stored = u
+			writes++
+			return nil
+		},
+	}
+	svc := newTestUserService(users)
+	parse := func(contentType, body string) patch.Patch {
+		p, err := patch.Parse(contentType, []byte(body), model.UserPatchFields...)
+		require.NoError(t, err)
+		return p
+	}
+
+	// — null clears the last name and leaves the rest alone, including the pending email
+	resp, err := svc.Patch(t.Context(), Caller{Id: 1}, "id", Precondition{}, parse(patch.MergePatchType, `{"first_name":" Ada ","last_name":null}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", resp.FirstName, "patched fields are normalized")
+	assert.Nil(t, resp.LastName)
+	assert.Nil(t, stored.LastName)
+	require.NotNil(t, resp.PendingEmail)
+	assert.Equal(t, "new@x.com", *resp.PendingEmail)
+
+	// — JSON patch operations see the pending email as the email
+	_, err = svc.Patch(t.Context(), Caller{Id: 1}, "id", Precondition{}, parse(patch.JSONPatchType,
+		`[{"op":"test","path":"/email","value":"new@x.com"},{"op":"replace","path":"/email","value":"orig@x.com"}]`))
+	require.NoError(t, err)
+	assert.Nil(t, stored.PendingEmail)
+
+	// — a failed test, an invalid result or a value of the wrong type writes nothing
+	writes = 0
+	_, err = svc.Patch(t.Context(), Caller{Id: 1}, "id", Precondition{}, parse(patch.JSONPatchType, `[{"op":"test","path":"/first_name","value":"Bob"}]`))
+	assert.ErrorIs(t, err, patch.ErrConflict)
+	_, err = svc.Patch(t.Context(), Caller{Id: 1}, "id", Precondition{}, parse(patch.MergePatchType, `{"first_name":null}`))
+	assert.ErrorIs(t, err, validation.ErrInvalid)
+	_, err = svc.Patch(t.Context(), Caller{Id: 1}, "id", Precondition{}, parse(patch.MergePatchType, `{"first_name":5}`))
+	assert.Equal(t, []apperr.FieldError{{Field: "first_name", Code: "type", Message: "must be a string"}}, apperr.From(err).Fields)
+	assert.Zero(t, writes)
+
+	// — preconditions are checked like Update's
+	_, err = svc.Patch(t.Context(), Caller{Id: 1}, "id", IfMatch(7), parse(patch.MergePatchType, `{}`))
+	assert.Equal(t, ErrVersionMismatch, err)
+}
+
+// fakeTransactor runs fn directly, counting calls, and fails with err after fn if it is set.
+type fakeTransactor struct {
+	calls int
+	err   error
+}
+
+func (f *fakeTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.calls++
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestUserService_UpdateRunsInTx(t *testing.T) {
+	writes := 0
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(_ string) (*model.User, error) {
+			return &model.User{Id: 1, ObjectId: "id", FirstName: "Orig", Email: "a@x.com"}, nil
+		},
+		UpdateFunc: func(u *model.User) error {
+			writes++
+			return nil
+		},
+	}
+	tx := &fakeTransactor{}
+	svc := newTestUserService(users)
+	svc.Tx = tx
+
+	resp, err := svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{FirstName: "New", Email: "a@x.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "New", resp.FirstName)
+	assert.Equal(t, 1, tx.calls)
+	assert.Equal(t, 1, writes)
+
+	// — a failed commit fails the update
+	tx.err = errors.New("commit failed")
+	_, err = svc.Update(t.Context(), Caller{Id: 1}, "id", Precondition{}, model.UpdateUserInput{FirstName: "New", Email: "a@x.com"})
+	assert.ErrorIs(t, err, tx.err)
+}
+
+func TestUserService_UpdatePreconditions(t *testing.T) {
+	var stale bool
+	writes := 0
+	users := &fakeRepo{
+		FindByObjectIdFunc: func(_ string) (*model.User, error) {
+			return &model.User{Id: 1, ObjectId: "id", FirstName: "Orig", Email: "a@x.com", Version: 3}, nil
+		},
+		UpdateFunc: func(u *model.User) error {
+			if stale {
+				return repo.ErrStale
+			}
+			writes++
+			u.Version++
+			return nil
+		},
+	}
+	svc := newTestUserService(users)
+	input := model.UpdateUserInput{FirstName: "New", Email: "a@x.com"}
+
+	tests := []struct {
+		name    string
+		pre     Precondition
+		require bool
+		want    error
+	}{
+		{name: "no If-Match", pre: Precondition{}},
+		{name: "current version", pre: IfMatch(2, 3)},
+		{name: "any version", pre: IfMatchAny()},
+		{name: "old version", pre: IfMatch(2), want: ErrVersionMismatch},
+		{name: "no usable tag", pre: IfMatch(), want: ErrVersionMismatch},
+		{name: "required but missing", pre: Precondition{}, require: true, want: ErrPreconditionRequired},
+		{name: "required and given", pre: IfMatchAny(), require: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writes = 0
+			svc.RequireIfMatch = tt.require
+			resp, err := svc.Update(t.Context(), Caller{Id: 1}, "id", tt.pre, input)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+				assert.Zero(t, writes, "nothing is written when the precondition fails")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(4), resp.Version)
+			assert.Equal(t, 1, writes)
+		})
+	}
+
+	// — losing a race to another write is reported like a stale If-Match
+	svc.RequireIfMatch = false
+	stale = true
+	_, err := svc.Update(t.Context(), Caller{Id: 1}, "id", IfMatch(3), input)
+	assert.Equal(t, ErrVersionMismatch, err)
+	assert.Equal(t, http.StatusPreconditionFailed, apperr.KindOf(err).Status())
 }
 
 func TestUserService_Delete(t *testing.T) {
-	// — success
+	owned := func(_ string) (*model.User, error) {
+		return &model.User{Id: 1, ObjectId: "xyz"}, nil
+	}
+
+	// — success revokes the deleted user's tokens
 	var did string
 	repoOK := &fakeRepo{
+		FindByObjectIdFunc: owned,
 		DeleteFunc: func(id string) error {
 			did = id
 			return nil
 		},
 	}
-	svc := NewUserService(repoOK)
-	err := svc.Delete(t.Context(), "xyz")
+	denylist := newTestDenylist()
+	svc := NewUserService(repoOK, NewTokenService(repoOK, newFakeTokenRepo(), testKeys, denylist), nil, nil)
+	err := svc.Delete(t.Context(), Caller{Id: 1}, "xyz", Precondition{})
 	assert.NoError(t, err)
 	assert.Equal(t, "xyz", did)
+	assert.True(t, denylist.IsRevoked("", 1, time.Now().Add(-time.Minute)))
+
+	// — another caller → ErrForbidden, nothing deleted
+	did = ""
+	err = svc.Delete(t.Context(), Caller{Id: 2}, "xyz", Precondition{})
+	assert.Equal(t, ErrForbidden, err)
+	assert.Empty(t, did)
+
+	// — a stale If-Match → ErrVersionMismatch, nothing deleted
+	err = svc.Delete(t.Context(), Caller{Id: 1}, "xyz", IfMatch(7))
+	assert.Equal(t, ErrVersionMismatch, err)
+	assert.Empty(t, did)
+
+	// — another caller holding users:delete may delete it
+	err = svc.Delete(t.Context(), Caller{Id: 2, Permissions: []string{auth.PermUsersDelete}}, "xyz", Precondition{})
+	assert.NoError(t, err)
+	assert.Equal(t, "xyz", did)
+
+	// — not found
+	repoNF := &fakeRepo{
+		FindByObjectIdFunc: func(_ string) (*model.User, error) {
+			return nil, repo.ErrNotFound
+		},
+	}
+	svc = newTestUserService(repoNF)
+	err = svc.Delete(t.Context(), Caller{Id: 1}, "xyz", Precondition{})
+	assert.Equal(t, ErrNotFound, err)
 
 	// — failure
 	repoErr := &fakeRepo{
+		FindByObjectIdFunc: owned,
 		DeleteFunc: func(_ string) error {
 			return errors.New("cannot delete")
 		},
 	}
-	svc = NewUserService(repoErr)
-	err = svc.Delete(t.Context(), "xyz")
+	svc = newTestUserService(repoErr)
+	err = svc.Delete(t.Context(), Caller{Id: 1}, "xyz", Precondition{})
 	assert.EqualError(t, err, "cannot delete")
 }
+
+func TestUserService_Restore(t *testing.T) {
+	admin := Caller{Id: 1, Permissions: []string{auth.PermUsersRestore}}
+	var restored string
+	repo := &fakeRepo{
+		RestoreFunc: func(id string) (*model.User, error) {
+			if id != "deleted" {
+				return nil, repo.ErrNotFound
+			}
+			restored = id
+			return &model.User{Id: 3, ObjectId: id, FirstName: "Del"}, nil
+		},
+	}
+	svc := newTestUserService(repo)
+
+	// — callers without users:restore cannot restore
+	_, err := svc.Restore(t.Context(), Caller{Id: 2}, "deleted")
+	assert.Equal(t, ErrForbidden, err)
+	_, err = svc.Restore(t.Context(), Caller{Id: 2, Permissions: []string{auth.PermUsersRead}}, "deleted")
+	assert.Equal(t, ErrForbidden, err)
+	assert.Empty(t, restored)
+
+	resp, err := svc.Restore(t.Context(), admin, "deleted")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", resp.ObjectId)
+
+	// — a user that is not soft-deleted → ErrNotFound
+	_, err = svc.Restore(t.Context(), admin, "regular")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUserPurger_Purge(t *testing.T) {
+	var cutoff time.Time
+	repo := &fakeRepo{
+		PurgeFunc: func(before time.Time) (int64, error) {
+			cutoff = before
+			return 2, nil
+		},
+	}
+	n, err := NewUserPurger(repo, 24*time.Hour).Purge(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), cutoff, time.Second)
+}
+
+func TestUserService_RevokeSessions(t *testing.T) {
+	repo := &fakeRepo{
+		FindByObjectIdFunc: func(_ string) (*model.User, error) {
+			return &model.User{Id: 1, ObjectId: "xyz"}, nil
+		},
+	}
+	denylist := newTestDenylist()
+	svc := NewUserService(repo, NewTokenService(repo, newFakeTokenRepo(), testKeys, denylist), nil, nil)
+
+	// — another caller → ErrForbidden, nothing revoked
+	err := svc.RevokeSessions(t.Context(), Caller{Id: 2}, "xyz")
+	assert.Equal(t, ErrForbidden, err)
+	assert.False(t, denylist.IsRevoked("", 1, time.Now().Add(-time.Minute)))
+
+	err = svc.RevokeSessions(t.Context(), Caller{Id: 1}, "xyz")
+	require.NoError(t, err)
+	assert.True(t, denylist.IsRevoked("", 1, time.Now().Add(-time.Minute)))
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/middleware/auth"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+var ErrInvalidVerificationToken = apperr.Validation("invalid_verification_token", "invalid or expired email verification token")
+var ErrEmailTaken = apperr.Conflict("email_taken", "email is already in use")
+var ErrEmailNotVerified = apperr.Forbidden("email_not_verified", "email address has not been verified")
+
+const EmailVerificationTTL = 24 * time.Hour
+
+// VerificationService confirms that users control their email address. Each token is bound to the address
+// it was mailed to, so a link for a superseded email change cannot confirm the newer one.
+type VerificationService struct {
+	users         repo.UserRepository
+	verifications repo.EmailVerificationRepository
+	mailer        mail.Sender
+	verifyURL     string
+	ttl           time.Duration
+}
+
+// NewVerificationService builds the service. verifyURL is the endpoint the emailed link points at; the
+// token is appended as the "token" query parameter.
+func NewVerificationService(users repo.UserRepository, verifications repo.EmailVerificationRepository, mailer mail.Sender, verifyURL string) *VerificationService {
+	return &VerificationService{
+		users:         users,
+		verifications: verifications,
+		mailer:        mailer,
+		verifyURL:     verifyURL,
+		ttl:           EmailVerificationTTL,
+	}
+}
+
+// Send mails a verification link for email, which is either the user's current address or their pending one.
+func (s *VerificationService) Send(ctx context.Context, u *model.User, email string) error {
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	t := &model.EmailVerificationToken{
+		UserId:    u.Id,
+		Email:     email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := s.verifications.Create(ctx, t); err != nil {
+		return err
+	}
+	link, err := withToken(s.verifyURL, raw)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Use the link below to confirm this email address. It expires in %s.\n\n%s\n\n"+
+			"If you did not ask for this you can ignore this email.", s.ttl, link),
+	})
+}
+
+// Verify consumes a verification token and marks its address as verified. A pending address becomes the
+// user's login email.
+func (s *VerificationService) Verify(ctx context.Context, rawToken string) error {
+	t, err := s.verifications.FindByHash(ctx, auth.HashOpaqueToken(rawToken))
+	if errors.Is(err, repo.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	} else if err != nil {
+		return err
+	}
+	if t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return ErrInvalidVerificationToken
+	}
+	// the address may have been claimed by another account since the change was requested
+	if other, err := s.users.FindByEmail(ctx, t.Email); err == nil && other.Id != t.UserId {
+		return ErrEmailTaken
+	}
+	used, err := s.verifications.MarkUsed(ctx, t.Id)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidVerificationToken
+	}
+	confirmed, err := s.users.ConfirmEmail(ctx, t.UserId, t.Email)
+	if errors.Is(err, repo.ErrConflict) {
+		return ErrEmailTaken
+	} else if err != nil {
+		return err
+	}
+	if !confirmed {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// withToken appends rawToken to base as the "token" query parameter.
+func withToken(base string, rawToken string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", rawToken)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/mail"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/repo"
+)
+
+type fakeVerificationRepo struct {
+	mu     sync.Mutex
+	byHash map[string]*model.EmailVerificationToken
+}
+
+func newFakeVerificationRepo() *fakeVerificationRepo {
+	return &fakeVerificationRepo{byHash: map[string]*model.EmailVerificationToken{}}
+}
+
+func (f *fakeVerificationRepo) Create(ctx context.Context, t *model.EmailVerificationToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.Id = int64(len(f.byHash) + 1)
+	cp := *t
+	f.byHash[t.TokenHash] = &cp
+	return nil
+}
+
+func (f *fakeVerificationRepo) FindByHash(ctx context.Context, hash string) (*model.EmailVerificationToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.byHash[hash]
+	if !ok {
+		return nil, repo.ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (f *fakeVerificationRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.byHash {
+		if t.Id == id && t.UsedAt == nil {
+			now := time.Now()
+			t.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verificationTokenFrom pulls the raw token out of the link in a verification email.
+func verificationTokenFrom(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if strings.HasPrefix(line, "http") {
+			u, err := url.Parse(line)
+			require.NoError(t, err)
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no link in message body %q", msg.Body)
+	return ""
+}
+
+func TestVerificationService_VerifiesPendingEmail(t *testing.T) {
+	pending := "new@x.com"
+	user := &model.User{Id: 1, Email: "orig@x.com", PendingEmail: &pending}
+	var confirmed []string
+	users := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) {
+			if email == "other@x.com" {
+				return &model.User{Id: 2, Email: email}, nil
+			}
+			return nil, repo.ErrNotFound
+		},
+		ConfirmEmailFunc: func(id int64, email string) (bool, error) {
+			assert.Equal(t, int64(1), id)
+			if email != user.Email && (user.PendingEmail == nil || email != *user.PendingEmail) {
+				return false, nil
+			}
+			confirmed = append(confirmed, email)
+			user.Email, user.PendingEmail = email, nil
+			return true, nil
+		},
+	}
+	mailer, err := mail.NewFileSender(t.TempDir())
+	require.NoError(t, err)
+	svc := NewVerificationService(users, newFakeVerificationRepo(), mailer, "http://localhost/verify")
+
+	require.NoError(t, svc.Send(t.Context(), user, pending))
+	msgs, err := mailer.Messages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, pending, msgs[0].To)
+	raw := verificationTokenFrom(t, msgs[0])
+
+	require.NoError(t, svc.Verify(t.Context(), raw))
+	assert.Equal(t, []string{"new@x.com"}, confirmed)
+	assert.Equal(t, "new@x.com", user.Email)
+
+	// — tokens are single use
+	assert.Equal(t, ErrInvalidVerificationToken, svc.Verify(t.Context(), raw))
+	assert.Equal(t, ErrInvalidVerificationToken, svc.Verify(t.Context(), "not-a-token"))
+
+	// — a link for an address that is no longer current or pending is stale
+	require.NoError(t, svc.Send(t.Context(), user, "abandoned@x.com"))
+	msgs, err = mailer.Messages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, ErrInvalidVerificationToken, svc.Verify(t.Context(), verificationTokenFrom(t, msgs[1])))
+
+	// — an address claimed by another account in the meantime
+	require.NoError(t, svc.Send(t.Context(), user, "other@x.com"))
+	msgs, err = mailer.Messages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	assert.Equal(t, ErrEmailTaken, svc.Verify(t.Context(), verificationTokenFrom(t, msgs[2])))
+}
+
+func TestVerificationService_RejectsExpiredToken(t *testing.T) {
+	users := &fakeRepo{
+		FindByEmailFunc: func(email string) (*model.User, error) { return nil, repo.ErrNotFound },
+		ConfirmEmailFunc: func(id int64, email string) (bool, error) {
+			t.Fatal("expired token must not confirm the email")
+			return false, nil
+		},
+	}
+	mailer, err := mail.NewFileSender(t.TempDir())
+	require.NoError(t, err)
+	svc := NewVerificationService(users, newFakeVerificationRepo(), mailer, "http://localhost/verify")
+	svc.ttl = -time.Minute
+
+	require.NoError(t, svc.Send(t.Context(), &model.User{Id: 1, Email: "a@x.com"}, "a@x.com"))
+	msgs, err := mailer.Messages()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, ErrInvalidVerificationToken, svc.Verify(t.Context(), verificationTokenFrom(t, msgs[0])))
+}
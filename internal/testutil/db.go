@@ -2,18 +2,15 @@ package testutil
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"testing"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/thornhall/simple-go-service/internal/dal"
 )
 
 // StartPostgresContainer spins up Postgres, runs migrations, and
@@ -50,22 +47,8 @@ func StartPostgresContainer(t *testing.T) (dsn string, pgC testcontainers.Contai
 }
 
 func runMigrations(t *testing.T, dsn string) {
-	sqlDB, err := sql.Open("pgx", dsn)
-	require.NoError(t, err)
-	require.NoError(t, sqlDB.Ping())
-
-	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
-	require.NoError(t, err)
-
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://../../db/migrations",
-		"postgres",
-		driver,
-	)
+	m, err := dal.NewMigrator(dsn)
 	require.NoError(t, err)
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		t.Fatalf("migrate up: %v", err)
-	}
-	sqlDB.Close()
+	defer m.Close()
+	require.NoError(t, m.Up(), "migrate up")
 }
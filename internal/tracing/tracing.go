@@ -0,0 +1,107 @@
+// Package tracing sets up OpenTelemetry tracing and the gin middleware that starts a span per request.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+)
+
+const instrumentation = "github.com/thornhall/simple-go-service/internal/tracing"
+
+// Setup installs the global tracer provider and the W3C trace-context propagator. The returned function
+// flushes buffered spans and must be called before the process exits. With the none exporter spans are
+// still created, so trace ids propagate, but nothing is exported.
+func Setup(ctx context.Context, cfg config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	return setup(ctx, cfg, os.Stdout)
+}
+
+func setup(ctx context.Context, cfg config.TracingConfig, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	switch cfg.Exporter {
+	case "none":
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(stdout))
+		if err != nil {
+			return nil, err
+		}
+		// synchronous so spans are written as they end, which keeps offline runs easy to follow
+		opts = append(opts, sdktrace.WithSyncer(exporter))
+	case "otlp":
+		var exporterOpts []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for each request, continuing the caller's trace when the request carries
+// a traceparent header. Spans are named after the route template so ids in the path do not make every
+// span name unique.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		parent := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		route := ctx.FullPath()
+		name := ctx.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		spanCtx, span := otel.Tracer(instrumentation).Start(parent, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.URLPath(ctx.Request.URL.Path),
+				semconv.ClientAddress(ctx.ClientIP()),
+				semconv.UserAgentOriginal(ctx.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+		if route != "" {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+		if len(ctx.Errors) > 0 {
+			span.SetAttributes(attribute.String("gin.errors", ctx.Errors.String()))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/thornhall/simple-go-service/internal/config"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	_, err := setup(context.Background(), config.TracingConfig{Exporter: "none", ServiceName: "test"}, nil)
+	require.NoError(t, err)
+	recorder := recordSpans(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	var handlerSpan trace.SpanContext
+	r.GET("/users/:object_id", func(ctx *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(ctx.Request.Context())
+		ctx.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/users/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /users/:object_id", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+	assert.Equal(t, "/users/:object_id", attrs(span)["http.route"].AsString())
+	assert.Equal(t, int64(500), attrs(span)["http.response.status_code"].AsInt64())
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestSetup_StdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	shutdown, err := setup(context.Background(), config.TracingConfig{Exporter: "stdout", ServiceName: "test"}, &out)
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name":"work"`)
+	assert.Contains(t, out.String(), `"Value":"test"`)
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := setup(context.Background(), config.TracingConfig{Exporter: "jaeger"}, nil)
+	assert.EqualError(t, err, `unknown tracing exporter "jaeger"`)
+}
@@ -0,0 +1,100 @@
+package validation
+
+import (
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// maxEmailLength is the longest address SMTP can deliver to (RFC 5321).
+	maxEmailLength    = 254
+	maxNameLength     = 100
+	minPasswordLength = 8
+	maxPasswordLength = 64
+	// bcrypt ignores everything past 72 bytes, so a longer password would be silently truncated.
+	maxPasswordBytes = 72
+)
+
+var rules = map[string]validator.Func{
+	"email_address": func(fl validator.FieldLevel) bool { return IsEmail(fl.Field().String()) },
+	"person_name":   func(fl validator.FieldLevel) bool { return IsName(fl.Field().String()) },
+	"password":      func(fl validator.FieldLevel) bool { return IsStrongPassword(fl.Field().String()) },
+}
+
+// aliases name combinations of rules. optional_name is for names that may be cleared, which omitempty
+// cannot express on a pointer field.
+var aliases = map[string]string{
+	"optional_name": "eq=|person_name",
+}
+
+var ruleMessages = map[string]string{
+	"email_address": "must be a valid email address",
+	"person_name":   "must be 1 to 100 letters, spaces, hyphens, apostrophes or periods",
+	"optional_name": "must be empty or 1 to 100 letters, spaces, hyphens, apostrophes or periods",
+	"password":      "must be 8 to 64 characters and contain a letter and a digit or symbol",
+}
+
+// NormalizeEmail is the form emails are stored and looked up in: trimmed and lowercased.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeName trims surrounding whitespace from a name.
+func NormalizeName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// IsEmail reports whether email is a bare, normalized address such as "ada@example.com". Display names
+// ("Ada <ada@example.com>") are rejected.
+func IsEmail(email string) bool {
+	if email == "" || len(email) > maxEmailLength || email != NormalizeEmail(email) {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Name == "" && addr.Address == email
+}
+
+// IsName reports whether name is 1 to 100 characters of letters, spaces, hyphens, apostrophes and
+// periods, with at least one letter and no surrounding whitespace.
+func IsName(name string) bool {
+	n := utf8.RuneCountInString(name)
+	if n == 0 || n > maxNameLength || name != NormalizeName(name) {
+		return false
+	}
+	hasLetter := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.Is(unicode.M, r), r == ' ', r == '-', r == '\'', r == '’', r == '.':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+// IsStrongPassword reports whether password is 8 to 64 characters, fits in bcrypt's 72 bytes, contains a
+// letter and a digit or symbol, and has no control characters.
+func IsStrongPassword(password string) bool {
+	n := utf8.RuneCountInString(password)
+	if n < minPasswordLength || n > maxPasswordLength || len(password) > maxPasswordBytes {
+		return false
+	}
+	var hasLetter, hasOther bool
+	for _, r := range password {
+		switch {
+		case unicode.IsControl(r):
+			return false
+		case unicode.IsLetter(r):
+			hasLetter = true
+		default:
+			hasOther = true
+		}
+	}
+	return hasLetter && hasOther
+}
@@ -0,0 +1,134 @@
+// Package validation checks request inputs against the rules in their `validate` struct tags and reports
+// every failing field at once. Besides the stock go-playground/validator rules it registers the service's
+// own: email_address, person_name, optional_name and password.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+)
+
+// ErrInvalid is returned for an input that fails validation. Its Fields say which fields and why.
+var ErrInvalid = apperr.Validation("validation_failed", "request failed validation")
+
+// Normalizer is implemented by inputs that clean up their fields, e.g. trimming and lowercasing an email,
+// before they are validated.
+type Normalizer interface {
+	Normalize()
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(fieldName)
+	for tag, rule := range rules {
+		if err := v.RegisterValidation(tag, rule); err != nil {
+			panic(fmt.Sprintf("validation: registering %s: %v", tag, err))
+		}
+	}
+	for alias, tags := range aliases {
+		v.RegisterAlias(alias, tags)
+	}
+	return v
+}
+
+// fieldName reports fields by the name clients send them under: the json key, or the form key for query
+// parameters.
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// Struct normalizes v if it is a Normalizer and validates it. v must be a pointer to a struct. The error
+// is ErrInvalid listing every failing field, or nil.
+func Struct(v any) error {
+	if n, ok := v.(Normalizer); ok {
+		n.Normalize()
+	}
+	err := validate.Struct(v)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	fields := make([]apperr.FieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, fieldError(fe))
+	}
+	return ErrInvalid.WithFields(fields...)
+}
+
+// TypeError reports a JSON value of the wrong type for its field like any other validation failure.
+func TypeError(err *json.UnmarshalTypeError) error {
+	return ErrInvalid.WithFields(apperr.FieldError{
+		Field:   err.Field,
+		Code:    "type",
+		Message: "must be " + jsonType(err.Type),
+	})
+}
+
+// jsonType names the JSON type that decodes into t.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+func fieldError(fe validator.FieldError) apperr.FieldError {
+	// the namespace starts with the struct's Go name, which means nothing to clients
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return apperr.FieldError{Field: path, Code: fe.Tag(), Message: message(fe)}
+}
+
+func message(fe validator.FieldError) string {
+	if m, ok := ruleMessages[fe.Tag()]; ok {
+		return m
+	}
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param() + unit
+	case "max":
+		return "must be at most " + fe.Param() + unit
+	case "len":
+		return "must be exactly " + fe.Param() + unit
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
@@ -0,0 +1,118 @@
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/thornhall/simple-go-service/internal/apperr"
+	"github.com/thornhall/simple-go-service/internal/model"
+	"github.com/thornhall/simple-go-service/internal/validation"
+)
+
+func fields(t *testing.T, err error) []apperr.FieldError {
+	t.Helper()
+	require.ErrorIs(t, err, validation.ErrInvalid)
+	return apperr.From(err).Fields
+}
+
+func TestStruct_ListsEveryField(t *testing.T) {
+	err := validation.Struct(&model.CreateUserInput{FirstName: "R2-D2", Email: "not an email", Password: "password"})
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "first_name", Code: "person_name", Message: "must be 1 to 100 letters, spaces, hyphens, apostrophes or periods"},
+		{Field: "email", Code: "email_address", Message: "must be a valid email address"},
+		{Field: "password", Code: "password", Message: "must be 8 to 64 characters and contain a letter and a digit or symbol"},
+	}, fields(t, err))
+}
+
+func TestStruct_NormalizesFirst(t *testing.T) {
+	input := model.CreateUserInput{FirstName: "  Ada ", LastName: "Lovelace", Email: " Ada@Example.COM ", Password: "engine-1843"}
+	require.NoError(t, validation.Struct(&input))
+	assert.Equal(t, "Ada", input.FirstName)
+	assert.Equal(t, "ada@example.com", input.Email)
+}
+
+func TestStruct_UpdateReplacesEveryField(t *testing.T) {
+	err := validation.Struct(&model.UpdateUserInput{})
+	assert.Equal(t, []string{"first_name", "email"}, fieldNames(fields(t, err)))
+
+	blank := "  "
+	input := model.UpdateUserInput{FirstName: "Grace", LastName: &blank, Email: "grace@example.com"}
+	require.NoError(t, validation.Struct(&input))
+	assert.Nil(t, input.LastName, "a blank last name clears it")
+}
+
+func TestStruct_LoginDoesNotCheckStrength(t *testing.T) {
+	require.NoError(t, validation.Struct(&model.LoginUserInput{Email: "a@example.com", Password: "legacy"}))
+
+	err := validation.Struct(&model.LoginUserInput{Email: "a@example.com"})
+	assert.Equal(t, []apperr.FieldError{{Field: "password", Code: "required", Message: "is required"}}, fields(t, err))
+}
+
+func TestStruct_QueryParamsUseFormNames(t *testing.T) {
+	err := validation.Struct(&model.ListUsersParams{Limit: 500, Sort: "password"})
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "limit", Code: "max", Message: "must be at most 100"},
+		{Field: "sort", Code: "oneof", Message: "must be one of: created_at, -created_at, updated_at, -updated_at, email, -email, first_name, -first_name, last_name, -last_name"},
+	}, fields(t, err))
+}
+
+func fieldNames(fs []apperr.FieldError) []string {
+	names := make([]string, len(fs))
+	for i, f := range fs {
+		names[i] = f.Field
+	}
+	return names
+}
+
+func TestIsEmail(t *testing.T) {
+	for email, want := range map[string]bool{
+		"ada@example.com":                  true,
+		"ada+tag@mail.example.co.uk":       true,
+		"Ada@example.com":                  false,
+		" ada@example.com":                 false,
+		"Ada <ada@example.com>":            false,
+		"ada":                              false,
+		"":                                 false,
+		strings.Repeat("a", 250) + "@x.io": false,
+	} {
+		assert.Equal(t, want, validation.IsEmail(email), email)
+	}
+}
+
+func TestIsName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Ada":                    true,
+		"Mary-Jane O'Neil":       true,
+		"José":                   true,
+		"J. R. R.":               true,
+		"Zoë":                    true,
+		"":                       false,
+		" Ada":                   false,
+		"-.'":                    false,
+		"Ada1":                   false,
+		"<script>":               false,
+		strings.Repeat("a", 101): false,
+		strings.Repeat("é", 100): true,
+	} {
+		assert.Equal(t, want, validation.IsName(name), name)
+	}
+}
+
+func TestIsStrongPassword(t *testing.T) {
+	for password, want := range map[string]bool{
+		"test_pass":                   true,
+		"correct horse":               true,
+		"hunter22":                    true,
+		"password":                    false,
+		"12345678":                    false,
+		"short1":                      false,
+		"tab\tinside1":                false,
+		strings.Repeat("a1", 33):      false,
+		strings.Repeat("é", 40) + "1": false, // 81 bytes, past bcrypt's limit
+	} {
+		assert.Equal(t, want, validation.IsStrongPassword(password), password)
+	}
+}